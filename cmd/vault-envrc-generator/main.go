@@ -1,6 +1,9 @@
 package main
 
 import (
+	"fmt"
+	"os"
+
 	clay "github.com/go-go-golems/clay/pkg"
 	"github.com/go-go-golems/glazed/pkg/cli"
 	"github.com/go-go-golems/glazed/pkg/cmds/logging"
@@ -19,6 +22,8 @@ func main() {
 		Use:     "vault-envrc-generator",
 		Short:   "Generate envrc and seed Vault via glazed commands",
 		Version: version,
+		// Errors are printed below so the exit code can reflect the kind of failure
+		SilenceErrors: true,
 		PersistentPreRun: func(cmd *cobra.Command, args []string) {
 			err := logging.InitLoggerFromCobra(cmd)
 			cobra.CheckErr(err)
@@ -128,6 +133,22 @@ func main() {
 		cobra.CheckErr(err)
 	}
 
+	if rmc, err := appcmds.NewRmCommand(); err == nil {
+		cmd, err := cli.BuildCobraCommand(rmc, opts...)
+		cobra.CheckErr(err)
+		rootCmd.AddCommand(cmd)
+	} else {
+		cobra.CheckErr(err)
+	}
+
+	if uc, err := appcmds.NewUndeleteCommand(); err == nil {
+		cmd, err := cli.BuildCobraCommand(uc, opts...)
+		cobra.CheckErr(err)
+		rootCmd.AddCommand(cmd)
+	} else {
+		cobra.CheckErr(err)
+	}
+
 	if dc, err := appcmds.NewDiffEnvCommand(); err == nil {
 		cmd, err := cli.BuildCobraCommand(dc, opts...)
 		cobra.CheckErr(err)
@@ -136,5 +157,24 @@ func main() {
 		cobra.CheckErr(err)
 	}
 
-	cobra.CheckErr(rootCmd.Execute())
+	if hc, err := appcmds.NewHistoryCommand(); err == nil {
+		cmd, err := cli.BuildCobraCommand(hc, opts...)
+		cobra.CheckErr(err)
+		rootCmd.AddCommand(cmd)
+	} else {
+		cobra.CheckErr(err)
+	}
+
+	if rc, err := appcmds.NewRollbackCommand(); err == nil {
+		cmd, err := cli.BuildCobraCommand(rc, opts...)
+		cobra.CheckErr(err)
+		rootCmd.AddCommand(cmd)
+	} else {
+		cobra.CheckErr(err)
+	}
+
+	if err := rootCmd.Execute(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(appcmds.ExitCode(err))
+	}
 }
@@ -4,7 +4,7 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"time"
+	"strings"
 
 	glzcli "github.com/go-go-golems/glazed/pkg/cli"
 	gcmds "github.com/go-go-golems/glazed/pkg/cmds"
@@ -15,7 +15,7 @@ import (
 
 	"github.com/go-go-golems/vault-envrc-generator/pkg/batch"
 	"github.com/go-go-golems/vault-envrc-generator/pkg/cmdutil"
-	"github.com/go-go-golems/vault-envrc-generator/pkg/vault"
+	"github.com/go-go-golems/vault-envrc-generator/pkg/envrc"
 	"github.com/go-go-golems/vault-envrc-generator/pkg/vaultlayer"
 )
 
@@ -33,6 +33,7 @@ type BatchSettings struct {
 	Sections        []string `glazed:"sections"`
 	ForceOverwrite  bool     `glazed:"force-overwrite"`
 	SkipUnreadable  bool     `glazed:"skip-unreadable"`
+	Stats           bool     `glazed:"stats"`
 }
 
 func NewBatchCommand() (*BatchCommand, error) {
@@ -48,7 +49,7 @@ func NewBatchCommand() (*BatchCommand, error) {
 			fields.New("config", fields.TypeString, fields.WithRequired(true), fields.WithHelp("Batch YAML file"), fields.WithShortFlag("c")),
 			fields.New("base-path", fields.TypeString, fields.WithHelp("Base Vault path to prepend to relative section paths")),
 			fields.New("output", fields.TypeString, fields.WithHelp("Override output for all jobs; '-' for stdout")),
-			fields.New("format", fields.TypeString, fields.WithHelp("envrc|json|yaml")),
+			fields.New("format", fields.TypeString, fields.WithHelp("Override the output format of all jobs ("+strings.Join(envrc.FormatNames(), "|")+")")),
 			fields.New("continue-on-error", fields.TypeBool, fields.WithDefault(false), fields.WithHelp("Continue processing on errors")),
 			fields.New("dry-run", fields.TypeBool, fields.WithDefault(false), fields.WithHelp("Preview outputs without writing files")),
 			fields.New("sort-keys", fields.TypeBool, fields.WithDefault(true), fields.WithHelp("Sort JSON/YAML keys for deterministic output")),
@@ -56,6 +57,7 @@ func NewBatchCommand() (*BatchCommand, error) {
 			fields.New("sections", fields.TypeStringList, fields.WithHelp("Only process sections with these names; default all")),
 			fields.New("force-overwrite", fields.TypeBool, fields.WithDefault(false), fields.WithHelp("Overwrite .envrc without prompting")),
 			fields.New("skip-unreadable", fields.TypeBool, fields.WithDefault(false), fields.WithHelp("Skip sections that cannot be read; warn instead of failing")),
+			fields.New("stats", fields.TypeBool, fields.WithDefault(false), fields.WithHelp("Print how many Vault calls were made (and served from cache) to stderr")),
 		),
 		gcmds.WithSections(section),
 	)
@@ -72,20 +74,23 @@ func (c *BatchCommand) Run(ctx context.Context, parsed *values.Values) error {
 	if err := parsed.DecodeSectionInto(schema.DefaultSlug, s); err != nil {
 		return err
 	}
+	if s.Format != "" {
+		if _, err := envrc.LookupFormatter(s.Format); err != nil {
+			return err
+		}
+	}
 	vs, err := vaultlayer.GetVaultSettings(parsed)
 	if err != nil {
 		return err
 	}
 
-	ctx2, cancel := context.WithTimeout(ctx, 10*time.Second)
-	defer cancel()
-	token, err := vault.ResolveToken(ctx2, vs.VaultToken, vault.TokenSource(vs.VaultTokenSource), vs.VaultTokenFile, false)
+	session, err := vs.OpenSession(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to resolve Vault token: %w", err)
+		return err
 	}
-	client, err := vault.NewClient(vs.VaultAddr, token)
-	if err != nil {
-		return fmt.Errorf("failed to create Vault client: %w", err)
+	defer session.Close()
+	if s.Stats {
+		defer func() { fmt.Fprintln(os.Stderr, session.Stats()) }()
 	}
 
 	cfg, err := loadBatchConfig(s.Config)
@@ -102,8 +107,8 @@ func (c *BatchCommand) Run(ctx context.Context, parsed *values.Values) error {
 			cfg.Jobs[ji].Sections = cmdutil.FilterItems(job.Sections, s.Sections, func(sec batch.Section) string { return sec.Name }, func(sec batch.Section) string { return sec.Path })
 		}
 	}
-	proc := batch.Processor{Client: client}
-	return proc.Process(cfg, batch.ProcessorOptions{
+	proc := batch.Processor{Client: session}
+	return proc.Process(ctx, cfg, batch.ProcessorOptions{
 		BasePath:               s.BasePath,
 		OutputOverride:         s.OutputOverride,
 		FormatOverride:         s.Format,
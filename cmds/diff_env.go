@@ -3,7 +3,7 @@ package cmds
 import (
 	"context"
 	"fmt"
-	"time"
+	"os"
 
 	glzcli "github.com/go-go-golems/glazed/pkg/cli"
 	gcmds "github.com/go-go-golems/glazed/pkg/cmds"
@@ -12,7 +12,6 @@ import (
 	"github.com/go-go-golems/glazed/pkg/cmds/values"
 
 	"github.com/go-go-golems/vault-envrc-generator/pkg/diffenv"
-	"github.com/go-go-golems/vault-envrc-generator/pkg/vault"
 	"github.com/go-go-golems/vault-envrc-generator/pkg/vaultlayer"
 )
 
@@ -26,6 +25,7 @@ type DiffEnvSettings struct {
 	Reveal    bool   `glazed:"reveal-values"`
 	CensorPre int    `glazed:"censor-prefix"`
 	CensorSuf int    `glazed:"censor-suffix"`
+	Stats     bool   `glazed:"stats"`
 }
 
 func NewDiffEnvCommand() (*DiffEnvCommand, error) {
@@ -45,6 +45,7 @@ func NewDiffEnvCommand() (*DiffEnvCommand, error) {
 			fields.New("reveal-values", fields.TypeBool, fields.WithDefault(false), fields.WithHelp("Reveal real values instead of censored")),
 			fields.New("censor-prefix", fields.TypeInteger, fields.WithDefault(2), fields.WithHelp("Visible characters at start of value when censored")),
 			fields.New("censor-suffix", fields.TypeInteger, fields.WithDefault(2), fields.WithHelp("Visible characters at end of value when censored")),
+			fields.New("stats", fields.TypeBool, fields.WithDefault(false), fields.WithHelp("Print how many Vault calls were made (and served from cache) to stderr")),
 		),
 		gcmds.WithSections(section),
 	)
@@ -69,18 +70,16 @@ func (c *DiffEnvCommand) Run(ctx context.Context, parsed *values.Values) error {
 		return err
 	}
 
-	ctx2, cancel := context.WithTimeout(ctx, 15*time.Second)
-	defer cancel()
-	token, err := vault.ResolveToken(ctx2, vs.VaultToken, vault.TokenSource(vs.VaultTokenSource), vs.VaultTokenFile, false)
+	session, err := vs.OpenSession(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to resolve Vault token: %w", err)
+		return err
 	}
-	client, err := vault.NewClient(vs.VaultAddr, token)
-	if err != nil {
-		return fmt.Errorf("failed to create Vault client: %w", err)
+	defer session.Close()
+	if s.Stats {
+		defer func() { fmt.Fprintln(os.Stderr, session.Stats()) }()
 	}
 
-	res, err := diffenv.Compute(client, diffenv.Options{SeedPath: s.SeedPath, BatchPath: s.BatchPath, BasePath: s.BasePath, IncludeExtra: s.ShowExtra})
+	res, err := diffenv.Compute(ctx, session, diffenv.Options{SeedPath: s.SeedPath, BatchPath: s.BatchPath, BasePath: s.BasePath, IncludeExtra: s.ShowExtra})
 	if err != nil {
 		return err
 	}
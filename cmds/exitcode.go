@@ -0,0 +1,35 @@
+package cmds
+
+import (
+	"errors"
+
+	"github.com/go-go-golems/vault-envrc-generator/pkg/vault"
+)
+
+// Exit codes returned by the CLI so scripts can tell Vault failures apart
+const (
+	ExitOK               = 0
+	ExitError            = 1
+	ExitNotFound         = 3
+	ExitPermissionDenied = 4
+	ExitSealed           = 5
+	ExitVersionConflict  = 6
+)
+
+// ExitCode maps an error returned by a command to the process exit code.
+func ExitCode(err error) int {
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.Is(err, vault.ErrNotFound):
+		return ExitNotFound
+	case errors.Is(err, vault.ErrPermissionDenied):
+		return ExitPermissionDenied
+	case errors.Is(err, vault.ErrSealed):
+		return ExitSealed
+	case errors.Is(err, vault.ErrVersionConflict):
+		return ExitVersionConflict
+	default:
+		return ExitError
+	}
+}
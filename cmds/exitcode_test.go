@@ -0,0 +1,40 @@
+package cmds
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-go-golems/vault-envrc-generator/pkg/vault"
+	"github.com/go-go-golems/vault-envrc-generator/pkg/vaulttest"
+)
+
+func TestExitCode(t *testing.T) {
+	srv := vaulttest.NewServer(t)
+	srv.Put("secret/app/db", map[string]interface{}{"password": "v1"})
+	srv.Deny("secret/data/prod/")
+	client := srv.Client()
+	ctx := context.Background()
+
+	_, err := client.GetSecrets(ctx, "secret/app/missing")
+	require.ErrorIs(t, err, vault.ErrNotFound)
+	require.Equal(t, ExitNotFound, ExitCode(err))
+
+	_, err = client.GetSecrets(ctx, "secret/prod/db")
+	require.ErrorIs(t, err, vault.ErrPermissionDenied)
+	require.Equal(t, ExitPermissionDenied, ExitCode(err))
+
+	err = client.PutSecretsCAS(ctx, "secret/app/db", map[string]interface{}{"password": "v2"}, 0)
+	require.ErrorIs(t, err, vault.ErrVersionConflict)
+	require.Equal(t, ExitVersionConflict, ExitCode(err))
+
+	srv.SetSealed(true)
+	_, err = client.GetSecrets(ctx, "secret/app/db")
+	require.ErrorIs(t, err, vault.ErrSealed)
+	require.Equal(t, ExitSealed, ExitCode(err))
+
+	require.Equal(t, ExitOK, ExitCode(nil))
+	require.Equal(t, ExitError, ExitCode(errors.New("boom")))
+}
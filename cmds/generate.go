@@ -3,6 +3,8 @@ package cmds
 import (
 	"context"
 	"fmt"
+	"path"
+	"strings"
 	"time"
 
 	glzcli "github.com/go-go-golems/glazed/pkg/cli"
@@ -30,6 +32,13 @@ type GenerateSettings struct {
 	Format        string   `glazed:"format"`
 	Output        string   `glazed:"output"`
 	SortKeys      bool     `glazed:"sort-keys"`
+	Quoting       string   `glazed:"quoting"`
+	K8sName       string   `glazed:"k8s-name"`
+	K8sNamespace  string   `glazed:"k8s-namespace"`
+	IniSection    string   `glazed:"ini-section"`
+	FileEnvrc     string   `glazed:"file-envrc"`
+	FileMode      string   `glazed:"file-mode"`
+	Backup        bool     `glazed:"backup"`
 }
 
 func NewGenerateCommand() (*GenerateCommand, error) {
@@ -41,16 +50,23 @@ func NewGenerateCommand() (*GenerateCommand, error) {
 		"generate",
 		gcmds.WithShort("Generate .envrc/json/yaml from a single Vault path"),
 		gcmds.WithFlags(
-			fields.New("path", fields.TypeString, fields.WithRequired(true), fields.WithShortFlag("p"), fields.WithHelp("Vault path")),
+			fields.New("path", fields.TypeString, fields.WithRequired(true), fields.WithShortFlag("p"), fields.WithHelp("Vault path; append @N (e.g. app/db@3) to read KV v2 version N")),
 			fields.New("template", fields.TypeString, fields.WithHelp("Custom template file")),
 			fields.New("prefix", fields.TypeString, fields.WithHelp("Prefix to add to keys")),
 			fields.New("exclude", fields.TypeStringList, fields.WithHelp("Keys to exclude")),
 			fields.New("include", fields.TypeStringList, fields.WithHelp("Keys to include (overrides exclude)")),
 			fields.New("transform-keys", fields.TypeBool, fields.WithDefault(false), fields.WithHelp("Transform keys to UPPER and '-' to '_'")),
 			fields.New("dry-run", fields.TypeBool, fields.WithDefault(false), fields.WithHelp("Print to stdout instead of writing")),
-			fields.New("format", fields.TypeChoice, fields.WithChoices("envrc", "json", "yaml"), fields.WithDefault("envrc"), fields.WithHelp("Output format")),
+			fields.New("format", fields.TypeChoice, fields.WithChoices(envrc.FormatNames()...), fields.WithDefault(envrc.DefaultFormat), fields.WithHelp("Output format")),
 			fields.New("output", fields.TypeString, fields.WithDefault("-"), fields.WithHelp("Output path or '-' for stdout")),
 			fields.New("sort-keys", fields.TypeBool, fields.WithDefault(false), fields.WithHelp("Sort keys in JSON/YAML")),
+			fields.New("quoting", fields.TypeChoice, fields.WithChoices(envrc.QuotingSafe, envrc.QuotingRaw), fields.WithDefault(envrc.QuotingSafe), fields.WithHelp("envrc value quoting: safe keeps values literal, raw lets the shell expand $ and backticks")),
+			fields.New("k8s-name", fields.TypeString, fields.WithHelp("Manifest name for the k8s formats (default: derived from the last path segment)")),
+			fields.New("k8s-namespace", fields.TypeString, fields.WithHelp("Manifest namespace for the k8s formats")),
+			fields.New("ini-section", fields.TypeString, fields.WithHelp("Section for the ini format (default: top-level keys)")),
+			fields.New("file-envrc", fields.TypeString, fields.WithHelp("With --format dir, also write an envrc exporting KEY_FILE for each file to this path")),
+			fields.New("file-mode", fields.TypeString, fields.WithDefault("0600"), fields.WithHelp("Octal permissions of written files")),
+			fields.New("backup", fields.TypeBool, fields.WithDefault(false), fields.WithHelp("Keep the previous content of a replaced output file in <output>.bak")),
 		),
 		gcmds.WithSections(section),
 	)
@@ -73,16 +89,18 @@ func (c *GenerateCommand) Run(ctx context.Context, parsed *values.Values) error
 
 	ctx2, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
-	token, err := vault.ResolveToken(ctx2, vs.VaultToken, vault.TokenSource(vs.VaultTokenSource), vs.VaultTokenFile, false)
+	token, err := vault.ResolveToken(ctx2, vs.TokenOptions())
 	if err != nil {
 		return fmt.Errorf("failed to resolve Vault token: %w", err)
 	}
-	client, err := vault.NewClient(vs.VaultAddr, token)
+	client, err := vault.NewClient(ctx, vs.ClientConfig(), token)
 	if err != nil {
 		return fmt.Errorf("failed to create Vault client: %w", err)
 	}
+	stopTokenWatch := client.WatchToken(ctx, vs.TokenWatchOptions())
+	defer stopTokenWatch()
 
-	secrets, err := client.GetSecrets(s.Path)
+	secrets, err := vault.GetSecretsRef(ctx, client, s.Path)
 	if err != nil {
 		return fmt.Errorf("failed to retrieve secrets: %w", err)
 	}
@@ -96,20 +114,63 @@ func (c *GenerateCommand) Run(ctx context.Context, parsed *values.Values) error
 		TemplateFile:  s.TemplateFile,
 		Verbose:       false,
 		SortKeys:      s.SortKeys,
+		Quoting:       s.Quoting,
+		Section:       s.IniSection,
+		Kubernetes:    &envrc.KubernetesOptions{Name: k8sName(s.K8sName, s.Path), Namespace: s.K8sNamespace},
 	})
 	content, err := gen.Generate(secrets)
 	if err != nil {
 		return err
 	}
 
+	var exports string
+	if s.FileEnvrc != "" {
+		if f, _ := envrc.LookupFormatter(s.Format); !isFileSet(f) || s.Output == "-" {
+			return fmt.Errorf("--file-envrc needs --format dir and an --output directory")
+		}
+		exports, err = envrc.FileExports(s.Output, content, envrc.FormatOptions{})
+		if err != nil {
+			return err
+		}
+	}
+
 	if s.DryRun || s.Output == "-" {
 		fmt.Print(content)
-		if s.Format == "envrc" {
+		if s.Format == envrc.DefaultFormat {
 			fmt.Print("\n")
 		}
+		fmt.Print(exports)
 		return nil
 	}
-	return output.Write(s.Output, []byte(content), output.WriteOptions{Format: s.Format, SortKeys: s.SortKeys})
+	mode, err := output.ParseFileMode(s.FileMode)
+	if err != nil {
+		return err
+	}
+	wopts := output.WriteOptions{Format: s.Format, SortKeys: s.SortKeys, Mode: mode, Backup: s.Backup}
+	if err := output.Write(s.Output, []byte(content), wopts); err != nil {
+		return err
+	}
+	if exports != "" {
+		wopts.Format = envrc.DefaultFormat
+		return output.Write(s.FileEnvrc, []byte(exports), wopts)
+	}
+	return nil
+}
+
+func isFileSet(f envrc.Formatter) bool {
+	_, ok := f.(envrc.FileSet)
+	return ok
+}
+
+// k8sName returns name, or a manifest name derived from the last segment of the Vault path
+func k8sName(name, vaultPath string) string {
+	if name != "" {
+		return name
+	}
+	if p, _, err := vault.SplitPathVersion(vaultPath); err == nil {
+		vaultPath = p
+	}
+	return envrc.KubernetesName(path.Base(strings.TrimRight(vaultPath, "/")))
 }
 
 var _ gcmds.BareCommand = &GenerateCommand{}
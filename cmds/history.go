@@ -0,0 +1,229 @@
+package cmds
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	glzcli "github.com/go-go-golems/glazed/pkg/cli"
+	gcmds "github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/fields"
+	"github.com/go-go-golems/glazed/pkg/cmds/schema"
+	"github.com/go-go-golems/glazed/pkg/cmds/values"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/settings"
+	"github.com/go-go-golems/glazed/pkg/types"
+
+	"github.com/go-go-golems/vault-envrc-generator/pkg/listing"
+	"github.com/go-go-golems/vault-envrc-generator/pkg/vault"
+	"github.com/go-go-golems/vault-envrc-generator/pkg/vaultlayer"
+)
+
+type HistoryCommand struct{ *gcmds.CommandDescription }
+
+type HistorySettings struct {
+	Path         string `glazed:"path"`
+	Depth        int    `glazed:"depth"`
+	Limit        int    `glazed:"limit"`
+	Reveal       bool   `glazed:"reveal-values"`
+	CensorPrefix int    `glazed:"censor-prefix"`
+	CensorSuffix int    `glazed:"censor-suffix"`
+}
+
+func NewHistoryCommand() (*HistoryCommand, error) {
+	glazedSection, err := settings.NewGlazedSection()
+	if err != nil {
+		return nil, err
+	}
+	commandSection, err := glzcli.NewCommandSettingsSection()
+	if err != nil {
+		return nil, err
+	}
+
+	cd := gcmds.NewCommandDescription(
+		"history",
+		gcmds.WithShort("Show per-key changes between KV v2 versions of a secret or subtree"),
+		gcmds.WithFlags(
+			fields.New("path", fields.TypeString, fields.WithRequired(true), fields.WithShortFlag("p"), fields.WithHelp("Vault secret path or subtree root")),
+			fields.New("depth", fields.TypeInteger, fields.WithDefault(0), fields.WithHelp("Maximum recursion depth when path is a subtree (0 = unlimited)")),
+			fields.New("limit", fields.TypeInteger, fields.WithDefault(0), fields.WithHelp("Only show the most recent N versions per secret (0 = all)")),
+			fields.New("reveal-values", fields.TypeBool, fields.WithDefault(false), fields.WithHelp("Show full values instead of censored previews")),
+			fields.New("censor-prefix", fields.TypeInteger, fields.WithDefault(2), fields.WithHelp("Visible characters at the start of censored values")),
+			fields.New("censor-suffix", fields.TypeInteger, fields.WithDefault(2), fields.WithHelp("Visible characters at the end of censored values")),
+		),
+		gcmds.WithSections(glazedSection, commandSection),
+	)
+
+	_, err = vaultlayer.AddVaultSectionToCommand(cd)
+	if err != nil {
+		return nil, err
+	}
+
+	return &HistoryCommand{cd}, nil
+}
+
+func (c *HistoryCommand) RunIntoGlazeProcessor(ctx context.Context, parsed *values.Values, gp middlewares.Processor) error {
+	s := &HistorySettings{}
+	if err := parsed.DecodeSectionInto(schema.DefaultSlug, s); err != nil {
+		return err
+	}
+	vs, err := vaultlayer.GetVaultSettings(parsed)
+	if err != nil {
+		return err
+	}
+
+	ctx2, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+	token, err := vault.ResolveToken(ctx2, vs.TokenOptions())
+	if err != nil {
+		return fmt.Errorf("failed to resolve Vault token: %w", err)
+	}
+	client, err := vault.NewClient(ctx, vs.ClientConfig(), token)
+	if err != nil {
+		return fmt.Errorf("failed to create Vault client: %w", err)
+	}
+	stopTokenWatch := client.WatchToken(ctx, vs.TokenWatchOptions())
+	defer stopTokenWatch()
+
+	entries, warns := listing.NewEngine(client, vs.TraversalOptions(s.Depth)).Walk(ctx, s.Path)
+	for _, w := range warns {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", w.Error())
+	}
+
+	censor := func(v interface{}) string {
+		str := fmt.Sprintf("%v", v)
+		if s.Reveal {
+			return str
+		}
+		return censorString(str, s.CensorPrefix, s.CensorSuffix)
+	}
+
+	for _, entry := range entries {
+		if strings.HasSuffix(entry, "/") {
+			continue
+		}
+
+		meta, err := client.GetSecretMetadata(ctx, entry)
+		if err != nil {
+			row := types.NewRow(
+				types.MRP("path", entry),
+				types.MRP("change", "error"),
+				types.MRP("error", err.Error()),
+			)
+			if err := gp.AddRow(ctx, row); err != nil {
+				return err
+			}
+			continue
+		}
+
+		versions := meta.VersionNumbers()
+
+		// Versions before the display window are still read so the first shown version has a baseline
+		firstShown := 0
+		if s.Limit > 0 && len(versions) > s.Limit {
+			firstShown = len(versions) - s.Limit
+		}
+
+		var previous map[string]interface{}
+		for idx, v := range versions {
+			vm := meta.Versions[v]
+			show := idx >= firstShown
+			base := []types.MapRowPair{
+				types.MRP("path", entry),
+				types.MRP("version", v),
+			}
+			base = append(base, versionTimestamps(vm)...)
+
+			if !vm.IsReadable() {
+				if show {
+					change := "deleted"
+					if vm.Destroyed {
+						change = "destroyed"
+					}
+					row := types.NewRow(append(base, types.MRP("change", change))...)
+					if err := gp.AddRow(ctx, row); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+
+			data, err := client.GetSecretsVersion(ctx, entry, v)
+			if err != nil {
+				if show {
+					row := types.NewRow(append(base, types.MRP("change", "error"), types.MRP("error", err.Error()))...)
+					if err := gp.AddRow(ctx, row); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+
+			if show {
+				for _, ch := range diffVersions(previous, data) {
+					params := append([]types.MapRowPair{}, base...)
+					params = append(params, types.MRP("change", ch.change), types.MRP("key", ch.key))
+					if ch.hasOld {
+						params = append(params, types.MRP("old_value", censor(ch.old)))
+					}
+					if ch.hasNew {
+						params = append(params, types.MRP("new_value", censor(ch.new)))
+					}
+					if err := gp.AddRow(ctx, types.NewRow(params...)); err != nil {
+						return err
+					}
+				}
+			}
+			previous = data
+		}
+	}
+
+	return nil
+}
+
+type keyChange struct {
+	key            string
+	change         string
+	old, new       interface{}
+	hasOld, hasNew bool
+}
+
+// diffVersions lists added, removed and changed keys between two versions, sorted by key
+func diffVersions(prev, next map[string]interface{}) []keyChange {
+	var changes []keyChange
+	for k, nv := range next {
+		ov, ok := prev[k]
+		switch {
+		case !ok:
+			changes = append(changes, keyChange{key: k, change: "added", new: nv, hasNew: true})
+		case fmt.Sprintf("%v", ov) != fmt.Sprintf("%v", nv):
+			changes = append(changes, keyChange{key: k, change: "changed", old: ov, new: nv, hasOld: true, hasNew: true})
+		}
+	}
+	for k, ov := range prev {
+		if _, ok := next[k]; !ok {
+			changes = append(changes, keyChange{key: k, change: "removed", old: ov, hasOld: true})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].key < changes[j].key })
+	return changes
+}
+
+func versionTimestamps(vm vault.SecretVersionMetadata) []types.MapRowPair {
+	var params []types.MapRowPair
+	if vm.CreatedTime != nil {
+		params = append(params, types.MRP("created_time", vm.CreatedTime.UTC().Format(time.RFC3339)))
+	}
+	if vm.DeletionTime != nil && !vm.DeletionTime.IsZero() {
+		params = append(params, types.MRP("deletion_time", vm.DeletionTime.UTC().Format(time.RFC3339)))
+	}
+	if vm.Destroyed {
+		params = append(params, types.MRP("destroyed", true))
+	}
+	return params
+}
+
+var _ gcmds.GlazeCommand = &HistoryCommand{}
@@ -69,16 +69,18 @@ func (c *InteractiveCommand) Run(ctx context.Context, parsed *values.Values) err
 
 	ctx2, cancel := context.WithTimeout(ctx, 15*time.Second)
 	defer cancel()
-	token, err := vault.ResolveToken(ctx2, vs.VaultToken, vault.TokenSource(vs.VaultTokenSource), vs.VaultTokenFile, false)
+	token, err := vault.ResolveToken(ctx2, vs.TokenOptions())
 	if err != nil {
 		return fmt.Errorf("failed to resolve Vault token: %w", err)
 	}
-	client, err := vault.NewClient(vs.VaultAddr, token)
+	client, err := vault.NewClient(ctx, vs.ClientConfig(), token)
 	if err != nil {
 		return fmt.Errorf("failed to create Vault client: %w", err)
 	}
+	stopTokenWatch := client.WatchToken(ctx, vs.TokenWatchOptions())
+	defer stopTokenWatch()
 
-	secrets, err := client.GetSecrets(s.Path)
+	secrets, err := client.GetSecrets(ctx, s.Path)
 	if err != nil {
 		return fmt.Errorf("failed to read secrets: %w", err)
 	}
@@ -105,12 +107,13 @@ func (c *InteractiveCommand) Run(ctx context.Context, parsed *values.Values) err
 	fmt.Print("Transform keys to UPPER and '_'? (y/N): ")
 	trS, _ := reader.ReadString('\n')
 	transform := strings.HasPrefix(strings.ToLower(strings.TrimSpace(trS)), "y")
-	fmt.Print("Format [envrc|json|yaml] (default envrc): ")
+	fmt.Printf("Format [%s] (default %s): ", strings.Join(envrc.FormatNames(), "|"), envrc.DefaultFormat)
 	fmtS, _ := reader.ReadString('\n')
-	format := strings.TrimSpace(fmtS)
-	if format == "" {
-		format = "envrc"
+	formatter, err := envrc.LookupFormatter(strings.TrimSpace(fmtS))
+	if err != nil {
+		return err
 	}
+	format := formatter.Name()
 
 	gen := envrc.NewGenerator(&envrc.Options{
 		Prefix:        pref,
@@ -121,6 +124,7 @@ func (c *InteractiveCommand) Run(ctx context.Context, parsed *values.Values) err
 		TemplateFile:  "",
 		Verbose:       false,
 		SortKeys:      true,
+		Kubernetes:    &envrc.KubernetesOptions{Name: k8sName("", s.Path)},
 	})
 	content, err := gen.Generate(secrets)
 	if err != nil {
@@ -76,23 +76,35 @@ func (c *ListCommand) RunIntoGlazeProcessor(ctx context.Context, parsed *values.
 
 	ctx2, cancel := context.WithTimeout(ctx, 15*time.Second)
 	defer cancel()
-	token, err := vault.ResolveToken(ctx2, vs.VaultToken, vault.TokenSource(vs.VaultTokenSource), vs.VaultTokenFile, false)
+	token, err := vault.ResolveToken(ctx2, vs.TokenOptions())
 	if err != nil {
 		return fmt.Errorf("failed to resolve Vault token: %w", err)
 	}
-	client, err := vault.NewClient(vs.VaultAddr, token)
+	client, err := vault.NewClient(ctx, vs.ClientConfig(), token)
 	if err != nil {
 		return fmt.Errorf("failed to create Vault client: %w", err)
 	}
+	stopTokenWatch := client.WatchToken(ctx, vs.TokenWatchOptions())
+	defer stopTokenWatch()
 
-	entries, warns := listing.Walk(client, s.Path, s.Depth)
-	for _, e := range entries {
+	opts := vs.TraversalOptions(s.Depth)
+	opts.ReadSecrets = true
+	opts.ListBoundaryDirs = true
+	var warns []error
+	err = listing.NewEngine(client, opts).Traverse(ctx, s.Path, func(n listing.Node) error {
+		if n.Dir && n.Err != nil {
+			warns = append(warns, fmt.Errorf("%s: %w", n.Path, n.Err))
+		}
+		if n.Depth == 0 && n.Dir {
+			return nil
+		}
+		e := n.Path
 		if s.Prefix != "" && !strings.HasPrefix(e, s.Prefix) {
-			continue
+			return nil
 		}
-		if strings.HasSuffix(e, "/") {
-			childKeys, err := client.ListSecrets(e)
-			if err != nil {
+		if n.Dir {
+			childKeys := n.Children
+			if childKeys == nil {
 				childKeys = []string{}
 			}
 			row := types.NewRow(
@@ -100,43 +112,43 @@ func (c *ListCommand) RunIntoGlazeProcessor(ctx context.Context, parsed *values.
 				types.MRP("type", "directory"),
 				types.MRP("children", childKeys),
 			)
-			if err := gp.AddRow(ctx, row); err != nil {
-				return err
-			}
-		} else {
-			data, err := client.GetSecrets(e)
-			if err != nil {
-				data = map[string]interface{}{}
-			}
-			if s.IncludeValues {
-				m := make(map[string]string, len(data))
-				for k := range data {
-					m[k] = s.Censor
-				}
-				row := types.NewRow(
-					types.MRP("path", e),
-					types.MRP("type", "secret"),
-					types.MRP("data", m),
-				)
-				if err := gp.AddRow(ctx, row); err != nil {
-					return err
-				}
-			} else {
-				ks := make([]string, 0, len(data))
-				for k := range data {
-					ks = append(ks, k)
-				}
-				sort.Strings(ks)
-				row := types.NewRow(
-					types.MRP("path", e),
-					types.MRP("type", "secret"),
-					types.MRP("keys", ks),
-				)
-				if err := gp.AddRow(ctx, row); err != nil {
-					return err
-				}
+			return gp.AddRow(ctx, row)
+		}
+
+		data := n.Data
+		status := "active"
+		if n.Err != nil {
+			data = map[string]interface{}{}
+			status = secretStatus(ctx, client, e)
+		}
+		if s.IncludeValues {
+			m := make(map[string]string, len(data))
+			for k := range data {
+				m[k] = s.Censor
 			}
+			row := types.NewRow(
+				types.MRP("path", e),
+				types.MRP("type", "secret"),
+				types.MRP("status", status),
+				types.MRP("data", m),
+			)
+			return gp.AddRow(ctx, row)
+		}
+		ks := make([]string, 0, len(data))
+		for k := range data {
+			ks = append(ks, k)
 		}
+		sort.Strings(ks)
+		row := types.NewRow(
+			types.MRP("path", e),
+			types.MRP("type", "secret"),
+			types.MRP("status", status),
+			types.MRP("keys", ks),
+		)
+		return gp.AddRow(ctx, row)
+	})
+	if err != nil {
+		return err
 	}
 	if len(warns) > 0 {
 		fmt.Fprintf(os.Stderr, "Warnings (%d) encountered during listing.\n", len(warns))
@@ -162,4 +174,17 @@ func (c *ListCommand) RunIntoGlazeProcessor(ctx context.Context, parsed *values.
 	return nil
 }
 
+// secretStatus explains why a listed secret could not be read: its latest KV v2 version is
+// soft-deleted or destroyed, or the read failed for another reason.
+func secretStatus(ctx context.Context, client vault.SecretStore, path string) string {
+	meta, err := client.GetSecretMetadata(ctx, path)
+	if err != nil {
+		return "unreadable"
+	}
+	if status := meta.Status(); status != "active" {
+		return status
+	}
+	return "unreadable"
+}
+
 var _ gcmds.GlazeCommand = &ListCommand{}
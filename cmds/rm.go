@@ -0,0 +1,99 @@
+package cmds
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	glzcli "github.com/go-go-golems/glazed/pkg/cli"
+	gcmds "github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/fields"
+	"github.com/go-go-golems/glazed/pkg/cmds/schema"
+	"github.com/go-go-golems/glazed/pkg/cmds/values"
+
+	"github.com/go-go-golems/vault-envrc-generator/pkg/vault"
+	"github.com/go-go-golems/vault-envrc-generator/pkg/vaultlayer"
+)
+
+type RmCommand struct{ *gcmds.CommandDescription }
+
+type RmSettings struct {
+	Path     string `glazed:"path"`
+	Mode     string `glazed:"mode"`
+	Versions []int  `glazed:"versions"`
+	Yes      bool   `glazed:"yes"`
+}
+
+func NewRmCommand() (*RmCommand, error) {
+	section, err := glzcli.NewCommandSettingsSection()
+	if err != nil {
+		return nil, err
+	}
+	cd := gcmds.NewCommandDescription(
+		"rm",
+		gcmds.WithShort("Delete a single Vault secret (soft delete, destroy versions or remove metadata)"),
+		gcmds.WithFlags(
+			fields.New("path", fields.TypeString, fields.WithRequired(true), fields.WithShortFlag("p"), fields.WithHelp("Vault secret path to delete")),
+			fields.New("mode", fields.TypeChoice, fields.WithChoices("soft", "destroy", "metadata"), fields.WithDefault("soft"), fields.WithHelp("soft: soft-delete versions (KV v2, recoverable with undelete); destroy: permanently destroy version data; metadata: remove all versions and metadata")),
+			fields.New("versions", fields.TypeIntegerList, fields.WithHelp("KV v2 versions to soft-delete or destroy (default: latest for soft, all for destroy)")),
+			fields.New("yes", fields.TypeBool, fields.WithDefault(false), fields.WithHelp("Skip confirmation prompt and delete immediately")),
+		),
+		gcmds.WithSections(section),
+	)
+	_, err = vaultlayer.AddVaultSectionToCommand(cd)
+	if err != nil {
+		return nil, err
+	}
+	return &RmCommand{cd}, nil
+}
+
+func (c *RmCommand) Run(ctx context.Context, parsed *values.Values) error {
+	s := &RmSettings{}
+	if err := parsed.DecodeSectionInto(schema.DefaultSlug, s); err != nil {
+		return err
+	}
+	mode, err := vault.ParseDeleteMode(s.Mode)
+	if err != nil {
+		return err
+	}
+	if mode == vault.DeleteModeMetadata && len(s.Versions) > 0 {
+		return fmt.Errorf("--versions cannot be combined with --mode metadata")
+	}
+	vs, err := vaultlayer.GetVaultSettings(parsed)
+	if err != nil {
+		return err
+	}
+
+	ctx2, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+	token, err := vault.ResolveToken(ctx2, vs.TokenOptions())
+	if err != nil {
+		return fmt.Errorf("failed to resolve Vault token: %w", err)
+	}
+	client, err := vault.NewClient(ctx, vs.ClientConfig(), token)
+	if err != nil {
+		return fmt.Errorf("failed to create Vault client: %w", err)
+	}
+	stopTokenWatch := client.WatchToken(ctx, vs.TokenWatchOptions())
+	defer stopTokenWatch()
+
+	if !s.Yes {
+		target := fmt.Sprintf("'%s'", s.Path)
+		if len(s.Versions) > 0 {
+			target = fmt.Sprintf("versions %v of '%s'", s.Versions, s.Path)
+		}
+		if !askForConfirmation(fmt.Sprintf("%s %s? [y/N]: ", deleteModeVerb(mode), target)) {
+			fmt.Fprintln(os.Stderr, "aborted")
+			return nil
+		}
+	}
+
+	if err := client.DeleteSecretWithMode(ctx, s.Path, mode, s.Versions); err != nil {
+		return fmt.Errorf("failed to delete %s: %w", s.Path, err)
+	}
+	fmt.Fprintf(os.Stdout, "deleted %s (mode: %s)\n", s.Path, mode)
+	return nil
+}
+
+var _ gcmds.BareCommand = &RmCommand{}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	glzcli "github.com/go-go-golems/glazed/pkg/cli"
@@ -34,9 +35,11 @@ func askForConfirmation(prompt string) bool {
 type RmTreeCommand struct{ *gcmds.CommandDescription }
 
 type RmTreeSettings struct {
-	Path  string `glazed:"path"`
-	Depth int    `glazed:"depth"`
-	Yes   bool   `glazed:"yes"`
+	Path     string `glazed:"path"`
+	Depth    int    `glazed:"depth"`
+	Mode     string `glazed:"mode"`
+	Versions []int  `glazed:"versions"`
+	Yes      bool   `glazed:"yes"`
 }
 
 func NewRmTreeCommand() (*RmTreeCommand, error) {
@@ -50,6 +53,8 @@ func NewRmTreeCommand() (*RmTreeCommand, error) {
 		gcmds.WithFlags(
 			fields.New("path", fields.TypeString, fields.WithRequired(true), fields.WithShortFlag("p"), fields.WithHelp("Root Vault path to delete")),
 			fields.New("depth", fields.TypeInteger, fields.WithDefault(0), fields.WithHelp("Max depth to scan before delete (0 = unlimited)")),
+			fields.New("mode", fields.TypeChoice, fields.WithChoices("soft", "destroy", "metadata"), fields.WithDefault("soft"), fields.WithHelp("soft: soft-delete versions (KV v2, recoverable with undelete); destroy: permanently destroy version data; metadata: remove all versions and metadata")),
+			fields.New("versions", fields.TypeIntegerList, fields.WithHelp("KV v2 versions to soft-delete or destroy (default: latest for soft, all for destroy)")),
 			fields.New("yes", fields.TypeBool, fields.WithDefault(false), fields.WithHelp("Skip confirmation prompt and delete immediately")),
 		),
 		gcmds.WithSections(section),
@@ -66,6 +71,13 @@ func (c *RmTreeCommand) Run(ctx context.Context, parsed *values.Values) error {
 	if err := parsed.DecodeSectionInto(schema.DefaultSlug, s); err != nil {
 		return err
 	}
+	mode, err := vault.ParseDeleteMode(s.Mode)
+	if err != nil {
+		return err
+	}
+	if mode == vault.DeleteModeMetadata && len(s.Versions) > 0 {
+		return fmt.Errorf("--versions cannot be combined with --mode metadata")
+	}
 	vs, err := vaultlayer.GetVaultSettings(parsed)
 	if err != nil {
 		return err
@@ -73,17 +85,20 @@ func (c *RmTreeCommand) Run(ctx context.Context, parsed *values.Values) error {
 
 	ctx2, cancel := context.WithTimeout(ctx, 60*time.Second)
 	defer cancel()
-	token, err := vault.ResolveToken(ctx2, vs.VaultToken, vault.TokenSource(vs.VaultTokenSource), vs.VaultTokenFile, false)
+	token, err := vault.ResolveToken(ctx2, vs.TokenOptions())
 	if err != nil {
 		return fmt.Errorf("failed to resolve Vault token: %w", err)
 	}
-	client, err := vault.NewClient(vs.VaultAddr, token)
+	client, err := vault.NewClient(ctx, vs.ClientConfig(), token)
 	if err != nil {
 		return fmt.Errorf("failed to create Vault client: %w", err)
 	}
+	stopTokenWatch := client.WatchToken(ctx, vs.TokenWatchOptions())
+	defer stopTokenWatch()
 
 	// Print the tree (list of paths)
-	keys, errs := listing.Walk(client, s.Path, s.Depth)
+	engine := listing.NewEngine(client, vs.TraversalOptions(s.Depth))
+	keys, errs := engine.Walk(ctx, s.Path)
 	out := map[string]interface{}{"paths": keys}
 	enc := yaml.NewEncoder(os.Stdout)
 	enc.SetIndent(2)
@@ -98,26 +113,42 @@ func (c *RmTreeCommand) Run(ctx context.Context, parsed *values.Values) error {
 	}
 
 	if !s.Yes {
-		if !askForConfirmation(fmt.Sprintf("Delete %d secrets under '%s'? [y/N]: ", len(keys), s.Path)) {
+		if !askForConfirmation(fmt.Sprintf("%s %d secrets under '%s'? [y/N]: ", deleteModeVerb(mode), len(keys), s.Path)) {
 			fmt.Fprintln(os.Stderr, "aborted")
 			return nil
 		}
 	}
 
 	// Delete leaf secrets (skip directories)
-	deleted := 0
+	var leaves []string
 	for _, p := range keys {
-		if strings.HasSuffix(p, "/") {
-			continue
+		if !strings.HasSuffix(p, "/") {
+			leaves = append(leaves, p)
 		}
-		if err := client.DeleteSecret(p); err != nil {
+	}
+	var deleted atomic.Int64
+	err = engine.ForEach(ctx, leaves, func(ctx context.Context, p string) error {
+		if err := client.DeleteSecretWithMode(ctx, p, mode, s.Versions); err != nil {
 			fmt.Fprintf(os.Stderr, "failed to delete %s: %v\n", p, err)
-		} else {
-			deleted++
+			return nil
 		}
+		deleted.Add(1)
+		return nil
+	})
+	fmt.Fprintf(os.Stdout, "deleted %d secrets (mode: %s)\n", deleted.Load(), mode)
+	return err
+}
+
+// deleteModeVerb describes a delete mode in confirmation prompts
+func deleteModeVerb(mode vault.DeleteMode) string {
+	switch mode {
+	case vault.DeleteModeDestroy:
+		return "Permanently destroy versions of"
+	case vault.DeleteModeMetadata:
+		return "Permanently delete all versions and metadata of"
+	default:
+		return "Delete"
 	}
-	fmt.Fprintf(os.Stdout, "deleted %d secrets\n", deleted)
-	return nil
 }
 
 var _ gcmds.BareCommand = &RmTreeCommand{}
@@ -0,0 +1,209 @@
+package cmds
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	glzcli "github.com/go-go-golems/glazed/pkg/cli"
+	gcmds "github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/fields"
+	"github.com/go-go-golems/glazed/pkg/cmds/schema"
+	"github.com/go-go-golems/glazed/pkg/cmds/values"
+
+	"github.com/go-go-golems/vault-envrc-generator/pkg/listing"
+	"github.com/go-go-golems/vault-envrc-generator/pkg/vault"
+	"github.com/go-go-golems/vault-envrc-generator/pkg/vaultlayer"
+)
+
+type RollbackCommand struct{ *gcmds.CommandDescription }
+
+type RollbackSettings struct {
+	Path         string `glazed:"path"`
+	Depth        int    `glazed:"depth"`
+	Version      int    `glazed:"version"`
+	At           string `glazed:"at"`
+	Yes          bool   `glazed:"yes"`
+	Reveal       bool   `glazed:"reveal-values"`
+	CensorPrefix int    `glazed:"censor-prefix"`
+	CensorSuffix int    `glazed:"censor-suffix"`
+}
+
+func NewRollbackCommand() (*RollbackCommand, error) {
+	section, err := glzcli.NewCommandSettingsSection()
+	if err != nil {
+		return nil, err
+	}
+	cd := gcmds.NewCommandDescription(
+		"rollback",
+		gcmds.WithShort("Restore a previous KV v2 version of a secret or every secret under a tree"),
+		gcmds.WithFlags(
+			fields.New("path", fields.TypeString, fields.WithRequired(true), fields.WithShortFlag("p"), fields.WithHelp("Vault secret path or tree root")),
+			fields.New("depth", fields.TypeInteger, fields.WithDefault(0), fields.WithHelp("Max depth to scan when path is a tree (0 = unlimited)")),
+			fields.New("version", fields.TypeInteger, fields.WithDefault(0), fields.WithHelp("Version to restore")),
+			fields.New("at", fields.TypeString, fields.WithHelp("Restore the version that was current at this time (RFC3339, e.g. 2025-09-15T10:00:00Z)")),
+			fields.New("yes", fields.TypeBool, fields.WithDefault(false), fields.WithHelp("Skip confirmation prompt and restore immediately")),
+			fields.New("reveal-values", fields.TypeBool, fields.WithDefault(false), fields.WithHelp("Reveal real values in the diff instead of censored")),
+			fields.New("censor-prefix", fields.TypeInteger, fields.WithDefault(2), fields.WithHelp("Visible characters at start of value when censored")),
+			fields.New("censor-suffix", fields.TypeInteger, fields.WithDefault(2), fields.WithHelp("Visible characters at end of value when censored")),
+		),
+		gcmds.WithSections(section),
+	)
+	_, err = vaultlayer.AddVaultSectionToCommand(cd)
+	if err != nil {
+		return nil, err
+	}
+	return &RollbackCommand{cd}, nil
+}
+
+// rollbackPlan describes how one secret will be restored
+type rollbackPlan struct {
+	path           string
+	currentVersion int
+	targetVersion  int
+	restore        map[string]interface{}
+	changes        []keyChange
+}
+
+func (c *RollbackCommand) Run(ctx context.Context, parsed *values.Values) error {
+	s := &RollbackSettings{}
+	if err := parsed.DecodeSectionInto(schema.DefaultSlug, s); err != nil {
+		return err
+	}
+	if (s.Version > 0) == (s.At != "") {
+		return fmt.Errorf("exactly one of --version or --at must be provided")
+	}
+	var at time.Time
+	if s.At != "" {
+		t, err := time.Parse(time.RFC3339, s.At)
+		if err != nil {
+			return fmt.Errorf("invalid --at timestamp %q: %w", s.At, err)
+		}
+		at = t
+	}
+
+	vs, err := vaultlayer.GetVaultSettings(parsed)
+	if err != nil {
+		return err
+	}
+
+	ctx2, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+	token, err := vault.ResolveToken(ctx2, vs.TokenOptions())
+	if err != nil {
+		return fmt.Errorf("failed to resolve Vault token: %w", err)
+	}
+	client, err := vault.NewClient(ctx, vs.ClientConfig(), token)
+	if err != nil {
+		return fmt.Errorf("failed to create Vault client: %w", err)
+	}
+	stopTokenWatch := client.WatchToken(ctx, vs.TokenWatchOptions())
+	defer stopTokenWatch()
+
+	keys, errs := listing.NewEngine(client, vs.TraversalOptions(s.Depth)).Walk(ctx, s.Path)
+	for _, e := range errs {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", e)
+	}
+
+	censor := func(v interface{}) string {
+		str := fmt.Sprintf("%v", v)
+		if s.Reveal {
+			return str
+		}
+		return censorString(str, s.CensorPrefix, s.CensorSuffix)
+	}
+
+	var plans []rollbackPlan
+	for _, p := range keys {
+		if strings.HasSuffix(p, "/") {
+			continue
+		}
+		meta, err := client.GetSecretMetadata(ctx, p)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "skipping %s: %v\n", p, err)
+			continue
+		}
+
+		target := s.Version
+		if s.At != "" {
+			v, ok := meta.VersionAt(at)
+			if !ok {
+				fmt.Fprintf(os.Stderr, "skipping %s: no version existed at %s\n", p, at.Format(time.RFC3339))
+				continue
+			}
+			target = v
+		}
+		vm, ok := meta.Versions[target]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "skipping %s: version %d not found (oldest kept is %d)\n", p, target, meta.OldestVersion)
+			continue
+		}
+		if !vm.IsReadable() {
+			fmt.Fprintf(os.Stderr, "skipping %s: version %d is deleted or destroyed\n", p, target)
+			continue
+		}
+		if target == meta.CurrentVersion {
+			fmt.Fprintf(os.Stderr, "skipping %s: version %d is already current\n", p, target)
+			continue
+		}
+
+		old, err := client.GetSecretsVersion(ctx, p, target)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "skipping %s: %v\n", p, err)
+			continue
+		}
+		// The current version may be soft-deleted; diff against empty data in that case
+		current, _ := client.GetSecretsVersion(ctx, p, meta.CurrentVersion)
+		changes := diffVersions(current, old)
+		if len(changes) == 0 {
+			fmt.Fprintf(os.Stderr, "skipping %s: version %d has the same data as current version %d\n", p, target, meta.CurrentVersion)
+			continue
+		}
+		plans = append(plans, rollbackPlan{path: p, currentVersion: meta.CurrentVersion, targetVersion: target, restore: old, changes: changes})
+	}
+
+	if len(plans) == 0 {
+		fmt.Fprintln(os.Stderr, "nothing to roll back")
+		return nil
+	}
+
+	for _, plan := range plans {
+		fmt.Printf("%s: v%d -> restore v%d\n", plan.path, plan.currentVersion, plan.targetVersion)
+		for _, ch := range plan.changes {
+			switch ch.change {
+			case "added":
+				fmt.Printf("  + %s=%q\n", ch.key, censor(ch.new))
+			case "removed":
+				fmt.Printf("  - %s=%q\n", ch.key, censor(ch.old))
+			default:
+				fmt.Printf("  ~ %s: %q -> %q\n", ch.key, censor(ch.old), censor(ch.new))
+			}
+		}
+	}
+
+	if !s.Yes {
+		if !askForConfirmation(fmt.Sprintf("Restore %d secrets under '%s'? [y/N]: ", len(plans), s.Path)) {
+			fmt.Fprintln(os.Stderr, "aborted")
+			return nil
+		}
+	}
+
+	// Write the old data back as a new version, guarded by check-and-set on the version that was diffed
+	restored := 0
+	for _, plan := range plans {
+		if err := client.PutSecretsCAS(ctx, plan.path, plan.restore, plan.currentVersion); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to restore %s: %v\n", plan.path, err)
+			continue
+		}
+		restored++
+	}
+	fmt.Fprintf(os.Stdout, "restored %d secrets\n", restored)
+	if restored < len(plans) {
+		return fmt.Errorf("failed to restore %d of %d secrets", len(plans)-restored, len(plans))
+	}
+	return nil
+}
+
+var _ gcmds.BareCommand = &RollbackCommand{}
@@ -90,14 +90,16 @@ func (c *SearchCommand) RunIntoGlazeProcessor(ctx context.Context, parsed *value
 
 	ctx2, cancel := context.WithTimeout(ctx, 60*time.Second)
 	defer cancel()
-	token, err := vault.ResolveToken(ctx2, vs.VaultToken, vault.TokenSource(vs.VaultTokenSource), vs.VaultTokenFile, false)
+	token, err := vault.ResolveToken(ctx2, vs.TokenOptions())
 	if err != nil {
 		return fmt.Errorf("failed to resolve Vault token: %w", err)
 	}
-	client, err := vault.NewClient(vs.VaultAddr, token)
+	client, err := vault.NewClient(ctx, vs.ClientConfig(), token)
 	if err != nil {
 		return fmt.Errorf("failed to create Vault client: %w", err)
 	}
+	stopTokenWatch := client.WatchToken(ctx, vs.TokenWatchOptions())
+	defer stopTokenWatch()
 
 	keyMatchers, err := buildPatternMatchers(s.KeyContains, s.KeyRegexp, s.IgnoreCase)
 	if err != nil {
@@ -113,59 +115,49 @@ func (c *SearchCommand) RunIntoGlazeProcessor(ctx context.Context, parsed *value
 		return fmt.Errorf("provide at least one key or value matcher (--key-contains/--key-regexp/--value-contains/--value-regexp)")
 	}
 
-	entries, warns := listing.Walk(client, s.Path, s.Depth)
-	for _, w := range warns {
-		fmt.Fprintf(os.Stderr, "Warning: %s\n", w.Error())
-		row := types.NewRow(
-			types.MRP("type", "warning"),
-			types.MRP("path", extractPathFromError(w)),
-			types.MRP("error", w.Error()),
-		)
-		if err := gp.AddRow(ctx, row); err != nil {
-			return err
-		}
+	opts := vs.TraversalOptions(s.Depth)
+	opts.ReadSecrets = true
+	opts.ReadMetadata = s.IncludeAudit
+	// Traverse reports secrets in no particular order; buffer the rows and emit them sorted by
+	// path so repeated searches produce the same output
+	type pathRow struct {
+		path string
+		row  types.Row
 	}
-
-	metadataCache := map[string]*vault.SecretMetadata{}
-	metadataErrCache := map[string]error{}
-
-	for _, entry := range entries {
-		if strings.HasSuffix(entry, "/") {
-			continue
+	var rows []pathRow
+	addRow := func(path string, row types.Row) {
+		rows = append(rows, pathRow{path: path, row: row})
+	}
+	err = listing.NewEngine(client, opts).Traverse(ctx, s.Path, func(n listing.Node) error {
+		if n.Dir {
+			if n.Err == nil {
+				return nil
+			}
+			w := fmt.Errorf("%s: %w", n.Path, n.Err)
+			fmt.Fprintf(os.Stderr, "Warning: %s\n", w.Error())
+			row := types.NewRow(
+				types.MRP("type", "warning"),
+				types.MRP("path", extractPathFromError(w)),
+				types.MRP("error", w.Error()),
+			)
+			addRow(n.Path, row)
+			return nil
 		}
 
-		data, err := client.GetSecrets(entry)
-		if err != nil {
-			msg := fmt.Sprintf("failed to read %s: %v", entry, err)
+		entry := n.Path
+		if n.Err != nil {
+			msg := fmt.Sprintf("failed to read %s: %v", entry, n.Err)
 			fmt.Fprintln(os.Stderr, msg)
 			row := types.NewRow(
 				types.MRP("type", "error"),
 				types.MRP("path", entry),
 				types.MRP("error", msg),
 			)
-			if err := gp.AddRow(ctx, row); err != nil {
-				return err
-			}
-			continue
-		}
-
-		var meta *vault.SecretMetadata
-		var metaErr error
-		if s.IncludeAudit {
-			if cached, ok := metadataCache[entry]; ok {
-				meta = cached
-			} else if cachedErr, ok := metadataErrCache[entry]; ok {
-				metaErr = cachedErr
-			} else {
-				meta, metaErr = client.GetSecretMetadata(entry)
-				if metaErr != nil {
-					metadataErrCache[entry] = metaErr
-				} else {
-					metadataCache[entry] = meta
-				}
-			}
+			addRow(entry, row)
+			return nil
 		}
 
+		data := n.Data
 		keys := make([]string, 0, len(data))
 		for k := range data {
 			keys = append(keys, k)
@@ -194,23 +186,31 @@ func (c *SearchCommand) RunIntoGlazeProcessor(ctx context.Context, parsed *value
 			}
 
 			if s.IncludeAudit {
-				if metaErr != nil {
-					params = append(params, types.MRP("audit_error", metaErr.Error()))
-				} else if meta != nil {
-					params = append(params, types.MRP("current_version", meta.CurrentVersion))
-					if versions := summarizeVersions(meta, s.AuditLimit); len(versions) > 0 {
+				if n.MetadataErr != nil {
+					params = append(params, types.MRP("audit_error", n.MetadataErr.Error()))
+				} else if n.Metadata != nil {
+					params = append(params, types.MRP("current_version", n.Metadata.CurrentVersion))
+					if versions := summarizeVersions(n.Metadata, s.AuditLimit); len(versions) > 0 {
 						params = append(params, types.MRP("audit_versions", versions))
 					}
 				}
 			}
 
-			row := types.NewRow(params...)
-			if err := gp.AddRow(ctx, row); err != nil {
-				return err
-			}
+			addRow(entry, types.NewRow(params...))
 		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
+	// Rows of one secret are already in key order
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].path < rows[j].path })
+	for _, r := range rows {
+		if err := gp.AddRow(ctx, r.row); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"os"
 	"strings"
-	"time"
 
 	glzcli "github.com/go-go-golems/glazed/pkg/cli"
 	gcmds "github.com/go-go-golems/glazed/pkg/cmds"
@@ -18,7 +17,6 @@ import (
 
 	"github.com/go-go-golems/vault-envrc-generator/pkg/cmdutil"
 	"github.com/go-go-golems/vault-envrc-generator/pkg/seed"
-	"github.com/go-go-golems/vault-envrc-generator/pkg/vault"
 	"github.com/go-go-golems/vault-envrc-generator/pkg/vaultlayer"
 )
 
@@ -35,6 +33,7 @@ type SeedSettings struct {
 	AllowCmd  bool     `glazed:"allow-commands"`
 	ExtraKV   []string `glazed:"extra"`
 	ExtraFile string   `glazed:"extra-file"`
+	Stats     bool     `glazed:"stats"`
 }
 
 func NewSeedCommand() (*SeedCommand, error) {
@@ -57,6 +56,7 @@ func NewSeedCommand() (*SeedCommand, error) {
 			fields.New("allow-commands", fields.TypeBool, fields.WithDefault(false), fields.WithHelp("Run commands in spec without confirmation")),
 			fields.New("extra", fields.TypeStringList, fields.WithHelp("Additional template data key=value pairs")),
 			fields.New("extra-file", fields.TypeString, fields.WithHelp("YAML or JSON file with additional template data")),
+			fields.New("stats", fields.TypeBool, fields.WithDefault(false), fields.WithHelp("Print how many Vault calls were made (and served from cache) to stderr")),
 		),
 		gcmds.WithSections(section),
 	)
@@ -81,15 +81,13 @@ func (c *SeedCommand) Run(ctx context.Context, parsed *values.Values) error {
 		return err
 	}
 
-	ctx2, cancel := context.WithTimeout(ctx, 15*time.Second)
-	defer cancel()
-	token, err := vault.ResolveToken(ctx2, vs.VaultToken, vault.TokenSource(vs.VaultTokenSource), vs.VaultTokenFile, false)
+	session, err := vs.OpenSession(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to resolve Vault token: %w", err)
+		return err
 	}
-	client, err := vault.NewClient(vs.VaultAddr, token)
-	if err != nil {
-		return fmt.Errorf("failed to create Vault client: %w", err)
+	defer session.Close()
+	if s.Stats {
+		defer func() { fmt.Fprintln(os.Stderr, session.Stats()) }()
 	}
 
 	b, err := os.ReadFile(s.Config)
@@ -143,7 +141,7 @@ func (c *SeedCommand) Run(ctx context.Context, parsed *values.Values) error {
 		}
 	}
 
-	return seed.Run(client, &spec, seed.Options{
+	return seed.Run(ctx, session, &spec, seed.Options{
 		DryRun:            s.DryRun,
 		ForceOverwrite:    s.Force,
 		AllowCommands:     s.AllowCmd,
@@ -57,16 +57,16 @@ func (c *TokenCommand) RunIntoGlazeProcessor(ctx context.Context, parsed *values
 
 	ctx2, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
-	token, err := vault.ResolveToken(ctx2, vs.VaultToken, vault.TokenSource(vs.VaultTokenSource), vs.VaultTokenFile, false)
+	token, err := vault.ResolveToken(ctx2, vs.TokenOptions())
 	if err != nil {
 		return fmt.Errorf("failed to resolve Vault token: %w", err)
 	}
-	client, err := vault.NewClient(vs.VaultAddr, token)
+	client, err := vault.NewClient(ctx, vs.ClientConfig(), token)
 	if err != nil {
 		return fmt.Errorf("failed to create Vault client: %w", err)
 	}
 
-	tctx, err := vault.BuildTemplateContext(client)
+	tctx, err := vault.BuildTemplateContext(ctx, client)
 	if err != nil {
 		return fmt.Errorf("failed to lookup token: %w", err)
 	}
@@ -14,6 +14,7 @@ import (
 	"github.com/go-go-golems/glazed/pkg/cmds/values"
 	"gopkg.in/yaml.v3"
 
+	"github.com/go-go-golems/vault-envrc-generator/pkg/listing"
 	"github.com/go-go-golems/vault-envrc-generator/pkg/vault"
 	"github.com/go-go-golems/vault-envrc-generator/pkg/vaultlayer"
 )
@@ -37,7 +38,7 @@ func NewTreeCommand() (*TreeCommand, error) {
 		"tree",
 		gcmds.WithShort("Recursively print Vault tree as YAML (censored by default)"),
 		gcmds.WithFlags(
-			fields.New("path", fields.TypeString, fields.WithRequired(true), fields.WithShortFlag("p"), fields.WithHelp("Root Vault path (prefix)")),
+			fields.New("path", fields.TypeString, fields.WithRequired(true), fields.WithShortFlag("p"), fields.WithHelp("Root Vault path (prefix); use path@N to print version N of a single secret")),
 			fields.New("depth", fields.TypeInteger, fields.WithDefault(0), fields.WithHelp("Max depth (0 = unlimited)")),
 			fields.New("reveal-values", fields.TypeBool, fields.WithDefault(false), fields.WithHelp("Reveal real values instead of censored")),
 			fields.New("censor-prefix", fields.TypeInteger, fields.WithDefault(2), fields.WithHelp("Visible characters at start of value when censored")),
@@ -64,73 +65,35 @@ func (c *TreeCommand) Run(ctx context.Context, parsed *values.Values) error {
 
 	ctx2, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
-	token, err := vault.ResolveToken(ctx2, vs.VaultToken, vault.TokenSource(vs.VaultTokenSource), vs.VaultTokenFile, false)
+	token, err := vault.ResolveToken(ctx2, vs.TokenOptions())
 	if err != nil {
 		return fmt.Errorf("failed to resolve Vault token: %w", err)
 	}
-	client, err := vault.NewClient(vs.VaultAddr, token)
+	client, err := vault.NewClient(ctx, vs.ClientConfig(), token)
 	if err != nil {
 		return fmt.Errorf("failed to create Vault client: %w", err)
 	}
+	stopTokenWatch := client.WatchToken(ctx, vs.TokenWatchOptions())
+	defer stopTokenWatch()
 
-	root := vault.NormalizeListPath(s.Path)
+	sourcePath, version, err := vault.SplitPathVersion(s.Path)
+	if err != nil {
+		return err
+	}
+	root := vault.NormalizeListPath(sourcePath)
 	tree := map[string]interface{}{}
+	opts := vs.TraversalOptions(s.Depth)
+	opts.ReadSecrets = true
 
-	var walk func(prefix string, depth int, node map[string]interface{}) error
-	walk = func(prefix string, depth int, node map[string]interface{}) error {
-		keys, err := client.ListSecrets(prefix)
+	if version > 0 {
+		// A pinned version refers to a single secret rather than a subtree
+		data, err := client.GetSecretsVersion(ctx, sourcePath, version)
 		if err != nil {
-			// Try leaf secret
-			trimmed := strings.TrimSuffix(prefix, "/")
-			if trimmed != "" {
-				data, err2 := client.GetSecrets(trimmed)
-				if err2 == nil {
-					node["__secret__"] = materializeData(data, s.Reveal, s.CensorPrefix, s.CensorSuffix)
-					return nil
-				}
-			}
 			return err
 		}
-
-		// If no keys were returned, this might be a leaf secret; attempt to read it
-		if len(keys) == 0 {
-			trimmed := strings.TrimSuffix(prefix, "/")
-			if trimmed != "" {
-				if data, err2 := client.GetSecrets(trimmed); err2 == nil {
-					node["__secret__"] = materializeData(data, s.Reveal, s.CensorPrefix, s.CensorSuffix)
-					return nil
-				}
-			}
-		}
-		for _, k := range keys {
-			if strings.HasSuffix(k, "/") {
-				name := strings.TrimSuffix(k, "/")
-				child := map[string]interface{}{}
-				node[name] = child
-				if depth != 1 {
-					next := depth
-					if next > 0 {
-						next = depth - 1
-					}
-					if err := walk(prefix+k, next, child); err != nil {
-						node[name+"__error__"] = err.Error()
-					}
-				}
-			} else {
-				// leaf entry
-				leafPath := prefix + k
-				data, err := client.GetSecrets(leafPath)
-				if err != nil {
-					node[k+"__error__"] = err.Error()
-					continue
-				}
-				node[k] = materializeData(data, s.Reveal, s.CensorPrefix, s.CensorSuffix)
-			}
-		}
-		return nil
-	}
-
-	if err := walk(root, s.Depth, tree); err != nil {
+		tree["__secret__"] = materializeData(data, s.Reveal, s.CensorPrefix, s.CensorSuffix)
+		tree["__version__"] = version
+	} else if err := buildTree(ctx, listing.NewEngine(client, opts), root, tree, s); err != nil {
 		return err
 	}
 
@@ -143,6 +106,50 @@ func (c *TreeCommand) Run(ctx context.Context, parsed *values.Values) error {
 	return nil
 }
 
+// buildTree streams the traversal below root into a nested map: directories become maps, secrets
+// their (censored) data and failures a sibling "<name>__error__" entry.
+func buildTree(ctx context.Context, engine *listing.Engine, root string, tree map[string]interface{}, s *TreeSettings) error {
+	// nodeFor returns the map holding the entry at rel, creating intermediate directories
+	nodeFor := func(rel string) (map[string]interface{}, string) {
+		parts := strings.Split(rel, "/")
+		node := tree
+		for _, p := range parts[:len(parts)-1] {
+			child, ok := node[p].(map[string]interface{})
+			if !ok {
+				child = map[string]interface{}{}
+				node[p] = child
+			}
+			node = child
+		}
+		return node, parts[len(parts)-1]
+	}
+
+	return engine.Traverse(ctx, root, func(n listing.Node) error {
+		if n.Depth == 0 {
+			if n.Err != nil {
+				return n.Err
+			}
+			tree["__secret__"] = materializeData(n.Data, s.Reveal, s.CensorPrefix, s.CensorSuffix)
+			return nil
+		}
+		parent, name := nodeFor(strings.TrimSuffix(strings.TrimPrefix(n.Path, root), "/"))
+		switch {
+		case n.Dir:
+			if _, ok := parent[name]; !ok {
+				parent[name] = map[string]interface{}{}
+			}
+			if n.Err != nil {
+				parent[name+"__error__"] = n.Err.Error()
+			}
+		case n.Err != nil:
+			parent[name+"__error__"] = n.Err.Error()
+		default:
+			parent[name] = materializeData(n.Data, s.Reveal, s.CensorPrefix, s.CensorSuffix)
+		}
+		return nil
+	})
+}
+
 func materializeData(data map[string]interface{}, reveal bool, pre int, suf int) map[string]string {
 	out := make(map[string]string, len(data))
 	for k, v := range data {
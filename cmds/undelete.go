@@ -0,0 +1,113 @@
+package cmds
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	glzcli "github.com/go-go-golems/glazed/pkg/cli"
+	gcmds "github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/fields"
+	"github.com/go-go-golems/glazed/pkg/cmds/schema"
+	"github.com/go-go-golems/glazed/pkg/cmds/values"
+
+	"github.com/go-go-golems/vault-envrc-generator/pkg/listing"
+	"github.com/go-go-golems/vault-envrc-generator/pkg/vault"
+	"github.com/go-go-golems/vault-envrc-generator/pkg/vaultlayer"
+)
+
+type UndeleteCommand struct{ *gcmds.CommandDescription }
+
+type UndeleteSettings struct {
+	Path     string `glazed:"path"`
+	Depth    int    `glazed:"depth"`
+	Versions []int  `glazed:"versions"`
+}
+
+func NewUndeleteCommand() (*UndeleteCommand, error) {
+	section, err := glzcli.NewCommandSettingsSection()
+	if err != nil {
+		return nil, err
+	}
+	cd := gcmds.NewCommandDescription(
+		"undelete",
+		gcmds.WithShort("Restore soft-deleted KV v2 versions of a secret or every secret under a tree"),
+		gcmds.WithFlags(
+			fields.New("path", fields.TypeString, fields.WithRequired(true), fields.WithShortFlag("p"), fields.WithHelp("Vault secret path or tree root")),
+			fields.New("depth", fields.TypeInteger, fields.WithDefault(0), fields.WithHelp("Max depth to scan when path is a tree (0 = unlimited)")),
+			fields.New("versions", fields.TypeIntegerList, fields.WithHelp("Versions to restore (default: all soft-deleted versions)")),
+		),
+		gcmds.WithSections(section),
+	)
+	_, err = vaultlayer.AddVaultSectionToCommand(cd)
+	if err != nil {
+		return nil, err
+	}
+	return &UndeleteCommand{cd}, nil
+}
+
+func (c *UndeleteCommand) Run(ctx context.Context, parsed *values.Values) error {
+	s := &UndeleteSettings{}
+	if err := parsed.DecodeSectionInto(schema.DefaultSlug, s); err != nil {
+		return err
+	}
+	vs, err := vaultlayer.GetVaultSettings(parsed)
+	if err != nil {
+		return err
+	}
+
+	ctx2, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+	token, err := vault.ResolveToken(ctx2, vs.TokenOptions())
+	if err != nil {
+		return fmt.Errorf("failed to resolve Vault token: %w", err)
+	}
+	client, err := vault.NewClient(ctx, vs.ClientConfig(), token)
+	if err != nil {
+		return fmt.Errorf("failed to create Vault client: %w", err)
+	}
+	stopTokenWatch := client.WatchToken(ctx, vs.TokenWatchOptions())
+	defer stopTokenWatch()
+
+	// A soft-deleted leaf cannot be read, so listing.Walk would not find it; check metadata first
+	var leaves []string
+	trimmed := strings.TrimSuffix(s.Path, "/")
+	if meta, err := client.GetSecretMetadata(ctx, trimmed); err == nil && meta.CurrentVersion > 0 {
+		leaves = []string{trimmed}
+	} else {
+		keys, errs := listing.NewEngine(client, vs.TraversalOptions(s.Depth)).Walk(ctx, s.Path)
+		for _, e := range errs {
+			fmt.Fprintf(os.Stderr, "warning: %v\n", e)
+		}
+		for _, k := range keys {
+			if !strings.HasSuffix(k, "/") {
+				leaves = append(leaves, k)
+			}
+		}
+	}
+
+	restored := 0
+	failed := 0
+	for _, p := range leaves {
+		versions, err := client.UndeleteVersions(ctx, p, s.Versions)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to undelete %s: %v\n", p, err)
+			failed++
+			continue
+		}
+		if len(versions) == 0 {
+			continue
+		}
+		fmt.Fprintf(os.Stdout, "%s: restored versions %v\n", p, versions)
+		restored++
+	}
+	fmt.Fprintf(os.Stdout, "undeleted %d secrets\n", restored)
+	if failed > 0 {
+		return fmt.Errorf("failed to undelete %d secrets", failed)
+	}
+	return nil
+}
+
+var _ gcmds.BareCommand = &UndeleteCommand{}
@@ -2,22 +2,19 @@ package batch
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"os"
-	"path/filepath"
-	"sort"
 	"strings"
 
-	"encoding/json"
 	"github.com/go-go-golems/vault-envrc-generator/pkg/envrc"
 	"github.com/go-go-golems/vault-envrc-generator/pkg/output"
 	"github.com/go-go-golems/vault-envrc-generator/pkg/vault"
 	"github.com/rs/zerolog/log"
-	"gopkg.in/yaml.v3"
 )
 
 type Processor struct {
-	Client *vault.Client
+	Client vault.SecretStore
 }
 
 type ProcessorOptions struct {
@@ -31,9 +28,9 @@ type ProcessorOptions struct {
 	SkipUnreadableSections bool
 }
 
-func (p *Processor) Process(cfg *Config, opts ProcessorOptions) error {
+func (p *Processor) Process(ctx context.Context, cfg *Config, opts ProcessorOptions) error {
 	// build template context
-	tctx, err := vault.BuildTemplateContext(p.Client)
+	tctx, err := vault.BuildTemplateContext(ctx, p.Client)
 	if err != nil {
 		return fmt.Errorf("failed to build template context: %w", err)
 	}
@@ -49,15 +46,15 @@ func (p *Processor) Process(cfg *Config, opts ProcessorOptions) error {
 		}
 	}
 
-	return p.processSequential(cfg.Jobs, tctx, basePath, opts)
+	return p.processSequential(ctx, cfg.Jobs, tctx, basePath, opts)
 }
 
-func (p *Processor) processSequential(jobs []Job, tctx vault.TemplateContext, basePath string, opts ProcessorOptions) error {
+func (p *Processor) processSequential(ctx context.Context, jobs []Job, tctx vault.TemplateContext, basePath string, opts ProcessorOptions) error {
 	var errors []error
 	for i, job := range jobs {
 		fmt.Printf("[%d/%d] Processing job: %s\n", i+1, len(jobs), job.Name)
 		log.Debug().Int("sections", len(job.Sections)).Str("job", job.Name).Msg("batch job start")
-		if err := p.processJob(job, tctx, basePath, opts); err != nil {
+		if err := p.processJob(ctx, job, tctx, basePath, opts); err != nil {
 			fmt.Fprintf(os.Stderr, "Job '%s' failed: %v\n", job.Name, err)
 			errors = append(errors, err)
 			if !opts.ContinueOnError {
@@ -77,7 +74,7 @@ func (p *Processor) processSequential(jobs []Job, tctx vault.TemplateContext, ba
 
 // processParallel was removed to avoid lock contention; keep sequential processing only.
 
-func (p *Processor) processJob(job Job, tctx vault.TemplateContext, basePath string, opts ProcessorOptions) error {
+func (p *Processor) processJob(ctx context.Context, job Job, tctx vault.TemplateContext, basePath string, opts ProcessorOptions) error {
 	log.Debug().Str("job", job.Name).Int("sections", len(job.Sections)).Msg("process job")
 	// job-level base path override
 	effectiveBase := basePath
@@ -91,17 +88,31 @@ func (p *Processor) processJob(job Job, tctx vault.TemplateContext, basePath str
 	}
 	log.Debug().Str("job", job.Name).Str("effectiveBase", effectiveBase).Msg("job base path")
 
+	mode, err := output.ParseFileMode(job.Mode)
+	if err != nil {
+		return fmt.Errorf("job '%s': %w", job.Name, err)
+	}
+	// Keys the job wrote to structured outputs before and no longer produces are pruned
+	wopts := output.WriteOptions{SortKeys: opts.SortKeys, Mode: mode, Backup: job.Backup, Owner: job.Name}
+	switch job.WriteMode {
+	case "", WriteModeOverwrite:
+	case WriteModeBlock:
+		if job.Name == "" {
+			return fmt.Errorf("write_mode %s needs a job name", WriteModeBlock)
+		}
+		wopts.Block = job.Name
+	default:
+		return fmt.Errorf("job '%s': unknown write_mode %q (supported: %s, %s)", job.Name, job.WriteMode, WriteModeOverwrite, WriteModeBlock)
+	}
+
 	if len(job.Sections) > 0 {
-		// stdout aggregations (only used when output == "-")
-		var stdoutJSONAgg map[string]interface{}
-		var stdoutYAMLAgg map[string]interface{}
-		var stdoutENVRCAgg strings.Builder
-		// aggregate envrc content per output path so we can overwrite once at the end
-		envrcFileBuffers := map[string]*strings.Builder{}
+		// sections rendered for the same output and format are aggregated and written once at the end
+		var pending []*pendingOutput
+		skipped := false
 
 		for _, sec := range job.Sections {
 			log.Debug().Str("section", sec.Name).Msg("section start")
-			joinedPath := vault.JoinBaseAndPath(effectiveBase, sec.Path)
+			joinedPath := p.Client.JoinBaseAndPath(ctx, effectiveBase, sec.Path)
 			renderedSourcePath, err := vault.RenderTemplateString(joinedPath, tctx)
 			if err != nil {
 				return fmt.Errorf("failed to render section path '%s': %w", sec.Path, err)
@@ -117,6 +128,7 @@ func (p *Processor) processJob(job Job, tctx vault.TemplateContext, basePath str
 			if err != nil {
 				return fmt.Errorf("failed to render section output '%s': %w", outPath, err)
 			}
+			targetPath := renderedOutPath
 			if opts.DryRun {
 				renderedOutPath = "-"
 			}
@@ -127,19 +139,23 @@ func (p *Processor) processJob(job Job, tctx vault.TemplateContext, basePath str
 			if opts.FormatOverride != "" {
 				format = opts.FormatOverride
 			}
-			if format == "" {
-				format = "envrc"
+			formatter, err := envrc.LookupFormatter(format)
+			if err != nil {
+				return fmt.Errorf("section '%s': %w", sec.Name, err)
 			}
+			format = formatter.Name()
+			commenter, _ := formatter.(envrc.Commenter)
 
 			log.Debug().Str("section", sec.Name).Str("source", renderedSourcePath).Str("output", renderedOutPath).Str("format", format).Msg("section io")
 
 			// secrets
 			secrets := map[string]interface{}{}
 			if strings.TrimSpace(renderedSourcePath) != "" {
-				s, err := p.Client.GetSecrets(renderedSourcePath)
+				s, err := vault.GetSecretsRef(ctx, p.Client, renderedSourcePath)
 				if err != nil {
 					if opts.SkipUnreadableSections {
 						fmt.Fprintf(os.Stderr, "Warning: skipping unreadable section '%s' (%s): %v\n", sec.Name, renderedSourcePath, err)
+						skipped = true
 						continue
 					}
 					return fmt.Errorf("failed to retrieve secrets from path %s: %w", renderedSourcePath, err)
@@ -226,12 +242,13 @@ func (p *Processor) processJob(job Job, tctx vault.TemplateContext, basePath str
 				include = nil
 			}
 
-			suppressHeader := false
-			if format == "envrc" {
-				// With aggregation, suppress generic header; per-section header added below
-				suppressHeader = true
-			}
+			// With aggregation, suppress the generic header; a per-section header is added below
+			suppressHeader := commenter != nil
 
+			quoting := job.Quoting
+			if sec.Quoting != "" {
+				quoting = sec.Quoting
+			}
 			options := &envrc.Options{
 				Prefix:         prefix,
 				ExcludeKeys:    exclude,
@@ -242,6 +259,9 @@ func (p *Processor) processJob(job Job, tctx vault.TemplateContext, basePath str
 				Verbose:        false,
 				SuppressHeader: suppressHeader,
 				SortKeys:       opts.SortKeys,
+				Quoting:        quoting,
+				Section:        firstNonEmpty(sec.Name, job.Name),
+				Kubernetes:     kubernetesOptions(job.Kubernetes.Override(sec.Kubernetes), job.Name, sec.Name),
 			}
 
 			generator := envrc.NewGenerator(options)
@@ -251,179 +271,60 @@ func (p *Processor) processJob(job Job, tctx vault.TemplateContext, basePath str
 			}
 			log.Debug().Int("bytes", len(content)).Str("section", sec.Name).Msg("generated content")
 
-			if options.Format == "envrc" {
-				header := fmt.Sprintf("# === %s", job.Name)
-				if sec.Name != "" {
-					header += fmt.Sprintf(": %s", sec.Name)
-				}
-				header += " ===\n"
-				header += fmt.Sprintf("# Source path: %s\n", renderedSourcePath)
+			title := job.Name
+			if sec.Name != "" {
+				title += ": " + sec.Name
+			}
+			if commenter != nil {
+				lines := []string{"=== " + title + " ===", "Source path: " + renderedSourcePath}
 				if job.Description != "" {
-					header += fmt.Sprintf("# Job: %s\n", job.Description)
+					lines = append(lines, "Job: "+job.Description)
 				}
 				if sec.Description != "" {
-					header += fmt.Sprintf("# Section: %s\n", sec.Description)
+					lines = append(lines, "Section: "+sec.Description)
 				}
-				header += "\n"
-				content = header + content + "\n"
+				content = commentHeader(commenter, lines) + content + "\n"
 			}
 
-			// stdout vs file handling: aggregate to stdout, otherwise write immediately (merge-only)
-			if renderedOutPath == "-" {
-				switch format {
-				case "json":
-					var next map[string]interface{}
-					if err := json.Unmarshal([]byte(content), &next); err != nil {
-						return fmt.Errorf("failed to parse generated JSON for aggregation: %w", err)
-					}
-					if stdoutJSONAgg == nil {
-						stdoutJSONAgg = map[string]interface{}{}
-					}
-					for k, v := range next {
-						stdoutJSONAgg[k] = v
-					}
-				case "yaml":
-					var next map[string]interface{}
-					if err := yaml.Unmarshal([]byte(content), &next); err != nil {
-						return fmt.Errorf("failed to parse generated YAML for aggregation: %w", err)
-					}
-					if stdoutYAMLAgg == nil {
-						stdoutYAMLAgg = map[string]interface{}{}
-					}
-					for k, v := range next {
-						stdoutYAMLAgg[k] = v
-					}
-				default:
-					stdoutENVRCAgg.WriteString(content)
+			pending = addPending(pending, renderedOutPath, formatter, content)
+
+			if fileEnvrc := firstNonEmpty(sec.FileEnvrc, job.FileEnvrc); fileEnvrc != "" {
+				if _, ok := formatter.(envrc.FileSet); !ok {
+					return fmt.Errorf("section '%s': file_envrc needs format dir", sec.Name)
 				}
-			} else {
-				if format == "envrc" {
-					b, ok := envrcFileBuffers[renderedOutPath]
-					if !ok {
-						b = &strings.Builder{}
-						envrcFileBuffers[renderedOutPath] = b
-					}
-					b.WriteString(content)
-				} else {
-					if err := output.Write(renderedOutPath, []byte(content), output.WriteOptions{Format: format, SortKeys: opts.SortKeys}); err != nil {
-						return err
-					}
+				envrcPath, err := vault.RenderTemplateString(fileEnvrc, tctx)
+				if err != nil {
+					return fmt.Errorf("failed to render section file_envrc '%s': %w", fileEnvrc, err)
 				}
-			}
-		}
-
-		// flush aggregated envrc outputs (ask confirmation before overwrite unless forced)
-		for outPath, b := range envrcFileBuffers {
-			if b.Len() == 0 {
-				continue
-			}
-			// Ensure directory exists
-			if dir := filepath.Dir(outPath); dir != "" && dir != "." {
-				if err := os.MkdirAll(dir, 0755); err != nil {
-					return fmt.Errorf("failed to create output directory %s: %w", dir, err)
+				if opts.DryRun {
+					envrcPath = "-"
 				}
-			}
-			if fi, err := os.Stat(outPath); err == nil && fi.Mode().IsRegular() {
-				if !opts.ForceOverwrite {
-					ok, err := confirmOverwrite(outPath)
-					if err != nil {
-						return err
-					}
-					if !ok {
-						log.Info().Str("path", outPath).Msg("skipped overwrite of existing .envrc")
-						continue
-					}
+				if pending, err = addFileExports(pending, envrcPath, title, targetPath, content); err != nil {
+					return err
 				}
 			}
-			if err := os.WriteFile(outPath, []byte(b.String()), 0644); err != nil {
-				return fmt.Errorf("failed to write envrc output to %s: %w", outPath, err)
-			}
-			log.Debug().Str("output", outPath).Int("bytes", b.Len()).Msg("envrc file overwritten")
 		}
 
-		// flush outputs to stdout
-		if stdoutJSONAgg != nil {
-			if opts.SortKeys {
-				keys := make([]string, 0, len(stdoutJSONAgg))
-				for k := range stdoutJSONAgg {
-					keys = append(keys, k)
-				}
-				sort.Strings(keys)
-				var bld strings.Builder
-				bld.WriteString("{\n")
-				for i, k := range keys {
-					kb, _ := json.Marshal(k)
-					vb, err := json.Marshal(stdoutJSONAgg[k])
-					if err != nil {
-						return fmt.Errorf("failed to marshal aggregated JSON value: %w", err)
-					}
-					if i > 0 {
-						bld.WriteString(",\n")
-					}
-					bld.WriteString("  ")
-					bld.Write(kb)
-					bld.WriteString(": ")
-					bld.Write(vb)
-				}
-				bld.WriteString("\n}")
-				fmt.Print(bld.String())
-			} else {
-				b, err := json.MarshalIndent(stdoutJSONAgg, "", "  ")
-				if err != nil {
-					return fmt.Errorf("failed to marshal aggregated JSON: %w", err)
-				}
-				fmt.Print(string(b))
-			}
+		if skipped && wopts.Owner != "" {
+			// The keys of a skipped section are missing from this run, not from Vault: keep them
+			// in the outputs and leave the recorded ownership for the next complete run
+			log.Warn().Str("job", job.Name).Msg("batch: sections were skipped, not pruning keys this job wrote before")
+			wopts.Owner = ""
 		}
-		if stdoutYAMLAgg != nil {
-			if len(stdoutYAMLAgg) > 0 {
-				if opts.SortKeys {
-					keys := make([]string, 0, len(stdoutYAMLAgg))
-					for k := range stdoutYAMLAgg {
-						keys = append(keys, k)
-					}
-					sort.Strings(keys)
-					node := &yaml.Node{Kind: yaml.MappingNode}
-					for _, k := range keys {
-						kn := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: k}
-						var valueDoc yaml.Node
-						b, err := yaml.Marshal(stdoutYAMLAgg[k])
-						if err != nil {
-							return fmt.Errorf("failed to marshal yaml value: %w", err)
-						}
-						if err := yaml.Unmarshal(b, &valueDoc); err != nil {
-							return fmt.Errorf("failed to unmarshal yaml value node: %w", err)
-						}
-						var vn *yaml.Node
-						if len(valueDoc.Content) == 0 {
-							vn = &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "~"}
-						} else {
-							vn = valueDoc.Content[0]
-						}
-						node.Content = append(node.Content, kn, vn)
-					}
-					b, err := yaml.Marshal(node)
-					if err != nil {
-						return fmt.Errorf("failed to marshal ordered YAML: %w", err)
-					}
-					fmt.Print(string(b))
-				} else {
-					b, err := yaml.Marshal(stdoutYAMLAgg)
-					if err != nil {
-						return fmt.Errorf("failed to marshal aggregated YAML: %w", err)
-					}
-					fmt.Print(string(b))
-				}
+		for _, out := range pending {
+			content, err := out.formatter.Aggregate(out.docs, envrc.FormatOptions{SortKeys: opts.SortKeys})
+			if err != nil {
+				return err
+			}
+			if err := writeOutput(out.path, out.formatter, content, wopts, opts); err != nil {
+				return err
 			}
-		}
-		if stdoutENVRCAgg.Len() > 0 {
-			fmt.Print(stdoutENVRCAgg.String())
 		}
 		return nil
 	}
 
 	// legacy single-path mode
-	joinedJobPath := vault.JoinBaseAndPath(effectiveBase, job.Path)
+	joinedJobPath := p.Client.JoinBaseAndPath(ctx, effectiveBase, job.Path)
 	renderedPath, err := vault.RenderTemplateString(joinedJobPath, tctx)
 	if err != nil {
 		return fmt.Errorf("failed to render job path '%s': %w", job.Path, err)
@@ -437,7 +338,7 @@ func (p *Processor) processJob(job Job, tctx vault.TemplateContext, basePath str
 		return fmt.Errorf("failed to render job output '%s': %w", outPath, err)
 	}
 
-	secrets, err := p.Client.GetSecrets(renderedPath)
+	secrets, err := p.Client.GetSecrets(ctx, renderedPath)
 	if err != nil {
 		if opts.SkipUnreadableSections {
 			fmt.Fprintf(os.Stderr, "Warning: skipping unreadable job '%s' path %s: %v\n", job.Name, renderedPath, err)
@@ -476,59 +377,151 @@ func (p *Processor) processJob(job Job, tctx vault.TemplateContext, basePath str
 		Verbose:        false,
 		SuppressHeader: false,
 		SortKeys:       opts.SortKeys,
+		Quoting:        job.Quoting,
+		Section:        job.Name,
+		Kubernetes:     kubernetesOptions(job.Kubernetes.Override(nil), job.Name),
 	}
 	if opts.FormatOverride != "" {
 		options.Format = opts.FormatOverride
 	}
-	if options.Format == "" {
-		options.Format = "envrc"
+	formatter, err := envrc.LookupFormatter(options.Format)
+	if err != nil {
+		return err
 	}
 
-	// For envrc, we now overwrite instead of appending; keep headers
-
 	generator := envrc.NewGenerator(options)
 	content, err := generator.Generate(secrets)
 	if err != nil {
 		return fmt.Errorf("failed to generate content: %w", err)
 	}
-	if options.Format == "envrc" {
-		header := fmt.Sprintf("# === %s ===\n# Source path: %s\n", job.Name, renderedPath)
+	if commenter, ok := formatter.(envrc.Commenter); ok {
+		lines := []string{"=== " + job.Name + " ===", "Source path: " + renderedPath}
 		if job.Description != "" {
-			header += fmt.Sprintf("# Description: %s\n", job.Description)
+			lines = append(lines, "Description: "+job.Description)
+		}
+		content = commentHeader(commenter, lines) + content + "\n"
+	}
+
+	var exports []*pendingOutput
+	if job.FileEnvrc != "" {
+		if _, ok := formatter.(envrc.FileSet); !ok {
+			return fmt.Errorf("job '%s': file_envrc needs format dir", job.Name)
+		}
+		envrcPath, err := vault.RenderTemplateString(job.FileEnvrc, tctx)
+		if err != nil {
+			return fmt.Errorf("failed to render job file_envrc '%s': %w", job.FileEnvrc, err)
+		}
+		if opts.DryRun {
+			envrcPath = "-"
+		}
+		if exports, err = addFileExports(nil, envrcPath, job.Name, renderedOutput, content); err != nil {
+			return err
 		}
-		header += "\n"
-		content = header + content + "\n"
 	}
 
 	log.Debug().Str("output", renderedOutput).Msg("writing job output")
 	if opts.DryRun {
 		renderedOutput = "-"
 	}
-	if options.Format == "envrc" && renderedOutput != "-" {
-		// Ensure directory exists
-		if dir := filepath.Dir(renderedOutput); dir != "" && dir != "." {
-			if err := os.MkdirAll(dir, 0755); err != nil {
-				return fmt.Errorf("failed to create output directory %s: %w", dir, err)
-			}
+	if err := writeOutput(renderedOutput, formatter, content, wopts, opts); err != nil {
+		return err
+	}
+	for _, out := range exports {
+		if err := writeOutput(out.path, out.formatter, out.docs[0], wopts, opts); err != nil {
+			return err
 		}
-		if fi, err := os.Stat(renderedOutput); err == nil && fi.Mode().IsRegular() {
-			if !opts.ForceOverwrite {
-				ok, err := confirmOverwrite(renderedOutput)
-				if err != nil {
-					return err
-				}
-				if !ok {
-					log.Info().Str("path", renderedOutput).Msg("skipped overwrite of existing .envrc")
-					return nil
-				}
-			}
+	}
+	return nil
+}
+
+// addFileExports queues an envrc document exporting KEY_FILE for each file that the dir
+// output doc writes to dir
+func addFileExports(pending []*pendingOutput, envrcPath, title, dir, doc string) ([]*pendingOutput, error) {
+	f, err := envrc.LookupFormatter(envrc.DefaultFormat)
+	if err != nil {
+		return nil, err
+	}
+	exports, err := envrc.FileExports(dir, doc, envrc.FormatOptions{SuppressHeader: true})
+	if err != nil {
+		return nil, err
+	}
+	header := commentHeader(f.(envrc.Commenter), []string{"=== " + title + " ===", "Secret files in: " + dir})
+	return addPending(pending, envrcPath, f, header+exports+"\n"), nil
+}
+
+// kubernetesOptions names manifests after the job (and section) unless a name is configured
+func kubernetesOptions(k *envrc.KubernetesOptions, names ...string) *envrc.KubernetesOptions {
+	if k.Name == "" {
+		k.Name = envrc.KubernetesName(names...)
+	}
+	return k
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
 		}
-		if err := os.WriteFile(renderedOutput, []byte(content), 0644); err != nil {
-			return fmt.Errorf("failed to write envrc output to %s: %w", renderedOutput, err)
+	}
+	return ""
+}
+
+// pendingOutput collects the documents rendered for one output path in one format
+type pendingOutput struct {
+	path      string
+	formatter envrc.Formatter
+	docs      []string
+}
+
+func addPending(pending []*pendingOutput, path string, f envrc.Formatter, doc string) []*pendingOutput {
+	for _, out := range pending {
+		if out.path == path && out.formatter.Name() == f.Name() {
+			out.docs = append(out.docs, doc)
+			return pending
 		}
-		return nil
 	}
-	return output.Write(renderedOutput, []byte(content), output.WriteOptions{Format: options.Format, SortKeys: opts.SortKeys})
+	return append(pending, &pendingOutput{path: path, formatter: f, docs: []string{doc}})
+}
+
+func commentHeader(c envrc.Commenter, lines []string) string {
+	var b strings.Builder
+	for _, line := range lines {
+		b.WriteString(c.Comment(line))
+		b.WriteString("\n")
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+// writeOutput prints content for "-". Files in formats with comments (such as envrc) carry
+// their own headers and either replace the job's managed block (wopts.Block) or are overwritten
+// after confirmation; other formats are merged into the existing file by output.Write.
+func writeOutput(path string, f envrc.Formatter, content string, wopts output.WriteOptions, opts ProcessorOptions) error {
+	wopts.Format = f.Name()
+	_, isCommenter := f.(envrc.Commenter)
+	if !isCommenter {
+		wopts.Block = ""
+	}
+	if !isCommenter || path == "-" || wopts.Block != "" {
+		return output.Write(path, []byte(content), wopts)
+	}
+	if fi, err := os.Stat(path); err == nil && fi.Mode().IsRegular() {
+		if !opts.ForceOverwrite {
+			ok, err := confirmOverwrite(path)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				log.Info().Str("path", path).Msg("skipped overwrite of existing file")
+				return nil
+			}
+		}
+	}
+	if err := output.Replace(path, []byte(content), wopts); err != nil {
+		return fmt.Errorf("failed to write %s output to %s: %w", f.Name(), path, err)
+	}
+	log.Debug().Str("output", path).Int("bytes", len(content)).Msg("output file overwritten")
+	return nil
 }
 
 // confirmOverwrite prompts the user to confirm overwriting an existing file.
@@ -0,0 +1,310 @@
+package batch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-go-golems/vault-envrc-generator/pkg/envrc"
+	"github.com/go-go-golems/vault-envrc-generator/pkg/vault"
+	"github.com/go-go-golems/vault-envrc-generator/pkg/vaulttest"
+)
+
+func newProcessor(t *testing.T) (*Processor, *vaulttest.Server) {
+	t.Helper()
+	srv := vaulttest.NewServer(t)
+	srv.LoadFixture(filepath.Join("testdata", "vault.yaml"))
+	return &Processor{Client: srv.Client()}, srv
+}
+
+func TestProcessEnvrcSections(t *testing.T) {
+	p, _ := newProcessor(t)
+	out := filepath.Join(t.TempDir(), ".envrc")
+	transform := true
+
+	cfg := &Config{
+		BasePath: "secret/envs/dev",
+		Jobs: []Job{{
+			Name:   "dev",
+			Output: out,
+			Sections: []Section{
+				{Name: "db", Path: "db", Prefix: "DB_", Transform: &transform, ExcludeKeys: []string{"port"}},
+				{Name: "slack", Path: "secret/shared/slack", EnvMap: map[string]string{"SLACK_WEBHOOK": "webhook"}},
+				{Name: "ssh", Path: "secret/personal/{{ .Token.OIDCUserID }}/ssh", IncludeKeys: []string{"key"}, Prefix: "SSH_"},
+			},
+		}},
+	}
+	require.NoError(t, p.Process(context.Background(), cfg, ProcessorOptions{SortKeys: true}))
+
+	content, err := os.ReadFile(out)
+	require.NoError(t, err)
+	s := string(content)
+	require.Contains(t, s, "# Source path: secret/envs/dev/db\n")
+	require.Contains(t, s, "export DB_USERNAME=app\n")
+	require.Contains(t, s, "export DB_PASSWORD='p@ss word'\n")
+	require.NotContains(t, s, "DB_PORT")
+	require.Contains(t, s, "export SLACK_WEBHOOK=https://hooks.example.com/x\n")
+	require.Contains(t, s, "# Source path: secret/personal/alice/ssh\n")
+	require.Contains(t, s, "export SSH_key=my-key\n")
+}
+
+func TestProcessJSONMergesIntoExistingFile(t *testing.T) {
+	p, _ := newProcessor(t)
+	out := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(out, []byte(`{"existing": "kept"}`), 0o644))
+
+	cfg := &Config{Jobs: []Job{{
+		Name:     "api",
+		Output:   out,
+		Format:   "json",
+		Sections: []Section{{Path: "secret/envs/dev/api", Fixed: map[string]string{"user": "{{ .Token.DisplayName }}"}}},
+	}}}
+	require.NoError(t, p.Process(context.Background(), cfg, ProcessorOptions{SortKeys: true}))
+
+	content, err := os.ReadFile(out)
+	require.NoError(t, err)
+	var got map[string]interface{}
+	require.NoError(t, json.Unmarshal(content, &got))
+	require.Equal(t, map[string]interface{}{
+		"existing":    "kept",
+		"token":       "t0k3n",
+		"internal-id": "42",
+		"user":        "oidc-alice",
+	}, got)
+}
+
+func TestProcessMissingSection(t *testing.T) {
+	p, _ := newProcessor(t)
+	out := filepath.Join(t.TempDir(), ".envrc")
+	cfg := &Config{Jobs: []Job{{
+		Name:     "dev",
+		Output:   out,
+		Sections: []Section{{Name: "missing", Path: "secret/envs/dev/missing"}, {Name: "db", Path: "secret/envs/dev/db"}},
+	}}}
+
+	err := p.Process(context.Background(), cfg, ProcessorOptions{})
+	require.Error(t, err)
+	require.True(t, errors.Is(err, vault.ErrNotFound), "expected ErrNotFound, got %v", err)
+	_, statErr := os.Stat(out)
+	require.True(t, os.IsNotExist(statErr))
+
+	require.NoError(t, p.Process(context.Background(), cfg, ProcessorOptions{SkipUnreadableSections: true}))
+	content, err := os.ReadFile(out)
+	require.NoError(t, err)
+	require.Contains(t, string(content), "export username=app\n")
+}
+
+func TestProcessSkippedSectionKeepsOwnedKeys(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "config.json")
+	job := Job{
+		Name:     "dev",
+		Output:   out,
+		Format:   "json",
+		Sections: []Section{{Name: "db", Path: "secret/envs/dev/db"}, {Name: "api", Path: "secret/envs/dev/api"}},
+	}
+	read := func() map[string]interface{} {
+		t.Helper()
+		content, err := os.ReadFile(out)
+		require.NoError(t, err)
+		var got map[string]interface{}
+		require.NoError(t, json.Unmarshal(content, &got))
+		return got
+	}
+	opts := ProcessorOptions{SortKeys: true, SkipUnreadableSections: true}
+
+	p, srv := newProcessor(t)
+	require.NoError(t, p.Process(context.Background(), &Config{Jobs: []Job{job}}, opts))
+	require.Equal(t, "app", read()["username"])
+
+	// A temporary 403 on db must not delete its keys from the output
+	srv.Deny("secret/data/envs/dev/db")
+	require.NoError(t, p.Process(context.Background(), &Config{Jobs: []Job{job}}, opts))
+	got := read()
+	require.Equal(t, "app", got["username"])
+	require.Equal(t, "t0k3n", got["token"])
+
+	// Once every section is read again, keys the job no longer writes are pruned as usual
+	p, _ = newProcessor(t)
+	job.Sections = job.Sections[1:]
+	require.NoError(t, p.Process(context.Background(), &Config{Jobs: []Job{job}}, opts))
+	got = read()
+	require.NotContains(t, got, "username")
+	require.Equal(t, "t0k3n", got["token"])
+}
+
+func TestProcessPermissionDenied(t *testing.T) {
+	p, srv := newProcessor(t)
+	srv.Deny("secret/data/envs/")
+	cfg := &Config{Jobs: []Job{{
+		Name:     "dev",
+		Output:   "-",
+		Sections: []Section{{Path: "secret/envs/dev/db"}},
+	}}}
+
+	err := p.Process(context.Background(), cfg, ProcessorOptions{})
+	require.True(t, errors.Is(err, vault.ErrPermissionDenied), "expected ErrPermissionDenied, got %v", err)
+}
+
+func TestProcessThroughSessionReadsEachPathOnce(t *testing.T) {
+	srv := vaulttest.NewServer(t)
+	srv.LoadFixture(filepath.Join("testdata", "vault.yaml"))
+	session := vault.NewSession(srv.Client(), nil)
+	p := &Processor{Client: session}
+	dir := t.TempDir()
+
+	cfg := &Config{Jobs: []Job{
+		{Name: "one", Output: filepath.Join(dir, "one.envrc"), Sections: []Section{{Path: "secret/envs/dev/db"}}},
+		{Name: "two", Output: filepath.Join(dir, "two.envrc"), Sections: []Section{{Path: "secret/envs/dev/db", Prefix: "DB_"}}},
+	}}
+	require.NoError(t, p.Process(context.Background(), cfg, ProcessorOptions{}))
+
+	reads := 0
+	for _, r := range srv.Requests() {
+		if r.Method == "GET" && r.Path == "secret/data/envs/dev/db" {
+			reads++
+		}
+	}
+	require.Equal(t, 1, reads)
+	require.EqualValues(t, 1, session.Stats().Reads)
+}
+
+func TestProcessKubernetesSecretSections(t *testing.T) {
+	p, _ := newProcessor(t)
+	out := filepath.Join(t.TempDir(), "secrets.yaml")
+
+	cfg := &Config{Jobs: []Job{{
+		Name:       "dev",
+		Output:     out,
+		Format:     "k8s-secret",
+		Kubernetes: &envrc.KubernetesOptions{Namespace: "apps", Labels: map[string]string{"app": "demo"}},
+		Sections: []Section{
+			{Name: "db", Path: "secret/envs/dev/db", IncludeKeys: []string{"username"}},
+			{Name: "api", Path: "secret/envs/dev/api", Kubernetes: &envrc.KubernetesOptions{StringData: true}},
+		},
+	}}}
+	require.NoError(t, p.Process(context.Background(), cfg, ProcessorOptions{}))
+
+	content, err := os.ReadFile(out)
+	require.NoError(t, err)
+	require.Equal(t, `---
+apiVersion: v1
+kind: Secret
+metadata:
+    name: dev-db
+    namespace: apps
+    labels:
+        app: demo
+type: Opaque
+data:
+    username: YXBw
+---
+apiVersion: v1
+kind: Secret
+metadata:
+    name: dev-api
+    namespace: apps
+    labels:
+        app: demo
+type: Opaque
+stringData:
+    internal-id: "42"
+    token: t0k3n
+`, string(content))
+}
+
+func TestProcessINISectionsMergeIntoOneFile(t *testing.T) {
+	p, _ := newProcessor(t)
+	out := filepath.Join(t.TempDir(), "app.ini")
+	require.NoError(t, os.WriteFile(out, []byte("[app]\nname = demo\n"), 0o644))
+
+	cfg := &Config{Jobs: []Job{{
+		Name:   "dev",
+		Output: out,
+		Format: "ini",
+		Sections: []Section{
+			{Name: "db", Path: "secret/envs/dev/db", IncludeKeys: []string{"username", "port"}},
+			{Name: "api", Path: "secret/envs/dev/api", IncludeKeys: []string{"token"}},
+		},
+	}}}
+	require.NoError(t, p.Process(context.Background(), cfg, ProcessorOptions{}))
+
+	content, err := os.ReadFile(out)
+	require.NoError(t, err)
+	require.Equal(t, "[api]\ntoken = t0k3n\n\n[app]\nname = demo\n\n[db]\nport = 5432\nusername = app\n", string(content))
+}
+
+func TestProcessDirOutput(t *testing.T) {
+	p, srv := newProcessor(t)
+	tmp := t.TempDir()
+	dir := filepath.Join(tmp, "secrets")
+	envrcPath := filepath.Join(tmp, ".envrc")
+	cfg := &Config{Jobs: []Job{{
+		Name:      "dev",
+		Output:    dir,
+		Format:    "dir",
+		FileEnvrc: envrcPath,
+		Sections:  []Section{{Name: "db", Path: "secret/envs/dev/db", Prefix: "DB_", Transform: boolPtr(true)}},
+	}}}
+	require.NoError(t, os.MkdirAll(dir, 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "UNRELATED"), []byte("x"), 0o600))
+	require.NoError(t, p.Process(context.Background(), cfg, ProcessorOptions{ForceOverwrite: true}))
+
+	content, err := os.ReadFile(filepath.Join(dir, "DB_PASSWORD"))
+	require.NoError(t, err)
+	require.Equal(t, "p@ss word", string(content))
+	fi, err := os.Stat(filepath.Join(dir, "DB_PASSWORD"))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o600), fi.Mode().Perm())
+
+	exports, err := os.ReadFile(envrcPath)
+	require.NoError(t, err)
+	require.Contains(t, string(exports), "export DB_PASSWORD_FILE="+filepath.Join(dir, "DB_PASSWORD")+"\n")
+
+	// Keys removed from Vault lose their file; files the tool did not write stay
+	srv.Put("secret/envs/dev/db", map[string]interface{}{"username": "app"})
+	require.NoError(t, p.Process(context.Background(), cfg, ProcessorOptions{ForceOverwrite: true}))
+	_, err = os.Stat(filepath.Join(dir, "DB_PASSWORD"))
+	require.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(dir, "DB_USERNAME"))
+	require.NoError(t, err)
+	_, err = os.Stat(filepath.Join(dir, "UNRELATED"))
+	require.NoError(t, err)
+}
+
+func boolPtr(b bool) *bool { return &b }
+
+func TestProcessManagedBlocks(t *testing.T) {
+	p, srv := newProcessor(t)
+	out := filepath.Join(t.TempDir(), ".envrc")
+	require.NoError(t, os.WriteFile(out, []byte("layout go\nPATH_add bin\n"), 0o600))
+
+	cfg := &Config{Jobs: []Job{
+		{Name: "db", Output: out, WriteMode: WriteModeBlock, Sections: []Section{{Name: "db", Path: "secret/envs/dev/db", Prefix: "DB_", Transform: boolPtr(true)}}},
+		{Name: "api", Output: out, WriteMode: WriteModeBlock, Sections: []Section{{Name: "api", Path: "secret/envs/dev/api", IncludeKeys: []string{"token"}}}},
+	}}
+	// No ForceOverwrite: blocks are updated without asking
+	require.NoError(t, p.Process(context.Background(), cfg, ProcessorOptions{SortKeys: true}))
+
+	srv.Put("secret/envs/dev/db", map[string]interface{}{"username": "rotated"})
+	require.NoError(t, p.Process(context.Background(), cfg, ProcessorOptions{SortKeys: true}))
+
+	content, err := os.ReadFile(out)
+	require.NoError(t, err)
+	s := string(content)
+	require.True(t, strings.HasPrefix(s, "layout go\nPATH_add bin\n\n# BEGIN vault-envrc-generator:db\n"), s)
+	require.Contains(t, s, "export DB_USERNAME=rotated\n")
+	require.NotContains(t, s, "DB_PASSWORD")
+	require.Contains(t, s, "# END vault-envrc-generator:db\n\n# BEGIN vault-envrc-generator:api\n")
+	require.Contains(t, s, "export token=t0k3n\n")
+	require.Equal(t, 1, strings.Count(s, "# BEGIN vault-envrc-generator:api"))
+	require.True(t, strings.HasSuffix(s, "# END vault-envrc-generator:api\n"), s)
+
+	cfg.Jobs[0].WriteMode = "append"
+	require.ErrorContains(t, p.Process(context.Background(), cfg, ProcessorOptions{}), `unknown write_mode "append"`)
+}
@@ -1,5 +1,15 @@
 package batch
 
+import "github.com/go-go-golems/vault-envrc-generator/pkg/envrc"
+
+// Write modes for outputs in formats with comments, such as envrc
+const (
+	// WriteModeOverwrite replaces the whole file after confirmation
+	WriteModeOverwrite = "overwrite"
+	// WriteModeBlock replaces only the job's managed block and keeps the rest of the file
+	WriteModeBlock = "block"
+)
+
 // Config represents the configuration for batch processing
 type Config struct {
 	BasePath string `yaml:"base_path"`
@@ -21,6 +31,11 @@ type Section struct {
 	Output      string            `yaml:"output,omitempty"`
 	EnvMap      map[string]string `yaml:"env_map,omitempty"`
 	Fixed       map[string]string `yaml:"fixed,omitempty"`
+	Quoting     string            `yaml:"quoting,omitempty"`
+	// FileEnvrc overrides the job's file_envrc
+	FileEnvrc string `yaml:"file_envrc,omitempty"`
+	// Kubernetes overrides the job's manifest settings for the k8s formats
+	Kubernetes *envrc.KubernetesOptions `yaml:"kubernetes,omitempty"`
 }
 
 // Job represents a single job in batch processing
@@ -39,4 +54,15 @@ type Job struct {
 	Sections    []Section         `yaml:"sections,omitempty"`
 	BasePath    string            `yaml:"base_path,omitempty"`
 	Fixed       map[string]string `yaml:"fixed,omitempty"`
+	Quoting     string            `yaml:"quoting,omitempty"`
+	// FileEnvrc is an envrc path that gets KEY_FILE exports for the files of a dir output
+	FileEnvrc string `yaml:"file_envrc,omitempty"`
+	// Kubernetes sets the manifest name, namespace, labels and annotations for the k8s formats
+	Kubernetes *envrc.KubernetesOptions `yaml:"kubernetes,omitempty"`
+	// Mode is the octal permission of the job's output files (default 0600)
+	Mode string `yaml:"mode,omitempty"`
+	// Backup keeps the previous content of each replaced output file in <output>.bak
+	Backup bool `yaml:"backup,omitempty"`
+	// WriteMode is WriteModeOverwrite (default) or WriteModeBlock
+	WriteMode string `yaml:"write_mode,omitempty"`
 }
@@ -1,6 +1,7 @@
 package diffenv
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"regexp"
@@ -43,12 +44,12 @@ type ChangedEntry struct {
 }
 
 // Compute builds the expected env mapping from the provided seed or batch config, and compares it to the current environment.
-func Compute(client *vault.Client, opts Options) (*Result, error) {
+func Compute(ctx context.Context, client vault.SecretStore, opts Options) (*Result, error) {
 	expected := map[string]string{}
 	expPaths := map[string]string{}
 
 	if strings.TrimSpace(opts.SeedPath) != "" {
-		exp, paths, err := expectedFromSeed(client, opts.SeedPath, opts.BasePath)
+		exp, paths, err := expectedFromSeed(ctx, client, opts.SeedPath, opts.BasePath)
 		if err != nil {
 			return nil, err
 		}
@@ -60,7 +61,7 @@ func Compute(client *vault.Client, opts Options) (*Result, error) {
 		}
 	}
 	if strings.TrimSpace(opts.BatchPath) != "" {
-		exp, paths, err := expectedFromBatch(client, opts.BatchPath, opts.BasePath)
+		exp, paths, err := expectedFromBatch(ctx, client, opts.BatchPath, opts.BasePath)
 		if err != nil {
 			return nil, err
 		}
@@ -108,7 +109,7 @@ func Compute(client *vault.Client, opts Options) (*Result, error) {
 	return res, nil
 }
 
-func expectedFromSeed(client *vault.Client, path string, baseOverride string) (map[string]string, map[string]string, error) {
+func expectedFromSeed(ctx context.Context, client vault.SecretStore, path string, baseOverride string) (map[string]string, map[string]string, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to read seed config: %w", err)
@@ -118,7 +119,7 @@ func expectedFromSeed(client *vault.Client, path string, baseOverride string) (m
 		return nil, nil, fmt.Errorf("failed to parse seed YAML: %w", err)
 	}
 
-	tctx, err := vault.BuildTemplateContext(client)
+	tctx, err := vault.BuildTemplateContext(ctx, client)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -135,12 +136,12 @@ func expectedFromSeed(client *vault.Client, path string, baseOverride string) (m
 	expected := map[string]string{}
 	paths := map[string]string{}
 	for _, set := range spec.Sets {
-		joined := vault.JoinBaseAndPath(base, set.Path)
+		joined := client.JoinBaseAndPath(ctx, base, set.Path)
 		rendered, err := vault.RenderTemplateString(joined, tctx)
 		if err != nil {
 			return nil, nil, err
 		}
-		secrets, err := client.GetSecrets(rendered)
+		secrets, err := vault.GetSecretsRef(ctx, client, rendered)
 		if err != nil {
 			continue
 		}
@@ -154,7 +155,7 @@ func expectedFromSeed(client *vault.Client, path string, baseOverride string) (m
 	return expected, paths, nil
 }
 
-func expectedFromBatch(client *vault.Client, path string, baseOverride string) (map[string]string, map[string]string, error) {
+func expectedFromBatch(ctx context.Context, client vault.SecretStore, path string, baseOverride string) (map[string]string, map[string]string, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to read batch config: %w", err)
@@ -164,7 +165,7 @@ func expectedFromBatch(client *vault.Client, path string, baseOverride string) (
 		return nil, nil, fmt.Errorf("failed to parse batch YAML: %w", err)
 	}
 
-	tctx, err := vault.BuildTemplateContext(client)
+	tctx, err := vault.BuildTemplateContext(ctx, client)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -189,12 +190,12 @@ func expectedFromBatch(client *vault.Client, path string, baseOverride string) (
 			}
 		}
 		for _, sec := range job.Sections {
-			joined := vault.JoinBaseAndPath(effBase, sec.Path)
+			joined := client.JoinBaseAndPath(ctx, effBase, sec.Path)
 			rendered, err := vault.RenderTemplateString(joined, tctx)
 			if err != nil {
 				return nil, nil, err
 			}
-			secrets, err := client.GetSecrets(rendered)
+			secrets, err := vault.GetSecretsRef(ctx, client, rendered)
 			if err != nil {
 				continue
 			}
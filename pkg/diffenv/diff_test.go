@@ -0,0 +1,89 @@
+package diffenv
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-go-golems/vault-envrc-generator/pkg/vaulttest"
+)
+
+const diffFixture = `
+secrets:
+  secret/dev/db:
+    username: app
+    password: s3cret
+    port: "5432"
+  secret/dev/api:
+    token: t0k3n
+`
+
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(p, []byte(content), 0o600))
+	return p
+}
+
+func TestComputeFromBatch(t *testing.T) {
+	srv := vaulttest.NewServer(t)
+	srv.LoadFixtureYAML([]byte(diffFixture))
+	client := srv.Client()
+
+	batchPath := writeConfig(t, "batch.yaml", `
+base_path: secret/dev
+jobs:
+  - name: dev
+    output: .envrc
+    sections:
+      - path: db
+        prefix: DB_
+        transform_keys: true
+        exclude_keys: [port]
+      - path: api
+        env_map:
+          API_TOKEN: token
+`)
+	t.Setenv("DB_USERNAME", "app")
+	t.Setenv("DB_PASSWORD", "outdated")
+	t.Setenv("API_TOKEN", "")
+	require.NoError(t, os.Unsetenv("API_TOKEN"))
+
+	res, err := Compute(context.Background(), client, Options{BatchPath: batchPath})
+	require.NoError(t, err)
+
+	require.Equal(t, []Entry{{Name: "DB_USERNAME", Value: "app", Path: "secret/dev/db"}}, res.Matches)
+	require.Equal(t, []ChangedEntry{{Name: "DB_PASSWORD", Vault: "s3cret", Env: "outdated", Path: "secret/dev/db"}}, res.Changed)
+	require.Equal(t, []Entry{{Name: "API_TOKEN", Value: "t0k3n", Path: "secret/dev/api"}}, res.MissingInEnv)
+	require.Empty(t, res.ExtraInEnv)
+}
+
+func TestComputeFromSeedWithBaseOverride(t *testing.T) {
+	srv := vaulttest.NewServer(t)
+	srv.LoadFixtureYAML([]byte(diffFixture))
+	client := srv.Client()
+
+	seedPath := writeConfig(t, "seed.yaml", `
+base_path: secret/prod
+sets:
+  - path: db
+    env:
+      username: DIFFENV_DB_USER
+      port: DIFFENV_DB_PORT
+  - path: missing
+    env:
+      anything: DIFFENV_NEVER
+`)
+	t.Setenv("DIFFENV_DB_USER", "app")
+	t.Setenv("DIFFENV_DB_PORT", "5433")
+
+	res, err := Compute(context.Background(), client, Options{SeedPath: seedPath, BasePath: "secret/dev"})
+	require.NoError(t, err)
+
+	require.Equal(t, []Entry{{Name: "DIFFENV_DB_USER", Value: "app", Path: "secret/dev/db"}}, res.Matches)
+	require.Equal(t, []ChangedEntry{{Name: "DIFFENV_DB_PORT", Vault: "5432", Env: "5433", Path: "secret/dev/db"}}, res.Changed)
+	require.Empty(t, res.MissingInEnv)
+}
@@ -0,0 +1,65 @@
+package envrc
+
+import (
+	"fmt"
+	"strings"
+)
+
+// blockMarker is the comment text that opens and closes a managed block
+const blockMarker = "vault-envrc-generator:"
+
+// BlockMarkers returns the comment lines that open and close the managed block name
+func BlockMarkers(c Commenter, name string) (begin, end string) {
+	return c.Comment("BEGIN " + blockMarker + name), c.Comment("END " + blockMarker + name)
+}
+
+// ReplaceBlock replaces the content between the begin and end markers of the managed block
+// name in existing with doc. A missing block is appended after a blank line. Everything outside
+// the block is kept byte for byte.
+func ReplaceBlock(c Commenter, existing []byte, name, doc string) ([]byte, error) {
+	begin, end := BlockMarkers(c, name)
+	if doc != "" && !strings.HasSuffix(doc, "\n") {
+		doc += "\n"
+	}
+	block := begin + "\n" + doc + end + "\n"
+
+	text := string(existing)
+	start, stop := -1, -1
+	for offset := 0; offset < len(text); {
+		lineEnd := strings.IndexByte(text[offset:], '\n')
+		next := len(text)
+		if lineEnd >= 0 {
+			next = offset + lineEnd + 1
+		}
+		switch strings.TrimRight(text[offset:next], " \t\r\n") {
+		case begin:
+			if start >= 0 {
+				return nil, fmt.Errorf("managed block %q is opened twice", name)
+			}
+			start = offset
+		case end:
+			if start < 0 {
+				return nil, fmt.Errorf("managed block %q is closed before it is opened", name)
+			}
+			if stop < 0 {
+				stop = next
+			}
+		}
+		offset = next
+	}
+
+	switch {
+	case start < 0:
+		if text == "" {
+			return []byte(block), nil
+		}
+		if !strings.HasSuffix(text, "\n") {
+			text += "\n"
+		}
+		return []byte(text + "\n" + block), nil
+	case stop < 0:
+		return nil, fmt.Errorf("managed block %q has no %q line", name, end)
+	default:
+		return []byte(text[:start] + block + text[stop:]), nil
+	}
+}
@@ -0,0 +1,33 @@
+package envrc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplaceBlock(t *testing.T) {
+	c := envrcFormatter{}
+
+	out, err := ReplaceBlock(c, nil, "dev", "export A=1\n")
+	require.NoError(t, err)
+	require.Equal(t, "# BEGIN vault-envrc-generator:dev\nexport A=1\n# END vault-envrc-generator:dev\n", string(out))
+
+	// A missing block is appended; hand-written lines stay as they are
+	existing := "layout go\nPATH_add bin"
+	out, err = ReplaceBlock(c, []byte(existing), "dev", "export A=1")
+	require.NoError(t, err)
+	require.Equal(t, "layout go\nPATH_add bin\n\n# BEGIN vault-envrc-generator:dev\nexport A=1\n# END vault-envrc-generator:dev\n", string(out))
+
+	existing = "layout go\r\n# BEGIN vault-envrc-generator:dev\r\nexport A=old\r\n# END vault-envrc-generator:dev\r\n" +
+		"# BEGIN vault-envrc-generator:prod\nexport B=2\n# END vault-envrc-generator:prod\n  PATH_add bin  \n"
+	out, err = ReplaceBlock(c, []byte(existing), "dev", "export A=new\n")
+	require.NoError(t, err)
+	require.Equal(t, "layout go\r\n# BEGIN vault-envrc-generator:dev\nexport A=new\n# END vault-envrc-generator:dev\n"+
+		"# BEGIN vault-envrc-generator:prod\nexport B=2\n# END vault-envrc-generator:prod\n  PATH_add bin  \n", string(out))
+
+	_, err = ReplaceBlock(c, []byte("# BEGIN vault-envrc-generator:dev\nexport A=1\n"), "dev", "")
+	require.ErrorContains(t, err, `managed block "dev" has no "# END vault-envrc-generator:dev" line`)
+	_, err = ReplaceBlock(c, []byte("# BEGIN vault-envrc-generator:dev\n# BEGIN vault-envrc-generator:dev\n"), "dev", "")
+	require.ErrorContains(t, err, "opened twice")
+}
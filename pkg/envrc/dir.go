@@ -0,0 +1,90 @@
+package envrc
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// FileSet is implemented by formats whose output is a directory with one file per key rather
+// than a single file. output.Write writes the files instead of the rendered document.
+type FileSet interface {
+	Formatter
+	// Files decodes a rendered document into file names and contents
+	Files(doc string) (map[string]string, error)
+}
+
+// dirFormatter renders the files of a secrets directory as a JSON object of file name to
+// content, which is also what dry runs print
+type dirFormatter struct{}
+
+func (dirFormatter) Name() string { return "dir" }
+
+func (dirFormatter) Render(values map[string]interface{}, _ FormatOptions) (string, error) {
+	files := make(map[string]interface{}, len(values))
+	for key, value := range values {
+		if err := checkFileName(key); err != nil {
+			return "", fmt.Errorf("dir format: %w", err)
+		}
+		files[key] = formatValue(value)
+	}
+	b, err := marshalJSON(files, true)
+	return string(b), err
+}
+
+// Merge returns doc: the directory is rewritten as a whole and stale files are removed
+func (dirFormatter) Merge(_ []byte, doc string, _ FormatOptions) ([]byte, error) {
+	return []byte(doc), nil
+}
+
+func (dirFormatter) Aggregate(docs []string, _ FormatOptions) (string, error) {
+	merged := map[string]interface{}{}
+	if err := mergeDocs(merged, docs, json.Unmarshal); err != nil {
+		return "", fmt.Errorf("failed to parse generated dir files for aggregation: %w", err)
+	}
+	b, err := marshalJSON(merged, true)
+	return string(b), err
+}
+
+func (dirFormatter) Files(doc string) (map[string]string, error) {
+	var files map[string]string
+	if err := json.Unmarshal([]byte(doc), &files); err != nil {
+		return nil, fmt.Errorf("failed to parse generated dir files: %w", err)
+	}
+	for name := range files {
+		if err := checkFileName(name); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+var _ FileSet = dirFormatter{}
+
+// checkFileName rejects keys that are not a plain file name. Hidden names are reserved for
+// the directory's bookkeeping.
+func checkFileName(key string) error {
+	if key == "" || key == "." || key == ".." || strings.ContainsAny(key, "/\\\x00") || strings.HasPrefix(key, ".") {
+		return fmt.Errorf("%q cannot be used as a file name", key)
+	}
+	return nil
+}
+
+// FileExports renders envrc lines exporting KEY_FILE for each file of a dir format document,
+// set to the absolute path the file is written to under dir
+func FileExports(dir, doc string, opts FormatOptions) (string, error) {
+	files, err := dirFormatter{}.Files(doc)
+	if err != nil {
+		return "", err
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	vars := make(map[string]interface{}, len(files))
+	for name := range files {
+		vars[name+"_FILE"] = filepath.Join(abs, name)
+	}
+	return envrcFormatter{}.Render(vars, opts)
+}
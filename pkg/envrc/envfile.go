@@ -0,0 +1,103 @@
+package envrc
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// envFileFormatter renders plain KEY=value lines without `export`. Each consumer parses these
+// files differently, so every format brings its own key check and quoting, and returns an
+// error for values the consumer cannot read back unchanged.
+type envFileFormatter struct {
+	lineFile
+	name     string
+	validKey func(string) bool
+	quote    func(string) (string, error)
+}
+
+func (f envFileFormatter) Name() string { return f.name }
+
+func (f envFileFormatter) Render(values map[string]interface{}, opts FormatOptions) (string, error) {
+	var buf strings.Builder
+	if !opts.SuppressHeader {
+		buf.WriteString(generatedHeader("# "))
+	}
+	for _, key := range sortedKeys(values) {
+		if !f.validKey(key) {
+			return "", fmt.Errorf("%s format cannot represent key %q", f.name, key)
+		}
+		value, err := f.quote(formatValue(values[key]))
+		if err != nil {
+			return "", fmt.Errorf("%s format cannot represent the value of %s: %w", f.name, key, err)
+		}
+		fmt.Fprintf(&buf, "%s=%s\n", key, value)
+	}
+	return buf.String(), nil
+}
+
+var (
+	_ Formatter = envFileFormatter{}
+	_ Commenter = envFileFormatter{}
+)
+
+var (
+	envName    = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	dotenvName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+)
+
+// dotenvQuote targets the dotenv dialect shared by godotenv, python-dotenv, the Node dotenv
+// package and docker compose: single quotes are literal and may span lines, double quotes
+// expand \n and ${VAR}. Values are single-quoted unless they contain a single quote.
+func dotenvQuote(value string) (string, error) {
+	if value == "" {
+		return "''", nil
+	}
+	if hasControlChars(value) {
+		return "", fmt.Errorf("control characters other than newline and tab are not supported")
+	}
+	if isShellWord(value) {
+		return value, nil
+	}
+	if !strings.Contains(value, "'") {
+		return "'" + value + "'", nil
+	}
+	if strings.ContainsAny(value, `$\`) {
+		return "", fmt.Errorf("a value with both ' and $ or \\ cannot be quoted portably")
+	}
+	r := strings.NewReplacer(`"`, `\"`, "\n", `\n`)
+	return `"` + r.Replace(value) + `"`, nil
+}
+
+// systemdQuote follows systemd's EnvironmentFile= parser: inside double quotes a backslash
+// escapes ", \, ` and $, and newlines are kept
+func systemdQuote(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	if hasControlChars(value) {
+		return "", fmt.Errorf("control characters other than newline and tab are not supported")
+	}
+	if isShellWord(value) {
+		return value, nil
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "`", "\\`", `$`, `\$`)
+	return `"` + r.Replace(value) + `"`, nil
+}
+
+// dockerQuote follows `docker run --env-file`, which takes everything after the first = of
+// a line verbatim: there is no quoting at all, so values cannot contain line breaks
+func dockerQuote(value string) (string, error) {
+	if strings.ContainsAny(value, "\n\r\x00") {
+		return "", fmt.Errorf("line breaks and NUL bytes are not supported")
+	}
+	if !utf8.ValidString(value) {
+		return "", fmt.Errorf("value is not valid UTF-8")
+	}
+	return value, nil
+}
+
+func dockerKey(key string) bool {
+	return key != "" && !strings.ContainsAny(key, "= \t\n\v\f\r") && !strings.HasPrefix(key, "#")
+}
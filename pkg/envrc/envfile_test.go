@@ -0,0 +1,67 @@
+package envrc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvFileQuoting(t *testing.T) {
+	tests := []struct {
+		quote func(string) (string, error)
+		value string
+		want  string
+	}{
+		{dotenvQuote, "app", "app"},
+		{dotenvQuote, "", "''"},
+		{dotenvQuote, "pa$$ word", "'pa$$ word'"},
+		{dotenvQuote, "line1\nline2", "'line1\nline2'"},
+		{dotenvQuote, `it's "here"`, `"it's \"here\""`},
+		{dotenvQuote, "it's\nhere", `"it's\nhere"`},
+		{systemdQuote, "app", "app"},
+		{systemdQuote, "", ""},
+		{systemdQuote, "pa$$ `word`", "\"pa\\$\\$ \\`word\\`\""},
+		{systemdQuote, `it's "C:\dir"`, `"it's \"C:\\dir\""`},
+		{systemdQuote, "line1\nline2", "\"line1\nline2\""},
+		{dockerQuote, `"quoted" $HOME 'x'`, `"quoted" $HOME 'x'`},
+		{dockerQuote, "", ""},
+	}
+	for _, tt := range tests {
+		got, err := tt.quote(tt.value)
+		require.NoError(t, err, "value %q", tt.value)
+		require.Equal(t, tt.want, got, "value %q", tt.value)
+	}
+
+	for _, tt := range []struct {
+		quote func(string) (string, error)
+		value string
+	}{
+		{dotenvQuote, "it's $HOME"},
+		{dotenvQuote, "a\rb"},
+		{systemdQuote, "a\x1bb"},
+		{dockerQuote, "line1\nline2"},
+		{dockerQuote, "a\rb"},
+	} {
+		_, err := tt.quote(tt.value)
+		require.Error(t, err, "value %q", tt.value)
+	}
+}
+
+func TestEnvFileFormats(t *testing.T) {
+	secrets := map[string]interface{}{"DB_PASSWORD": "p@ss word", "PORT": 5432}
+
+	for format, want := range map[string]string{
+		"dotenv":      "DB_PASSWORD='p@ss word'\nPORT=5432\n",
+		"systemd-env": "DB_PASSWORD=\"p@ss word\"\nPORT=5432\n",
+		"docker-env":  "DB_PASSWORD=p@ss word\nPORT=5432\n",
+	} {
+		got, err := NewGenerator(&Options{Format: format, SuppressHeader: true}).Generate(secrets)
+		require.NoError(t, err, format)
+		require.Equal(t, want, got, format)
+	}
+
+	_, err := NewGenerator(&Options{Format: "docker-env"}).Generate(map[string]interface{}{"CERT": testPEM})
+	require.ErrorContains(t, err, "docker-env format cannot represent the value of CERT")
+	_, err = NewGenerator(&Options{Format: "systemd-env"}).Generate(map[string]interface{}{"internal-id": "42"})
+	require.ErrorContains(t, err, `systemd-env format cannot represent key "internal-id"`)
+}
@@ -0,0 +1,321 @@
+package envrc
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultFormat is used when no format is given
+const DefaultFormat = "envrc"
+
+// FormatOptions controls how a Formatter renders values
+type FormatOptions struct {
+	SortKeys       bool
+	SuppressHeader bool
+	Quoting        string
+	// Section groups the values in formats with sections, such as the INI [section] header
+	Section string
+	// Kubernetes holds the manifest metadata for the k8s-secret and k8s-configmap formats
+	Kubernetes *KubernetesOptions
+	// Prune lists keys that Merge removes from the existing file of a Keyed format
+	Prune []KeyPath
+}
+
+// Formatter renders secrets in one output format. Formats are registered with RegisterFormatter
+// and looked up by name, so generate, batch, interactive and output.Write all support the same set.
+type Formatter interface {
+	// Name is the value accepted by --format and the `format` config field
+	Name() string
+	// Render renders values as a document
+	Render(values map[string]interface{}, opts FormatOptions) (string, error)
+	// Merge combines a rendered document with the existing content of the output file
+	Merge(existing []byte, doc string, opts FormatOptions) ([]byte, error)
+	// Aggregate combines documents rendered for the same output, e.g. batch sections on stdout
+	Aggregate(docs []string, opts FormatOptions) (string, error)
+}
+
+// Commenter is implemented by line-oriented formats that support comments. Batch writes such
+// outputs as whole files with a comment header per section instead of merging them.
+type Commenter interface {
+	Comment(text string) string
+}
+
+var registry = struct {
+	mu         sync.RWMutex
+	formatters map[string]Formatter
+}{formatters: map[string]Formatter{}}
+
+// RegisterFormatter makes f available under f.Name(), replacing any formatter with that name
+func RegisterFormatter(f Formatter) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	registry.formatters[f.Name()] = f
+}
+
+// LookupFormatter returns the formatter registered under name; an empty name selects DefaultFormat
+func LookupFormatter(name string) (Formatter, error) {
+	if name == "" {
+		name = DefaultFormat
+	}
+	registry.mu.RLock()
+	f, ok := registry.formatters[name]
+	registry.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown format %q (supported: %s)", name, strings.Join(FormatNames(), ", "))
+	}
+	return f, nil
+}
+
+// FormatNames returns the names of all registered formats, sorted
+func FormatNames() []string {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+	names := make([]string, 0, len(registry.formatters))
+	for name := range registry.formatters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func init() {
+	RegisterFormatter(envrcFormatter{})
+	RegisterFormatter(jsonFormatter{})
+	RegisterFormatter(yamlFormatter{})
+	RegisterFormatter(envFileFormatter{name: "dotenv", validKey: dotenvName.MatchString, quote: dotenvQuote})
+	RegisterFormatter(envFileFormatter{name: "systemd-env", validKey: envName.MatchString, quote: systemdQuote})
+	RegisterFormatter(envFileFormatter{name: "docker-env", validKey: dockerKey, quote: dockerQuote})
+	RegisterFormatter(shellFormatter{name: "fish", line: fishLine})
+	RegisterFormatter(shellFormatter{name: "nushell", open: "load-env {\n", close: "}\n", line: nushellLine})
+	RegisterFormatter(shellFormatter{name: "powershell", line: powershellLine})
+	RegisterFormatter(tomlFormatter{})
+	RegisterFormatter(kvFormatter{name: "tfvars", checkKey: tfvarsCheckKey, encode: tfvarsEncode, parse: parseTfvars, write: writeTfvars})
+	RegisterFormatter(kvFormatter{name: "properties", checkKey: propertiesCheckKey, encode: propertiesEncode, parse: parseProperties, write: writeProperties})
+	RegisterFormatter(kvFormatter{name: "ini", sections: true, checkKey: iniCheckKey, encode: iniEncode, parse: parseINI, write: writeINI})
+	RegisterFormatter(kubernetesFormatter{name: "k8s-secret", kind: "Secret"})
+	RegisterFormatter(dirFormatter{})
+	RegisterFormatter(kubernetesFormatter{name: "k8s-configmap", kind: "ConfigMap"})
+}
+
+// lineFile implements Merge, Aggregate and Comment for line-oriented KEY=value formats
+type lineFile struct{}
+
+// Merge appends the document, keeping whatever the file already contains
+func (lineFile) Merge(existing []byte, doc string, _ FormatOptions) ([]byte, error) {
+	return append(append([]byte{}, existing...), doc...), nil
+}
+
+func (lineFile) Aggregate(docs []string, _ FormatOptions) (string, error) {
+	return strings.Join(docs, ""), nil
+}
+
+func (lineFile) Comment(text string) string { return "# " + text }
+
+// envrcFormatter renders `export KEY=value` lines for direnv
+type envrcFormatter struct{ lineFile }
+
+func (envrcFormatter) Name() string { return "envrc" }
+
+func (envrcFormatter) Render(values map[string]interface{}, opts FormatOptions) (string, error) {
+	var buf strings.Builder
+	if !opts.SuppressHeader {
+		buf.WriteString(generatedHeader("# "))
+	}
+	for _, key := range sortedKeys(values) {
+		// Keys are not quoted, so anything but a plain name would be shell syntax
+		if !envName.MatchString(key) {
+			return "", fmt.Errorf("envrc format cannot represent key %q", key)
+		}
+		value := formatValue(values[key])
+		if opts.Quoting == QuotingRaw {
+			value = rawQuote(value)
+		} else {
+			value = ShellQuote(value)
+		}
+		fmt.Fprintf(&buf, "export %s=%s\n", key, value)
+	}
+	return buf.String(), nil
+}
+
+// jsonFormatter renders a flat, indented JSON object
+type jsonFormatter struct{}
+
+func (jsonFormatter) Name() string { return "json" }
+
+func (jsonFormatter) Render(values map[string]interface{}, opts FormatOptions) (string, error) {
+	b, err := marshalJSON(values, opts.SortKeys)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal secrets to JSON: %w", err)
+	}
+	return string(b), nil
+}
+
+// Merge deep-merges the document into the existing object after removing opts.Prune;
+// unparsable files are replaced
+func (jsonFormatter) Merge(existing []byte, doc string, opts FormatOptions) ([]byte, error) {
+	merged := map[string]interface{}{}
+	if len(existing) > 0 {
+		_ = json.Unmarshal(existing, &merged)
+		if merged == nil {
+			merged = map[string]interface{}{}
+		}
+	}
+	pruneKeys(merged, opts.Prune)
+	if err := mergeDocs(merged, []string{doc}, json.Unmarshal); err != nil {
+		return nil, fmt.Errorf("failed to parse generated JSON for merge: %w", err)
+	}
+	return marshalJSON(merged, opts.SortKeys)
+}
+
+func (jsonFormatter) Aggregate(docs []string, opts FormatOptions) (string, error) {
+	merged := map[string]interface{}{}
+	if err := mergeDocs(merged, docs, json.Unmarshal); err != nil {
+		return "", fmt.Errorf("failed to parse generated JSON for aggregation: %w", err)
+	}
+	b, err := marshalJSON(merged, opts.SortKeys)
+	return string(b), err
+}
+
+func (jsonFormatter) Keys(doc string) ([]KeyPath, error) {
+	return docKeys(doc, json.Unmarshal)
+}
+
+// yamlFormatter renders a flat YAML mapping
+type yamlFormatter struct{}
+
+func (yamlFormatter) Name() string { return "yaml" }
+
+func (yamlFormatter) Render(values map[string]interface{}, opts FormatOptions) (string, error) {
+	b, err := marshalYAML(values, opts.SortKeys)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal secrets to YAML: %w", err)
+	}
+	return string(b), nil
+}
+
+// Merge deep-merges the document into the existing mapping after removing opts.Prune;
+// unparsable files are replaced
+func (yamlFormatter) Merge(existing []byte, doc string, opts FormatOptions) ([]byte, error) {
+	merged := map[string]interface{}{}
+	if len(existing) > 0 {
+		_ = yaml.Unmarshal(existing, &merged)
+		if merged == nil {
+			merged = map[string]interface{}{}
+		}
+	}
+	pruneKeys(merged, opts.Prune)
+	if err := mergeDocs(merged, []string{doc}, yaml.Unmarshal); err != nil {
+		return nil, fmt.Errorf("failed to parse generated YAML for merge: %w", err)
+	}
+	return marshalYAML(merged, opts.SortKeys)
+}
+
+func (yamlFormatter) Aggregate(docs []string, opts FormatOptions) (string, error) {
+	merged := map[string]interface{}{}
+	if err := mergeDocs(merged, docs, yaml.Unmarshal); err != nil {
+		return "", fmt.Errorf("failed to parse generated YAML for aggregation: %w", err)
+	}
+	if len(merged) == 0 {
+		return "", nil
+	}
+	b, err := marshalYAML(merged, opts.SortKeys)
+	return string(b), err
+}
+
+func (yamlFormatter) Keys(doc string) ([]KeyPath, error) {
+	return docKeys(doc, yaml.Unmarshal)
+}
+
+// tomlFormatter renders a flat TOML table of strings
+type tomlFormatter struct{}
+
+func (tomlFormatter) Name() string { return "toml" }
+
+func (tomlFormatter) Render(values map[string]interface{}, _ FormatOptions) (string, error) {
+	strs := make(map[string]interface{}, len(values))
+	for k, v := range values {
+		strs[k] = formatValue(v)
+	}
+	b, err := toml.Marshal(strs)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal secrets to TOML: %w", err)
+	}
+	return string(b), nil
+}
+
+// Merge deep-merges the document into the existing file after removing opts.Prune; tables
+// and other values in the file are kept, comments are not. An unparsable file is an error.
+func (tomlFormatter) Merge(existing []byte, doc string, opts FormatOptions) ([]byte, error) {
+	merged := map[string]interface{}{}
+	if err := toml.Unmarshal(existing, &merged); err != nil {
+		return nil, fmt.Errorf("failed to parse existing TOML output for merge: %w", err)
+	}
+	pruneKeys(merged, opts.Prune)
+	if err := mergeDocs(merged, []string{doc}, toml.Unmarshal); err != nil {
+		return nil, fmt.Errorf("failed to parse generated TOML for merge: %w", err)
+	}
+	return toml.Marshal(merged)
+}
+
+func (tomlFormatter) Aggregate(docs []string, _ FormatOptions) (string, error) {
+	merged := map[string]interface{}{}
+	if err := mergeDocs(merged, docs, toml.Unmarshal); err != nil {
+		return "", fmt.Errorf("failed to parse generated TOML for aggregation: %w", err)
+	}
+	b, err := toml.Marshal(merged)
+	return string(b), err
+}
+
+func (tomlFormatter) Keys(doc string) ([]KeyPath, error) {
+	return docKeys(doc, toml.Unmarshal)
+}
+
+var (
+	_ Keyed     = tomlFormatter{}
+	_ Formatter = envrcFormatter{}
+	_ Commenter = envrcFormatter{}
+	_ Keyed     = jsonFormatter{}
+	_ Keyed     = yamlFormatter{}
+)
+
+// mergeDocs decodes each document into a map and deep-merges it into dst in order
+func mergeDocs(dst map[string]interface{}, docs []string, unmarshal func([]byte, interface{}) error) error {
+	for _, doc := range docs {
+		var next map[string]interface{}
+		if err := unmarshal([]byte(doc), &next); err != nil {
+			return err
+		}
+		deepMerge(dst, next)
+	}
+	return nil
+}
+
+func marshalJSON(values map[string]interface{}, sortKeys bool) ([]byte, error) {
+	if sortKeys {
+		// Called directly: json.Marshal would compact the pretty-printed output
+		return orderedMap{keys: sortedKeys(values), m: values}.MarshalJSON()
+	}
+	return json.MarshalIndent(values, "", "  ")
+}
+
+func marshalYAML(values map[string]interface{}, sortKeys bool) ([]byte, error) {
+	if sortKeys {
+		return yaml.Marshal(orderedMap{keys: sortedKeys(values), m: values})
+	}
+	return yaml.Marshal(values)
+}
+
+func sortedKeys(values map[string]interface{}) []string {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
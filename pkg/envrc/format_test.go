@@ -0,0 +1,112 @@
+package envrc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLookupFormatter(t *testing.T) {
+	require.Subset(t, FormatNames(), []string{"envrc", "json", "yaml"})
+
+	f, err := LookupFormatter("")
+	require.NoError(t, err)
+	require.Equal(t, DefaultFormat, f.Name())
+
+	_, err = LookupFormatter("xml")
+	require.ErrorContains(t, err, `unknown format "xml" (supported: `)
+
+	_, err = NewGenerator(&Options{Format: "xml"}).Generate(map[string]interface{}{"A": "1"})
+	require.ErrorContains(t, err, `unknown format "xml"`)
+}
+
+func TestJSONFormatterMergeAndAggregate(t *testing.T) {
+	f, err := LookupFormatter("json")
+	require.NoError(t, err)
+	opts := FormatOptions{SortKeys: true}
+
+	agg, err := f.Aggregate([]string{`{"B": "1", "A": "old"}`, `{"A": "new"}`}, opts)
+	require.NoError(t, err)
+	require.Equal(t, "{\n  \"A\": \"new\",\n  \"B\": \"1\"\n}", agg)
+
+	merged, err := f.Merge([]byte(`{"C": "keep", "B": "old"}`), agg, opts)
+	require.NoError(t, err)
+	require.Equal(t, "{\n  \"A\": \"new\",\n  \"B\": \"1\",\n  \"C\": \"keep\"\n}", string(merged))
+
+	// Unparsable existing content is replaced
+	merged, err = f.Merge([]byte("not json"), `{"A": "1"}`, opts)
+	require.NoError(t, err)
+	require.Equal(t, "{\n  \"A\": \"1\"\n}", string(merged))
+}
+
+func TestEnvrcFormatterAggregate(t *testing.T) {
+	f, err := LookupFormatter("envrc")
+	require.NoError(t, err)
+	opts := FormatOptions{SortKeys: true, SuppressHeader: true}
+
+	first, err := f.Render(map[string]interface{}{"B": "2", "A": "1"}, opts)
+	require.NoError(t, err)
+	second, err := f.Render(map[string]interface{}{"C": "x y"}, opts)
+	require.NoError(t, err)
+	agg, err := f.Aggregate([]string{first, second}, opts)
+	require.NoError(t, err)
+	require.Equal(t, "export A=1\nexport B=2\nexport C='x y'\n", agg)
+	require.Equal(t, "# note", f.(Commenter).Comment("note"))
+
+	for _, key := range []string{"X;touch ~/pwned;Y", "A B", "$(id)", "1ABC", "A-B", ""} {
+		_, err := f.Render(map[string]interface{}{"OK": "1", key: "v"}, opts)
+		require.ErrorContains(t, err, "envrc format cannot represent key", key)
+	}
+}
+
+func TestDirFormat(t *testing.T) {
+	f, err := LookupFormatter("dir")
+	require.NoError(t, err)
+	fs, ok := f.(FileSet)
+	require.True(t, ok)
+
+	doc, err := f.Render(map[string]interface{}{"TOKEN": "t0k3n", "PORT": 5432}, FormatOptions{})
+	require.NoError(t, err)
+	files, err := fs.Files(doc)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"TOKEN": "t0k3n", "PORT": "5432"}, files)
+
+	for _, key := range []string{"../escape", "a/b", ".hidden", ""} {
+		_, err := f.Render(map[string]interface{}{key: "x"}, FormatOptions{})
+		require.ErrorContains(t, err, "cannot be used as a file name", key)
+	}
+
+	exports, err := FileExports("/run/secrets", doc, FormatOptions{SuppressHeader: true})
+	require.NoError(t, err)
+	require.Equal(t, "export PORT_FILE=/run/secrets/PORT\nexport TOKEN_FILE=/run/secrets/TOKEN\n", exports)
+}
+
+func TestStructuredMergeDeepAndPrune(t *testing.T) {
+	for _, format := range []string{"json", "yaml"} {
+		f, err := LookupFormatter(format)
+		require.NoError(t, err)
+		keyed, ok := f.(Keyed)
+		require.True(t, ok, format)
+		opts := FormatOptions{SortKeys: true}
+
+		existing, err := f.Render(map[string]interface{}{
+			"db":     map[string]interface{}{"host": "old", "extra": "hand"},
+			"stale":  "x",
+			"nested": map[string]interface{}{"gone": "x"},
+		}, opts)
+		require.NoError(t, err)
+		doc, err := f.Render(map[string]interface{}{"db": map[string]interface{}{"host": "new"}, "token": "t"}, opts)
+		require.NoError(t, err)
+
+		keys, err := keyed.Keys(doc)
+		require.NoError(t, err)
+		require.Equal(t, []KeyPath{{"db", "host"}, {"token"}}, keys)
+
+		opts.Prune = []KeyPath{{"stale"}, {"nested", "gone"}, {"db", "host"}}
+		merged, err := f.Merge([]byte(existing), doc, opts)
+		require.NoError(t, err)
+		want, err := f.Render(map[string]interface{}{"db": map[string]interface{}{"host": "new", "extra": "hand"}, "token": "t"}, FormatOptions{SortKeys: true})
+		require.NoError(t, err)
+		require.Equal(t, want, string(merged), format)
+	}
+}
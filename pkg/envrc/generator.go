@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"os"
 	"regexp"
-	"sort"
 	"strings"
 	"text/template"
 	"time"
@@ -25,6 +24,12 @@ type Options struct {
 	Verbose        bool
 	SuppressHeader bool
 	SortKeys       bool
+	// Quoting selects how envrc values are quoted: QuotingSafe (default) or QuotingRaw
+	Quoting string
+	// Section names the section the values are written to in formats with sections (INI)
+	Section string
+	// Kubernetes sets the manifest name, namespace, labels and annotations for the k8s formats
+	Kubernetes *KubernetesOptions
 }
 
 // Generator handles the generation of .envrc files
@@ -42,6 +47,16 @@ func NewGenerator(options *Options) *Generator {
 
 // Generate creates the .envrc content from the given secrets
 func (g *Generator) Generate(secrets map[string]interface{}) (string, error) {
+	switch g.options.Quoting {
+	case "", QuotingSafe, QuotingRaw:
+	default:
+		return "", fmt.Errorf("unknown quoting mode %q (expected %s or %s)", g.options.Quoting, QuotingSafe, QuotingRaw)
+	}
+	f, err := LookupFormatter(g.options.Format)
+	if err != nil {
+		return "", err
+	}
+
 	// Filter secrets based on include/exclude rules
 	filteredSecrets := g.filterSecrets(secrets)
 
@@ -55,17 +70,16 @@ func (g *Generator) Generate(secrets map[string]interface{}) (string, error) {
 		filteredSecrets = g.addPrefix(filteredSecrets)
 	}
 
-	// Generate content based on format
-	switch g.options.Format {
-	case "json":
-		return g.generateJSON(filteredSecrets)
-	case "yaml":
-		return g.generateYAML(filteredSecrets)
-	case "envrc":
-		fallthrough
-	default:
-		return g.generateEnvrc(filteredSecrets)
+	if g.options.TemplateFile != "" && f.Name() == "envrc" {
+		return g.generateFromTemplate(filteredSecrets)
 	}
+	return f.Render(filteredSecrets, FormatOptions{
+		SortKeys:       g.options.SortKeys,
+		SuppressHeader: g.options.SuppressHeader,
+		Quoting:        g.options.Quoting,
+		Section:        g.options.Section,
+		Kubernetes:     g.options.Kubernetes,
+	})
 }
 
 // filterSecrets applies include/exclude filters to the secrets
@@ -132,44 +146,6 @@ func (g *Generator) addPrefix(secrets map[string]interface{}) map[string]interfa
 	return result
 }
 
-// generateEnvrc creates .envrc format content
-func (g *Generator) generateEnvrc(secrets map[string]interface{}) (string, error) {
-	if g.options.TemplateFile != "" {
-		return g.generateFromTemplate(secrets)
-	}
-
-	var buf bytes.Buffer
-
-	// Add header comment
-	if !g.options.SuppressHeader {
-		buf.WriteString("# Generated by vault-envrc-generator\n")
-		fmt.Fprintf(&buf, "# Generated at: %s\n", time.Now().Format(time.RFC3339))
-		buf.WriteString("# Source: HashiCorp Vault\n\n")
-	}
-
-	// Sort keys for consistent output
-	keys := make([]string, 0, len(secrets))
-	for key := range secrets {
-		keys = append(keys, key)
-	}
-	sort.Strings(keys)
-
-	// Generate export statements
-	for _, key := range keys {
-		value := secrets[key]
-
-		// Convert value to string, handling different types
-		valueStr := g.formatValue(value)
-
-		// Escape special characters in the value
-		escapedValue := g.escapeValue(valueStr)
-
-		fmt.Fprintf(&buf, "export %s=%s\n", key, escapedValue)
-	}
-
-	return buf.String(), nil
-}
-
 // generateFromTemplate uses a custom template file
 func (g *Generator) generateFromTemplate(secrets map[string]interface{}) (string, error) {
 	templateContent, err := os.ReadFile(g.options.TemplateFile)
@@ -177,7 +153,7 @@ func (g *Generator) generateFromTemplate(secrets map[string]interface{}) (string
 		return "", fmt.Errorf("failed to read template file %s: %w", g.options.TemplateFile, err)
 	}
 
-	tmpl, err := template.New("envrc").Parse(string(templateContent))
+	tmpl, err := template.New("envrc").Funcs(template.FuncMap{"shellQuote": ShellQuote}).Parse(string(templateContent))
 	if err != nil {
 		return "", fmt.Errorf("failed to parse template: %w", err)
 	}
@@ -190,54 +166,8 @@ func (g *Generator) generateFromTemplate(secrets map[string]interface{}) (string
 	return buf.String(), nil
 }
 
-// generateJSON creates JSON format output
-func (g *Generator) generateJSON(secrets map[string]interface{}) (string, error) {
-	// If sorted output is requested, marshal using an ordered representation
-	if g.options.SortKeys {
-		keys := make([]string, 0, len(secrets))
-		for k := range secrets {
-			keys = append(keys, k)
-		}
-		sort.Strings(keys)
-		om := orderedMap{keys: keys, m: secrets}
-		jsonBytes, err := json.Marshal(om)
-		if err != nil {
-			return "", fmt.Errorf("failed to marshal ordered JSON: %w", err)
-		}
-		// MarshalJSON already pretty-prints
-		return string(jsonBytes), nil
-	}
-	jsonBytes, err := json.MarshalIndent(secrets, "", "  ")
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal secrets to JSON: %w", err)
-	}
-	return string(jsonBytes), nil
-}
-
-// generateYAML creates YAML format output
-func (g *Generator) generateYAML(secrets map[string]interface{}) (string, error) {
-	if g.options.SortKeys {
-		keys := make([]string, 0, len(secrets))
-		for k := range secrets {
-			keys = append(keys, k)
-		}
-		sort.Strings(keys)
-		om := orderedMap{keys: keys, m: secrets}
-		b, err := yaml.Marshal(om)
-		if err != nil {
-			return "", fmt.Errorf("failed to marshal ordered YAML: %w", err)
-		}
-		return string(b), nil
-	}
-	yamlBytes, err := yaml.Marshal(secrets)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal secrets to YAML: %w", err)
-	}
-	return string(yamlBytes), nil
-}
-
 // formatValue converts various types to string representation
-func (g *Generator) formatValue(value interface{}) string {
+func formatValue(value interface{}) string {
 	switch v := value.(type) {
 	case string:
 		return v
@@ -258,16 +188,10 @@ func (g *Generator) formatValue(value interface{}) string {
 	}
 }
 
-// escapeValue properly escapes values for shell environment variables
-func (g *Generator) escapeValue(value string) string {
-	// If the value contains spaces, quotes, or special characters, wrap in quotes
-	if strings.ContainsAny(value, " \t\n\r\"'\\$`") {
-		// Escape existing quotes and backslashes
-		escaped := strings.ReplaceAll(value, "\\", "\\\\")
-		escaped = strings.ReplaceAll(escaped, "\"", "\\\"")
-		return fmt.Sprintf("\"%s\"", escaped)
-	}
-	return value
+// generatedHeader is the banner written at the top of generated text files
+func generatedHeader(comment string) string {
+	return fmt.Sprintf("%sGenerated by vault-envrc-generator\n%sGenerated at: %s\n%sSource: HashiCorp Vault\n\n",
+		comment, comment, time.Now().Format(time.RFC3339), comment)
 }
 
 // orderedMap provides deterministic key ordering for JSON and YAML outputs
@@ -0,0 +1,80 @@
+package envrc
+
+import (
+	"fmt"
+	"strings"
+)
+
+// INI has no single specification; the format targets Python's configparser without
+// interpolation and similar readers that take the text after the separator verbatim. Values
+// are written unquoted, so those the readers would change are refused.
+
+func iniCheckKey(key string) error {
+	if key == "" || key != strings.TrimSpace(key) || strings.ContainsAny(key, "=:\n\r") ||
+		strings.ContainsAny(key[:1], "[;#") {
+		return fmt.Errorf("%q is not a valid INI key", key)
+	}
+	return nil
+}
+
+func iniEncode(value string) (string, error) {
+	if strings.ContainsAny(value, "\n\r") || hasControlChars(value) {
+		return "", fmt.Errorf("line breaks and control characters are not supported")
+	}
+	if value != strings.TrimSpace(value) {
+		return "", fmt.Errorf("leading or trailing whitespace is not supported")
+	}
+	return value, nil
+}
+
+func writeINI(doc kvDoc) string {
+	var b strings.Builder
+	for i, section := range doc.sections() {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		if section != "" {
+			fmt.Fprintf(&b, "[%s]\n", section)
+		}
+		for _, key := range doc.keys(section) {
+			// Values read from existing files may span lines; continuation lines are indented
+			fmt.Fprintf(&b, "%s = %s\n", key, strings.ReplaceAll(doc[section][key], "\n", "\n  "))
+		}
+	}
+	return b.String()
+}
+
+// parseINI reads [section] headers, key = value and key: value pairs, ; and # comments and
+// indented continuation lines
+func parseINI(b []byte) (kvDoc, error) {
+	doc := kvDoc{}
+	section, lastKey := "", ""
+	for n, raw := range strings.Split(strings.ReplaceAll(string(b), "\r\n", "\n"), "\n") {
+		line := strings.TrimSpace(raw)
+		switch {
+		case line == "" || line[0] == ';' || line[0] == '#':
+			lastKey = ""
+		case raw[0] == ' ' || raw[0] == '\t':
+			if lastKey == "" {
+				return nil, fmt.Errorf("line %d: unexpected indented line", n+1)
+			}
+			doc[section][lastKey] += "\n" + line
+		case line[0] == '[':
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("line %d: malformed section header", n+1)
+			}
+			section, lastKey = strings.TrimSpace(line[1:len(line)-1]), ""
+			if doc[section] == nil {
+				doc[section] = map[string]string{}
+			}
+		default:
+			sep := strings.IndexAny(line, "=:")
+			if sep <= 0 {
+				return nil, fmt.Errorf("line %d: expected key = value", n+1)
+			}
+			lastKey = strings.TrimSpace(line[:sep])
+			doc.set(section, lastKey, strings.TrimSpace(line[sep+1:]))
+		}
+	}
+	return doc, nil
+}
@@ -0,0 +1,74 @@
+package envrc
+
+// KeyPath is the path of a leaf value in a structured document, outermost key first
+type KeyPath []string
+
+// Keyed is implemented by formats whose documents are nested maps (json, yaml, toml). Their
+// Merge removes FormatOptions.Prune from the existing file before merging, which lets
+// output.Write drop keys that an earlier run wrote and the current run no longer produces.
+type Keyed interface {
+	Formatter
+	// Keys returns the paths of the leaf values of a rendered document
+	Keys(doc string) ([]KeyPath, error)
+}
+
+func docKeys(doc string, unmarshal func([]byte, interface{}) error) ([]KeyPath, error) {
+	var m map[string]interface{}
+	if err := unmarshal([]byte(doc), &m); err != nil {
+		return nil, err
+	}
+	return leafPaths(m, nil), nil
+}
+
+// leafPaths returns the paths of the values in m that are not non-empty maps, sorted
+func leafPaths(m map[string]interface{}, prefix KeyPath) []KeyPath {
+	var paths []KeyPath
+	for _, key := range sortedKeys(m) {
+		path := append(append(KeyPath{}, prefix...), key)
+		if child, ok := m[key].(map[string]interface{}); ok && len(child) > 0 {
+			paths = append(paths, leafPaths(child, path)...)
+			continue
+		}
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+// pruneKeys removes each path from m, along with the maps that removing it leaves empty
+func pruneKeys(m map[string]interface{}, paths []KeyPath) {
+	for _, path := range paths {
+		removePath(m, path)
+	}
+}
+
+func removePath(m map[string]interface{}, path KeyPath) {
+	if len(path) == 0 {
+		return
+	}
+	if len(path) == 1 {
+		delete(m, path[0])
+		return
+	}
+	child, ok := m[path[0]].(map[string]interface{})
+	if !ok {
+		return
+	}
+	removePath(child, path[1:])
+	if len(child) == 0 {
+		delete(m, path[0])
+	}
+}
+
+// deepMerge overlays src onto dst; maps present in both are merged key by key instead of
+// being replaced
+func deepMerge(dst, src map[string]interface{}) {
+	for k, v := range src {
+		if sv, ok := v.(map[string]interface{}); ok {
+			if dv, ok := dst[k].(map[string]interface{}); ok {
+				deepMerge(dv, sv)
+				continue
+			}
+		}
+		dst[k] = v
+	}
+}
@@ -0,0 +1,272 @@
+package envrc
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// KubernetesOptions configures the metadata of manifests rendered by the k8s-secret and
+// k8s-configmap formats
+type KubernetesOptions struct {
+	Name        string            `yaml:"name,omitempty"`
+	Namespace   string            `yaml:"namespace,omitempty"`
+	Labels      map[string]string `yaml:"labels,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+	// StringData emits Secret values as plain `stringData` instead of base64 `data`
+	StringData bool `yaml:"string_data,omitempty"`
+}
+
+// Override returns a copy of o with the fields set in other taking precedence. Labels and
+// annotations are merged key by key.
+func (o *KubernetesOptions) Override(other *KubernetesOptions) *KubernetesOptions {
+	out := &KubernetesOptions{}
+	for _, src := range []*KubernetesOptions{o, other} {
+		if src == nil {
+			continue
+		}
+		if src.Name != "" {
+			out.Name = src.Name
+		}
+		if src.Namespace != "" {
+			out.Namespace = src.Namespace
+		}
+		out.StringData = out.StringData || src.StringData
+		out.Labels = overlayStrings(out.Labels, src.Labels)
+		out.Annotations = overlayStrings(out.Annotations, src.Annotations)
+	}
+	return out
+}
+
+var (
+	invalidNameChars = regexp.MustCompile(`[^a-z0-9.-]+`)
+	validName        = regexp.MustCompile(`^[a-z0-9]([-a-z0-9.]*[a-z0-9])?$`)
+	validDataKey     = regexp.MustCompile(`^[-._a-zA-Z0-9]+$`)
+)
+
+// KubernetesName turns parts such as a job and section name into a valid object name,
+// e.g. ("My App", "db_creds") becomes "my-app-db-creds"
+func KubernetesName(parts ...string) string {
+	var nonEmpty []string
+	for _, p := range parts {
+		if p != "" {
+			nonEmpty = append(nonEmpty, p)
+		}
+	}
+	name := invalidNameChars.ReplaceAllString(strings.ToLower(strings.Join(nonEmpty, "-")), "-")
+	if len(name) > 253 {
+		name = name[:253]
+	}
+	return strings.Trim(name, "-.")
+}
+
+// manifest is the subset of a Secret or ConfigMap the formats manage; other fields of
+// existing manifests are kept when merging
+type manifest struct {
+	APIVersion string                 `yaml:"apiVersion"`
+	Kind       string                 `yaml:"kind"`
+	Metadata   manifestMeta           `yaml:"metadata"`
+	Type       string                 `yaml:"type,omitempty"`
+	Data       map[string]string      `yaml:"data,omitempty"`
+	StringData map[string]string      `yaml:"stringData,omitempty"`
+	Rest       map[string]interface{} `yaml:",inline"`
+}
+
+type manifestMeta struct {
+	Name        string                 `yaml:"name"`
+	Namespace   string                 `yaml:"namespace,omitempty"`
+	Labels      map[string]string      `yaml:"labels,omitempty"`
+	Annotations map[string]string      `yaml:"annotations,omitempty"`
+	Rest        map[string]interface{} `yaml:",inline"`
+}
+
+func (m *manifest) id() string {
+	return m.Kind + "/" + m.Metadata.Namespace + "/" + m.Metadata.Name
+}
+
+// overlay copies src's metadata and values onto m. A key moved between data and stringData
+// is removed from the other map.
+func (m *manifest) overlay(src *manifest) {
+	m.overlayMeta(src)
+	for k := range src.Data {
+		delete(m.StringData, k)
+	}
+	for k := range src.StringData {
+		delete(m.Data, k)
+	}
+	m.Data = overlayStrings(m.Data, src.Data)
+	m.StringData = overlayStrings(m.StringData, src.StringData)
+}
+
+// replace copies src's metadata onto m and replaces m's values with src's, so keys that src
+// no longer has are removed
+func (m *manifest) replace(src *manifest) {
+	m.overlayMeta(src)
+	m.Data = src.Data
+	m.StringData = src.StringData
+}
+
+func (m *manifest) overlayMeta(src *manifest) {
+	m.Metadata.Labels = overlayStrings(m.Metadata.Labels, src.Metadata.Labels)
+	m.Metadata.Annotations = overlayStrings(m.Metadata.Annotations, src.Metadata.Annotations)
+	if src.Type != "" {
+		m.Type = src.Type
+	}
+	for k, v := range src.Rest {
+		if m.Rest == nil {
+			m.Rest = map[string]interface{}{}
+		}
+		m.Rest[k] = v
+	}
+}
+
+// kubernetesFormatter renders a v1 Secret or ConfigMap. Documents always start with `---`
+// so outputs of both kinds can be concatenated into one multi-document stream.
+type kubernetesFormatter struct {
+	name string
+	kind string
+}
+
+func (f kubernetesFormatter) Name() string { return f.name }
+
+func (f kubernetesFormatter) Render(values map[string]interface{}, opts FormatOptions) (string, error) {
+	k := opts.Kubernetes
+	if k == nil {
+		k = &KubernetesOptions{}
+	}
+	if !validName.MatchString(k.Name) || len(k.Name) > 253 {
+		return "", fmt.Errorf("%s format needs a valid object name, got %q", f.name, k.Name)
+	}
+	m := &manifest{
+		APIVersion: "v1",
+		Kind:       f.kind,
+		Metadata: manifestMeta{
+			Name:        k.Name,
+			Namespace:   k.Namespace,
+			Labels:      k.Labels,
+			Annotations: k.Annotations,
+		},
+	}
+	data := make(map[string]string, len(values))
+	for key, value := range values {
+		if !validDataKey.MatchString(key) {
+			return "", fmt.Errorf("key %q is not a valid %s key (allowed: letters, digits, '-', '_' and '.')", key, f.kind)
+		}
+		data[key] = formatValue(value)
+	}
+	switch {
+	case f.kind == "ConfigMap":
+		m.Data = data
+	case k.StringData:
+		m.Type = "Opaque"
+		m.StringData = data
+	default:
+		m.Type = "Opaque"
+		for key, value := range data {
+			data[key] = base64.StdEncoding.EncodeToString([]byte(value))
+		}
+		m.Data = data
+	}
+	return encodeManifests([]*manifest{m})
+}
+
+// Merge replaces the data and stringData of manifests with the same kind, namespace and name,
+// keeping their other metadata and fields, and appends new ones; other documents in the file
+// are kept. Unparsable files are replaced.
+func (f kubernetesFormatter) Merge(existing []byte, doc string, _ FormatOptions) ([]byte, error) {
+	merged, err := decodeManifests(existing)
+	if err != nil {
+		merged = nil
+	}
+	next, err := decodeManifests([]byte(doc))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse generated %s for merge: %w", f.name, err)
+	}
+	out, err := encodeManifests(mergeManifests(merged, next, (*manifest).replace))
+	return []byte(out), err
+}
+
+// Aggregate combines the sections' manifests; sections rendering the same object are merged
+func (f kubernetesFormatter) Aggregate(docs []string, _ FormatOptions) (string, error) {
+	var merged []*manifest
+	for _, doc := range docs {
+		next, err := decodeManifests([]byte(doc))
+		if err != nil {
+			return "", fmt.Errorf("failed to parse generated %s for aggregation: %w", f.name, err)
+		}
+		merged = mergeManifests(merged, next, (*manifest).overlay)
+	}
+	return encodeManifests(merged)
+}
+
+var _ Formatter = kubernetesFormatter{}
+
+// mergeManifests combines each manifest of src into the one in dst with the same id using
+// combine, or appends it
+func mergeManifests(dst, src []*manifest, combine func(dst, src *manifest)) []*manifest {
+	for _, m := range src {
+		found := false
+		for _, d := range dst {
+			if d.id() == m.id() {
+				combine(d, m)
+				found = true
+				break
+			}
+		}
+		if !found {
+			dst = append(dst, m)
+		}
+	}
+	return dst
+}
+
+func decodeManifests(b []byte) ([]*manifest, error) {
+	var out []*manifest
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	for {
+		m := &manifest{}
+		err := dec.Decode(m)
+		if errors.Is(err, io.EOF) {
+			return out, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if m.Kind == "" && m.Metadata.Name == "" && len(m.Rest) == 0 {
+			continue
+		}
+		out = append(out, m)
+	}
+}
+
+func encodeManifests(manifests []*manifest) (string, error) {
+	var buf strings.Builder
+	for _, m := range manifests {
+		b, err := yaml.Marshal(m)
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal %s manifest: %w", m.Kind, err)
+		}
+		buf.WriteString("---\n")
+		buf.Write(b)
+	}
+	return buf.String(), nil
+}
+
+func overlayStrings(dst, src map[string]string) map[string]string {
+	if len(src) == 0 {
+		return dst
+	}
+	if dst == nil {
+		dst = make(map[string]string, len(src))
+	}
+	for k, v := range src {
+		dst[k] = v
+	}
+	return dst
+}
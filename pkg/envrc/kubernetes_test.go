@@ -0,0 +1,119 @@
+package envrc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKubernetesSecretRender(t *testing.T) {
+	secrets := map[string]interface{}{"PASSWORD": "p@ss word", "PORT": 5432}
+	k8s := &KubernetesOptions{Name: "db", Namespace: "dev", Annotations: map[string]string{"owner": "platform"}}
+
+	got, err := NewGenerator(&Options{Format: "k8s-secret", Kubernetes: k8s}).Generate(secrets)
+	require.NoError(t, err)
+	require.Equal(t, `---
+apiVersion: v1
+kind: Secret
+metadata:
+    name: db
+    namespace: dev
+    annotations:
+        owner: platform
+type: Opaque
+data:
+    PASSWORD: cEBzcyB3b3Jk
+    PORT: NTQzMg==
+`, got)
+
+	got, err = NewGenerator(&Options{Format: "k8s-configmap", Kubernetes: &KubernetesOptions{Name: "db"}}).Generate(secrets)
+	require.NoError(t, err)
+	require.Equal(t, "---\napiVersion: v1\nkind: ConfigMap\nmetadata:\n    name: db\ndata:\n    PASSWORD: p@ss word\n    PORT: \"5432\"\n", got)
+
+	_, err = NewGenerator(&Options{Format: "k8s-secret"}).Generate(secrets)
+	require.ErrorContains(t, err, "needs a valid object name")
+	_, err = NewGenerator(&Options{Format: "k8s-secret", Kubernetes: k8s}).Generate(map[string]interface{}{"bad key": "x"})
+	require.ErrorContains(t, err, `key "bad key" is not a valid Secret key`)
+}
+
+func TestKubernetesMerge(t *testing.T) {
+	f, err := LookupFormatter("k8s-secret")
+	require.NoError(t, err)
+	existing := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: other
+data:
+  A: "1"
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: db
+  labels:
+    team: core
+immutable: false
+data:
+  OLD: b2xk
+  PASSWORD: b2xk
+`
+	doc, err := f.Render(map[string]interface{}{"PASSWORD": "new"}, FormatOptions{Kubernetes: &KubernetesOptions{Name: "db", StringData: true}})
+	require.NoError(t, err)
+	merged, err := f.Merge([]byte(existing), doc, FormatOptions{})
+	require.NoError(t, err)
+	require.Equal(t, `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+    name: other
+data:
+    A: "1"
+---
+apiVersion: v1
+kind: Secret
+metadata:
+    name: db
+    labels:
+        team: core
+type: Opaque
+stringData:
+    PASSWORD: new
+immutable: false
+`, string(merged))
+}
+
+func TestKubernetesMergeDropsRemovedKeys(t *testing.T) {
+	f, err := LookupFormatter("k8s-configmap")
+	require.NoError(t, err)
+	opts := FormatOptions{Kubernetes: &KubernetesOptions{Name: "app", Namespace: "dev"}}
+	first, err := f.Render(map[string]interface{}{"HOST": "db", "PORT": "5432"}, opts)
+	require.NoError(t, err)
+	existing, err := f.Merge(nil, first, FormatOptions{})
+	require.NoError(t, err)
+
+	// PORT was removed from Vault
+	next, err := f.Render(map[string]interface{}{"HOST": "db2"}, opts)
+	require.NoError(t, err)
+	merged, err := f.Merge(existing, next, FormatOptions{})
+	require.NoError(t, err)
+	require.Equal(t, `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+    name: app
+    namespace: dev
+data:
+    HOST: db2
+`, string(merged))
+
+	// Sections of one run that render the same object still combine their keys
+	agg, err := f.Aggregate([]string{first, next}, FormatOptions{})
+	require.NoError(t, err)
+	require.Contains(t, agg, "HOST: db2\n")
+	require.Contains(t, agg, "PORT: \"5432\"\n")
+}
+
+func TestKubernetesName(t *testing.T) {
+	require.Equal(t, "my-app-db-creds", KubernetesName("My App", "", "db_creds"))
+	require.Equal(t, "db", KubernetesName("--db--"))
+}
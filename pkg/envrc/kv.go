@@ -0,0 +1,112 @@
+package envrc
+
+import (
+	"fmt"
+	"sort"
+)
+
+// kvDoc holds the encoded values of a key/value document by section; "" is the top level.
+// Values are kept in the format's own syntax, so values in existing files that the format
+// does not produce itself (such as tfvars lists) survive a merge unchanged.
+type kvDoc map[string]map[string]string
+
+func (d kvDoc) set(section, key, value string) {
+	if d[section] == nil {
+		d[section] = map[string]string{}
+	}
+	d[section][key] = value
+}
+
+func (d kvDoc) overlay(src kvDoc) {
+	for section, values := range src {
+		for k, v := range values {
+			d.set(section, k, v)
+		}
+	}
+}
+
+// sections returns the section names with the top level first and the rest sorted
+func (d kvDoc) sections() []string {
+	names := make([]string, 0, len(d))
+	for name := range d {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	if _, ok := d[""]; ok {
+		names = append([]string{""}, names...)
+	}
+	return names
+}
+
+func (d kvDoc) keys(section string) []string {
+	keys := make([]string, 0, len(d[section]))
+	for k := range d[section] {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// kvFormatter renders flat key/value formats. Merge and Aggregate parse the documents, let
+// later keys win and render the result with sorted keys; comments in existing files are not
+// kept. Unlike JSON and YAML, an existing file that cannot be parsed is an error rather than
+// being replaced, since these files are often maintained by hand.
+type kvFormatter struct {
+	name string
+	// sections is true when the format groups keys under FormatOptions.Section
+	sections bool
+	checkKey func(key string) error
+	encode   func(value string) (string, error)
+	parse    func(b []byte) (kvDoc, error)
+	write    func(doc kvDoc) string
+}
+
+func (f kvFormatter) Name() string { return f.name }
+
+func (f kvFormatter) Render(values map[string]interface{}, opts FormatOptions) (string, error) {
+	section := ""
+	if f.sections {
+		section = opts.Section
+	}
+	doc := kvDoc{}
+	for key, value := range values {
+		if err := f.checkKey(key); err != nil {
+			return "", fmt.Errorf("%s format: %w", f.name, err)
+		}
+		encoded, err := f.encode(formatValue(value))
+		if err != nil {
+			return "", fmt.Errorf("%s format cannot represent the value of %s: %w", f.name, key, err)
+		}
+		doc.set(section, key, encoded)
+	}
+	return f.write(doc), nil
+}
+
+func (f kvFormatter) Merge(existing []byte, doc string, _ FormatOptions) ([]byte, error) {
+	merged, err := f.parse(existing)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse existing %s output for merge: %w", f.name, err)
+	}
+	next, err := f.parse([]byte(doc))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse generated %s for merge: %w", f.name, err)
+	}
+	merged.overlay(next)
+	return []byte(f.write(merged)), nil
+}
+
+func (f kvFormatter) Aggregate(docs []string, _ FormatOptions) (string, error) {
+	merged := kvDoc{}
+	for _, doc := range docs {
+		next, err := f.parse([]byte(doc))
+		if err != nil {
+			return "", fmt.Errorf("failed to parse generated %s for aggregation: %w", f.name, err)
+		}
+		merged.overlay(next)
+	}
+	return f.write(merged), nil
+}
+
+var _ Formatter = kvFormatter{}
@@ -0,0 +1,129 @@
+package envrc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func renderFormat(t *testing.T, format string, opts FormatOptions, values map[string]interface{}) string {
+	t.Helper()
+	f, err := LookupFormatter(format)
+	require.NoError(t, err)
+	out, err := f.Render(values, opts)
+	require.NoError(t, err)
+	return out
+}
+
+func mergeFormat(t *testing.T, format, existing string, docs ...string) string {
+	t.Helper()
+	f, err := LookupFormatter(format)
+	require.NoError(t, err)
+	agg, err := f.Aggregate(docs, FormatOptions{})
+	require.NoError(t, err)
+	out, err := f.Merge([]byte(existing), agg, FormatOptions{})
+	require.NoError(t, err)
+	return string(out)
+}
+
+func TestTfvarsFormat(t *testing.T) {
+	got := renderFormat(t, "tfvars", FormatOptions{}, map[string]interface{}{
+		"db_password": `p"a\ss ${var.x} %{if}`,
+		"tls_cert":    testPEM,
+		"eot":         "a\nEOT\n",
+		"port":        5432,
+	})
+	require.Equal(t, `db_password = "p\"a\\ss $${var.x} %%{if}"
+eot = <<EOT1
+a
+EOT
+EOT1
+port = "5432"
+tls_cert = <<EOT
+-----BEGIN CERTIFICATE-----
+MIIBszCCAVmgAwIBAgIUQ2x0ZXN0
+-----END CERTIFICATE-----
+EOT
+`, got)
+
+	existing := `# managed by hand
+region = "eu-west-1" # inline comment
+zones  = [
+  "a", # first
+  "b",
+]
+tags = { team = "core" }
+port = 1
+`
+	next := renderFormat(t, "tfvars", FormatOptions{}, map[string]interface{}{"port": "5432", "eot": "a\nEOT\n"})
+	require.Equal(t, `eot = <<EOT1
+a
+EOT
+EOT1
+port = "5432"
+region = "eu-west-1"
+tags = { team = "core" }
+zones = [
+  "a", # first
+  "b",
+]
+`, mergeFormat(t, "tfvars", existing, next))
+
+	f, err := LookupFormatter("tfvars")
+	require.NoError(t, err)
+	_, err = f.Render(map[string]interface{}{"1bad": "x"}, FormatOptions{})
+	require.ErrorContains(t, err, `"1bad" is not a valid Terraform variable name`)
+	_, err = f.Merge([]byte("broken = [1"), `a = "b"`, FormatOptions{})
+	require.ErrorContains(t, err, "failed to parse existing tfvars output")
+}
+
+func TestPropertiesFormat(t *testing.T) {
+	got := renderFormat(t, "properties", FormatOptions{}, map[string]interface{}{
+		"db.url":     "jdbc:postgresql://db:5432/app?ssl=true",
+		"key with=":  " leading space",
+		"multi.line": "a\nb\\c",
+		"unicode":    "ü😀",
+	})
+	require.Equal(t, `db.url=jdbc:postgresql://db:5432/app?ssl=true
+key\ with\==\ leading space
+multi.line=a\nb\\c
+unicode=\u00FC\uD83D\uDE00
+`, got)
+
+	doc, err := parseProperties([]byte(got))
+	require.NoError(t, err)
+	key, err := propertiesUnescape(`\u00FC\uD83D\uDE00`)
+	require.NoError(t, err)
+	require.Equal(t, "ü😀", key)
+	require.Equal(t, `\ leading space`, doc[""]["key with="])
+
+	existing := "# comment\n! other comment\nkeep : value \\\n    continued\ndb.url = old\n"
+	require.Equal(t, "db.url=new\nkeep=value continued\n",
+		mergeFormat(t, "properties", existing, "db.url=new\n"))
+}
+
+func TestTOMLFormat(t *testing.T) {
+	got := renderFormat(t, "toml", FormatOptions{}, map[string]interface{}{"token": "t0k3n", "port": 5432, "cert": "a\nb"})
+	require.Equal(t, "cert = \"a\\nb\"\nport = '5432'\ntoken = 't0k3n'\n", got)
+
+	existing := "name = 'app'\n\n[server]\nhost = 'localhost'\n"
+	require.Equal(t, "name = 'app'\ntoken = 'new'\n\n[server]\nhost = 'localhost'\n",
+		mergeFormat(t, "toml", existing, "token = 'old'\n", "token = 'new'\n"))
+}
+
+func TestINIFormat(t *testing.T) {
+	db := renderFormat(t, "ini", FormatOptions{Section: "db"}, map[string]interface{}{"user": "app", "password": "p@ss; word"})
+	require.Equal(t, "[db]\npassword = p@ss; word\nuser = app\n", db)
+	api := renderFormat(t, "ini", FormatOptions{Section: "api"}, map[string]interface{}{"token": "t0k3n"})
+
+	existing := "; settings\nglobal = yes\n\n[db]\nuser = old\nhosts = a\n  b\n"
+	require.Equal(t, "global = yes\n\n[api]\ntoken = t0k3n\n\n[db]\nhosts = a\n  b\npassword = p@ss; word\nuser = app\n",
+		mergeFormat(t, "ini", existing, db, api))
+
+	f, err := LookupFormatter("ini")
+	require.NoError(t, err)
+	_, err = f.Render(map[string]interface{}{"cert": testPEM}, FormatOptions{})
+	require.ErrorContains(t, err, "ini format cannot represent the value of cert")
+	_, err = f.Render(map[string]interface{}{"a=b": "x"}, FormatOptions{})
+	require.ErrorContains(t, err, `"a=b" is not a valid INI key`)
+}
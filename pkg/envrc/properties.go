@@ -0,0 +1,153 @@
+package envrc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// propertiesEscape escapes s for a Java .properties file. Everything outside printable ASCII
+// becomes a \uXXXX escape, so the file reads the same with Properties.load in ISO-8859-1 and
+// with UTF-8 readers. Keys also escape the separators and comment characters.
+func propertiesEscape(s string, key bool) string {
+	var b strings.Builder
+	for i, r := range s {
+		switch {
+		case r == '\\':
+			b.WriteString(`\\`)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r == '\f':
+			b.WriteString(`\f`)
+		case r == ' ' && (key || i == 0):
+			b.WriteString(`\ `)
+		case key && strings.ContainsRune("=:#!", r):
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20 || r > 0x7e:
+			for _, u := range utf16.Encode([]rune{r}) {
+				fmt.Fprintf(&b, `\u%04X`, u)
+			}
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func propertiesEncode(value string) (string, error) {
+	return propertiesEscape(value, false), nil
+}
+
+func propertiesCheckKey(key string) error {
+	if key == "" {
+		return fmt.Errorf("empty keys are not supported")
+	}
+	return nil
+}
+
+func writeProperties(doc kvDoc) string {
+	var b strings.Builder
+	for _, key := range doc.keys("") {
+		fmt.Fprintf(&b, "%s=%s\n", propertiesEscape(key, true), doc[""][key])
+	}
+	return b.String()
+}
+
+// parseProperties follows java.util.Properties.load: comment lines start with # or !, a line
+// ending in an odd number of backslashes continues on the next line, and the key ends at the
+// first unescaped =, : or whitespace. Keys are unescaped; values stay escaped.
+func parseProperties(b []byte) (kvDoc, error) {
+	doc := kvDoc{}
+	lines := strings.Split(strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(string(b)), "\n")
+	for n := 0; n < len(lines); n++ {
+		line := strings.TrimLeft(lines[n], " \t\f")
+		if line == "" || line[0] == '#' || line[0] == '!' {
+			continue
+		}
+		for continues(line) && n+1 < len(lines) {
+			n++
+			line = line[:len(line)-1] + strings.TrimLeft(lines[n], " \t\f")
+		}
+		if continues(line) {
+			line = line[:len(line)-1]
+		}
+
+		end := 0
+		for end < len(line) && !strings.ContainsRune("=: \t\f", rune(line[end])) {
+			if line[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end > len(line) {
+			end = len(line)
+		}
+		key, err := propertiesUnescape(line[:end])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n+1, err)
+		}
+		rest := strings.TrimLeft(line[end:], " \t\f")
+		if rest != "" && (rest[0] == '=' || rest[0] == ':') {
+			rest = strings.TrimLeft(rest[1:], " \t\f")
+		}
+		doc.set("", key, rest)
+	}
+	return doc, nil
+}
+
+// continues reports whether line ends in an odd number of backslashes
+func continues(line string) bool {
+	n := 0
+	for i := len(line) - 1; i >= 0 && line[i] == '\\'; i-- {
+		n++
+	}
+	return n%2 == 1
+}
+
+func propertiesUnescape(s string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 >= len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case 'f':
+			b.WriteByte('\f')
+		case 'u':
+			if i+5 > len(s) {
+				return "", fmt.Errorf("malformed \\u escape")
+			}
+			u, err := strconv.ParseUint(s[i+1:i+5], 16, 16)
+			if err != nil {
+				return "", fmt.Errorf("malformed \\u escape: %w", err)
+			}
+			r := rune(u)
+			i += 4
+			// A surrogate pair is written as two consecutive escapes
+			if utf16.IsSurrogate(r) && i+6 < len(s) && s[i+1:i+3] == `\u` {
+				if low, err := strconv.ParseUint(s[i+3:i+7], 16, 16); err == nil {
+					r = utf16.DecodeRune(r, rune(low))
+					i += 6
+				}
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,90 @@
+package envrc
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Quoting modes for envrc values
+const (
+	// QuotingSafe quotes values so the shell reads them back verbatim (the default)
+	QuotingSafe = "safe"
+	// QuotingRaw wraps values in double quotes, leaving $ and backticks for the shell to expand
+	QuotingRaw = "raw"
+)
+
+// ShellQuote quotes value so that sourcing `export KEY=<quoted>` sets KEY to exactly value.
+// Plain words are left bare and everything else is single-quoted; an embedded single quote
+// closes the quoting, adds an escaped quote and reopens it. Values with control characters
+// other than newline and tab use $'...' quoting, which needs bash (direnv evaluates .envrc
+// with bash) rather than a strict POSIX sh.
+func ShellQuote(value string) string {
+	if value == "" {
+		return "''"
+	}
+	if isShellWord(value) {
+		return value
+	}
+	if hasControlChars(value) {
+		return ansiCQuote(value)
+	}
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// rawQuote is the pre-safe quoting: double quotes with only \ and " escaped
+func rawQuote(value string) string {
+	if strings.ContainsAny(value, " \t\n\r\"'\\$`") {
+		escaped := strings.ReplaceAll(value, "\\", "\\\\")
+		escaped = strings.ReplaceAll(escaped, "\"", "\\\"")
+		return fmt.Sprintf("\"%s\"", escaped)
+	}
+	return value
+}
+
+func isShellWord(value string) bool {
+	for _, r := range value {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case strings.ContainsRune("_@%+=:,./-", r):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func hasControlChars(value string) bool {
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if (c < 0x20 && c != '\n' && c != '\t') || c == 0x7f {
+			return true
+		}
+	}
+	return false
+}
+
+func ansiCQuote(value string) string {
+	var b strings.Builder
+	b.WriteString("$'")
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case c == '\\':
+			b.WriteString(`\\`)
+		case c == '\'':
+			b.WriteString(`\'`)
+		case c == '\n':
+			b.WriteString(`\n`)
+		case c == '\t':
+			b.WriteString(`\t`)
+		case c == '\r':
+			b.WriteString(`\r`)
+		case c < 0x20 || c == 0x7f:
+			fmt.Fprintf(&b, `\x%02x`, c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteString("'")
+	return b.String()
+}
@@ -0,0 +1,122 @@
+package envrc
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testPEM = `-----BEGIN CERTIFICATE-----
+MIIBszCCAVmgAwIBAgIUQ2x0ZXN0
+-----END CERTIFICATE-----
+`
+
+// portableValues only need POSIX single quoting
+var portableValues = []string{
+	"plain",
+	"",
+	"p@ss word",
+	"pa$$word",
+	"$(rm -rf ~)",
+	"`id`",
+	"${HOME}",
+	`it's "quoted"`,
+	`back\slash\n`,
+	"'",
+	"''",
+	"~/tilde",
+	"a;b|c&d>e<f",
+	"*?[glob]",
+	"!history",
+	"#comment",
+	"tab\there",
+	testPEM,
+	"trailing newline\n\n",
+	"ünïcödé ✓",
+	"--flag=value",
+}
+
+// bashValues contain control characters that are emitted with $'...' quoting
+var bashValues = []string{
+	"carriage\r\nreturn",
+	"escape\x1b[31mred\x1b[0m",
+	"bell\a'quote'\\",
+	"\x7fdel",
+}
+
+func TestShellQuoteRoundTrip(t *testing.T) {
+	for _, shell := range []string{"sh", "bash"} {
+		t.Run(shell, func(t *testing.T) {
+			if _, err := exec.LookPath(shell); err != nil {
+				t.Skipf("%s not available", shell)
+			}
+			values := portableValues
+			if shell == "bash" {
+				values = append(append([]string{}, portableValues...), bashValues...)
+			}
+			require.Equal(t, values, sourceValues(t, shell, values))
+		})
+	}
+}
+
+// sourceValues generates an envrc file for values, sources it with shell and returns the
+// exported values in order
+func sourceValues(t *testing.T, shell string, values []string) []string {
+	t.Helper()
+	secrets := map[string]interface{}{}
+	var refs []string
+	for i, v := range values {
+		key := fmt.Sprintf("V%03d", i)
+		secrets[key] = v
+		refs = append(refs, `"$`+key+`"`)
+	}
+	content, err := NewGenerator(&Options{SuppressHeader: true}).Generate(secrets)
+	require.NoError(t, err)
+
+	file := filepath.Join(t.TempDir(), ".envrc")
+	require.NoError(t, os.WriteFile(file, []byte(content), 0o600))
+	script := fmt.Sprintf(`. "$1" && printf '%%s\0' %s`, strings.Join(refs, " "))
+	out, err := exec.Command(shell, "-c", script, shell, file).Output()
+	require.NoError(t, err, "sourcing:\n%s", content)
+
+	got := strings.Split(string(out), "\x00")
+	return got[:len(got)-1]
+}
+
+func TestShellQuote(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"app", "app"},
+		{"https://hooks.example.com/x", "https://hooks.example.com/x"},
+		{"", "''"},
+		{"pa$$word", "'pa$$word'"},
+		{"it's", `'it'\''s'`},
+		{"a\nb", "'a\nb'"},
+		{"a\r\nb's", `$'a\r\nb\'s'`},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.want, ShellQuote(tt.value), "value %q", tt.value)
+	}
+}
+
+func TestGenerateRawQuoting(t *testing.T) {
+	secrets := map[string]interface{}{"PATH_EXT": "$HOME/bin", "TOKEN": "t0k3n"}
+
+	raw, err := NewGenerator(&Options{SuppressHeader: true, Quoting: QuotingRaw}).Generate(secrets)
+	require.NoError(t, err)
+	require.Equal(t, "export PATH_EXT=\"$HOME/bin\"\nexport TOKEN=t0k3n\n", raw)
+
+	safe, err := NewGenerator(&Options{SuppressHeader: true}).Generate(secrets)
+	require.NoError(t, err)
+	require.Equal(t, "export PATH_EXT='$HOME/bin'\nexport TOKEN=t0k3n\n", safe)
+
+	_, err = NewGenerator(&Options{Quoting: "loose"}).Generate(secrets)
+	require.ErrorContains(t, err, `unknown quoting mode "loose"`)
+}
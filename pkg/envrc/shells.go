@@ -0,0 +1,108 @@
+package envrc
+
+import (
+	"fmt"
+	"strings"
+)
+
+// shellFormatter renders one line per variable for a shell that cannot source the POSIX
+// `export` lines of the envrc format
+type shellFormatter struct {
+	lineFile
+	name string
+	// open and close wrap the variable lines, e.g. nushell's load-env record
+	open, close string
+	line        func(key, value string) (string, error)
+}
+
+func (f shellFormatter) Name() string { return f.name }
+
+func (f shellFormatter) Render(values map[string]interface{}, opts FormatOptions) (string, error) {
+	var buf strings.Builder
+	if !opts.SuppressHeader {
+		buf.WriteString(generatedHeader("# "))
+	}
+	buf.WriteString(f.open)
+	for _, key := range sortedKeys(values) {
+		line, err := f.line(key, formatValue(values[key]))
+		if err != nil {
+			return "", fmt.Errorf("%s format: %w", f.name, err)
+		}
+		buf.WriteString(line)
+		buf.WriteString("\n")
+	}
+	buf.WriteString(f.close)
+	return buf.String(), nil
+}
+
+var (
+	_ Formatter = shellFormatter{}
+	_ Commenter = shellFormatter{}
+)
+
+// fishLine renders `set -gx KEY value`. Inside fish single quotes only \\ and \' are escapes.
+// A value starting with - is preceded by -- so set does not read it as an option.
+func fishLine(key, value string) (string, error) {
+	if !envName.MatchString(key) {
+		return "", fmt.Errorf("%q is not a valid fish variable name", key)
+	}
+	quoted := value
+	if value == "" || !isShellWord(value) {
+		quoted = "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+	}
+	if strings.HasPrefix(value, "-") {
+		return fmt.Sprintf("set -gx -- %s %s", key, quoted), nil
+	}
+	return fmt.Sprintf("set -gx %s %s", key, quoted), nil
+}
+
+// nushellLine renders one field of the load-env record. Values are always quoted so nushell
+// does not parse them as numbers or booleans: single quotes are literal, and values that
+// contain a single quote or control characters use a double-quoted string with escapes.
+func nushellLine(key, value string) (string, error) {
+	if !envName.MatchString(key) {
+		key = nushellQuote(key)
+	}
+	return fmt.Sprintf("    %s: %s", key, nushellQuote(value)), nil
+}
+
+func nushellQuote(value string) string {
+	if !strings.Contains(value, "'") && !hasControlChars(value) {
+		return "'" + value + "'"
+	}
+	var b strings.Builder
+	b.WriteString(`"`)
+	for _, r := range value {
+		switch {
+		case r == '\\':
+			b.WriteString(`\\`)
+		case r == '"':
+			b.WriteString(`\"`)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&b, `\u{%x}`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteString(`"`)
+	return b.String()
+}
+
+// powershellLine renders `$env:KEY = 'value'`. PowerShell single quotes are literal; a quote
+// character, including the typographic ones PowerShell also accepts, is escaped by doubling
+// it. Names that are not plain identifiers use the braced ${env:NAME} form.
+func powershellLine(key, value string) (string, error) {
+	name := "$env:" + key
+	if !envName.MatchString(key) {
+		name = "${env:" + strings.NewReplacer("`", "``", "}", "`}").Replace(key) + "}"
+	}
+	quoted := strings.NewReplacer("'", "''", "‘", "‘‘", "’", "’’",
+		"‚", "‚‚", "‛", "‛‛").Replace(value)
+	return fmt.Sprintf("%s = '%s'", name, quoted), nil
+}
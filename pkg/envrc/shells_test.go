@@ -0,0 +1,45 @@
+package envrc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestShellDialects(t *testing.T) {
+	secrets := map[string]interface{}{
+		"PLAIN":       "app",
+		"QUOTE":       `it's $HOME\n`,
+		"FLAG":        "--verbose",
+		"internal-id": 42,
+	}
+
+	got, err := NewGenerator(&Options{Format: "powershell", SuppressHeader: true}).Generate(secrets)
+	require.NoError(t, err)
+	require.Equal(t, `$env:FLAG = '--verbose'
+$env:PLAIN = 'app'
+$env:QUOTE = 'it''s $HOME\n'
+${env:internal-id} = '42'
+`, got)
+
+	got, err = NewGenerator(&Options{Format: "nushell", SuppressHeader: true}).Generate(secrets)
+	require.NoError(t, err)
+	require.Equal(t, `load-env {
+    FLAG: '--verbose'
+    PLAIN: 'app'
+    QUOTE: "it's $HOME\\n"
+    'internal-id': '42'
+}
+`, got)
+
+	delete(secrets, "internal-id")
+	got, err = NewGenerator(&Options{Format: "fish", SuppressHeader: true}).Generate(secrets)
+	require.NoError(t, err)
+	require.Equal(t, `set -gx -- FLAG --verbose
+set -gx PLAIN app
+set -gx QUOTE 'it\'s $HOME\\n'
+`, got)
+
+	_, err = NewGenerator(&Options{Format: "fish"}).Generate(map[string]interface{}{"internal-id": "42"})
+	require.ErrorContains(t, err, `fish format: "internal-id" is not a valid fish variable name`)
+}
@@ -0,0 +1,230 @@
+package envrc
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var hclIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+func tfvarsCheckKey(key string) error {
+	if !hclIdentifier.MatchString(key) {
+		return fmt.Errorf("%q is not a valid Terraform variable name", key)
+	}
+	return nil
+}
+
+// tfvarsEncode renders value as an HCL string. Values ending in a newline, such as PEM
+// certificates, use a heredoc; everything else is a quoted string with escapes. Template
+// sequences are escaped in both, so ${ and %{ are never interpolated.
+func tfvarsEncode(value string) (string, error) {
+	if strings.HasSuffix(value, "\n") && !hasControlChars(value) {
+		return tfvarsHeredoc(value), nil
+	}
+	var b strings.Builder
+	for _, r := range value {
+		switch {
+		case r == '\\':
+			b.WriteString(`\\`)
+		case r == '"':
+			b.WriteString(`\"`)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&b, `\u%04x`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return `"` + escapeHCLTemplate(b.String()) + `"`, nil
+}
+
+// tfvarsHeredoc renders a value that ends in a newline; the heredoc adds no newline of its own
+func tfvarsHeredoc(value string) string {
+	lines := strings.Split(value, "\n")
+	delim := "EOT"
+	for i := 1; containsTrimmedLine(lines, delim); i++ {
+		delim = fmt.Sprintf("EOT%d", i)
+	}
+	return "<<" + delim + "\n" + escapeHCLTemplate(value) + delim
+}
+
+func escapeHCLTemplate(s string) string {
+	return strings.NewReplacer("${", "$${", "%{", "%%{").Replace(s)
+}
+
+func containsTrimmedLine(lines []string, s string) bool {
+	for _, line := range lines {
+		if strings.TrimSpace(line) == s {
+			return true
+		}
+	}
+	return false
+}
+
+func writeTfvars(doc kvDoc) string {
+	var b strings.Builder
+	for _, key := range doc.keys("") {
+		fmt.Fprintf(&b, "%s = %s\n", key, doc[""][key])
+	}
+	return b.String()
+}
+
+// parseTfvars reads the top-level attributes of a tfvars file, keeping each value expression
+// as written. It understands quoted strings, heredocs, nested lists and objects and comments.
+func parseTfvars(b []byte) (kvDoc, error) {
+	doc := kvDoc{}
+	s := string(b)
+	i := 0
+	line := func() int { return strings.Count(s[:i], "\n") + 1 }
+	for {
+		i = skipHCLSpace(s, i, true)
+		if i >= len(s) {
+			return doc, nil
+		}
+		start := i
+		for i < len(s) && isHCLIdentChar(s[i]) {
+			i++
+		}
+		key := s[start:i]
+		if !hclIdentifier.MatchString(key) {
+			return nil, fmt.Errorf("line %d: expected an attribute name", line())
+		}
+		i = skipHCLSpace(s, i, false)
+		if i >= len(s) || s[i] != '=' {
+			return nil, fmt.Errorf("line %d: expected '=' after %s", line(), key)
+		}
+		i = skipHCLSpace(s, i+1, false)
+		end, err := scanHCLExpression(s, i)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line(), err)
+		}
+		expr := strings.TrimSpace(s[i:end])
+		if expr == "" {
+			return nil, fmt.Errorf("line %d: missing value for %s", line(), key)
+		}
+		doc.set("", key, expr)
+		i = end
+	}
+}
+
+func isHCLIdentChar(c byte) bool {
+	return c == '_' || c == '-' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// skipHCLSpace skips blanks and comments, and newlines too when newlines is set
+func skipHCLSpace(s string, i int, newlines bool) int {
+	for i < len(s) {
+		switch {
+		case s[i] == ' ' || s[i] == '\t' || s[i] == '\r':
+			i++
+		case s[i] == '\n' && newlines:
+			i++
+		case s[i] == '#' || strings.HasPrefix(s[i:], "//"):
+			for i < len(s) && s[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(s[i:], "/*"):
+			end := strings.Index(s[i+2:], "*/")
+			if end < 0 {
+				return len(s)
+			}
+			i += end + 4
+		default:
+			return i
+		}
+	}
+	return i
+}
+
+// scanHCLExpression returns the end of the expression starting at i: the first newline or
+// comment outside of strings, heredocs and brackets
+func scanHCLExpression(s string, i int) (int, error) {
+	depth := 0
+	for i < len(s) {
+		c := s[i]
+		switch {
+		case c == '"':
+			end, err := scanHCLString(s, i)
+			if err != nil {
+				return 0, err
+			}
+			i = end
+			continue
+		case strings.HasPrefix(s[i:], "<<"):
+			end, err := scanHCLHeredoc(s, i)
+			if err != nil {
+				return 0, err
+			}
+			i = end
+			continue
+		case c == '[' || c == '{' || c == '(':
+			depth++
+		case c == ']' || c == '}' || c == ')':
+			depth--
+			if depth < 0 {
+				return 0, fmt.Errorf("unbalanced %q", c)
+			}
+		case depth == 0 && (c == '\n' || c == '#' || strings.HasPrefix(s[i:], "//") || strings.HasPrefix(s[i:], "/*")):
+			return i, nil
+		case c == '#' || strings.HasPrefix(s[i:], "//"):
+			for i < len(s) && s[i] != '\n' {
+				i++
+			}
+			continue
+		}
+		i++
+	}
+	if depth != 0 {
+		return 0, fmt.Errorf("unterminated list or object")
+	}
+	return i, nil
+}
+
+// scanHCLString returns the index after the quoted string starting at i
+func scanHCLString(s string, i int) (int, error) {
+	for j := i + 1; j < len(s); j++ {
+		switch s[j] {
+		case '\\':
+			j++
+		case '"':
+			return j + 1, nil
+		case '\n':
+			return 0, fmt.Errorf("unterminated string")
+		}
+	}
+	return 0, fmt.Errorf("unterminated string")
+}
+
+// scanHCLHeredoc returns the index after the closing marker of the heredoc starting at i
+func scanHCLHeredoc(s string, i int) (int, error) {
+	j := i + 2
+	if j < len(s) && s[j] == '-' {
+		j++
+	}
+	nl := strings.IndexByte(s[j:], '\n')
+	if nl < 0 {
+		return 0, fmt.Errorf("unterminated heredoc")
+	}
+	delim := strings.TrimSpace(s[j : j+nl])
+	if !hclIdentifier.MatchString(delim) {
+		return 0, fmt.Errorf("invalid heredoc marker %q", delim)
+	}
+	j += nl + 1
+	for j < len(s) {
+		end := strings.IndexByte(s[j:], '\n')
+		if end < 0 {
+			end = len(s) - j
+		}
+		if strings.TrimSpace(s[j:j+end]) == delim {
+			return j + end, nil
+		}
+		j += end + 1
+	}
+	return 0, fmt.Errorf("heredoc %s is not terminated", delim)
+}
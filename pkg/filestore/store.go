@@ -0,0 +1,441 @@
+// Package filestore implements vault.SecretStore on top of a local, age-encrypted YAML file so that
+// batch and seed configurations can run without a Vault server (offline, or in tests).
+//
+// The decrypted file looks like this:
+//
+//	mounts: [secret]          # optional; first path segments treated as absolute
+//	token:                    # optional; token-lookup data for {{ .Token.* }} templates
+//	  display_name: oidc-alice
+//	secrets:
+//	  secret/app/db:
+//	    version: 2
+//	    created_time: 2025-01-02T15:04:05Z
+//	    updated_time: 2025-01-03T10:00:00Z
+//	    data:
+//	      username: app
+//	      password: s3cret
+//
+// Only the latest version of each secret is kept; versions are counted so that check-and-set
+// writes behave like on a KV v2 mount.
+package filestore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"gopkg.in/yaml.v3"
+
+	"github.com/go-go-golems/vault-envrc-generator/pkg/vault"
+)
+
+// Options configures how the store file is decrypted and encrypted.
+//
+// Every write re-encrypts the whole file to the recipients configured here only: the recipients
+// of the existing file cannot be read back from it. For a store shared by a team, every writer
+// must list all teammates' keys in Recipients, or one write locks the others out.
+type Options struct {
+	// IdentityFile is an age identity file (as written by age-keygen) used to decrypt the store.
+	// X25519 identities in it are also used as recipients when the store is written.
+	IdentityFile string
+	// Recipients are additional age public keys ("age1...") the store is encrypted to.
+	Recipients []string
+}
+
+// Store is an age-encrypted YAML secret store. It is safe for concurrent use; every write
+// re-encrypts the whole file.
+type Store struct {
+	path       string
+	identities []age.Identity
+	recipients []age.Recipient
+
+	mu   sync.Mutex
+	data fileData
+}
+
+var _ vault.SecretStore = &Store{}
+
+type fileData struct {
+	Mounts  []string                 `yaml:"mounts,omitempty"`
+	Token   map[string]interface{}   `yaml:"token,omitempty"`
+	Secrets map[string]*storedSecret `yaml:"secrets"`
+}
+
+type storedSecret struct {
+	Version     int                    `yaml:"version"`
+	CreatedTime time.Time              `yaml:"created_time"`
+	UpdatedTime time.Time              `yaml:"updated_time"`
+	Data        map[string]interface{} `yaml:"data"`
+}
+
+// noCAS disables the check-and-set comparison on writes
+const noCAS = -1
+
+// Open loads the store at filename. A missing file yields an empty store that is created on the
+// first write.
+func Open(filename string, opts Options) (*Store, error) {
+	s := &Store{path: filename, data: fileData{Secrets: map[string]*storedSecret{}}}
+
+	if opts.IdentityFile != "" {
+		f, err := os.Open(expandHome(opts.IdentityFile))
+		if err != nil {
+			return nil, fmt.Errorf("failed to open age identity file: %w", err)
+		}
+		identities, err := age.ParseIdentities(f)
+		_ = f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse age identity file %s: %w", opts.IdentityFile, err)
+		}
+		s.identities = identities
+		for _, id := range identities {
+			if x, ok := id.(*age.X25519Identity); ok {
+				s.recipients = append(s.recipients, x.Recipient())
+			}
+		}
+	}
+	for _, r := range opts.Recipients {
+		recipient, err := age.ParseX25519Recipient(strings.TrimSpace(r))
+		if err != nil {
+			return nil, fmt.Errorf("invalid age recipient %q: %w", r, err)
+		}
+		s.recipients = append(s.recipients, recipient)
+	}
+
+	raw, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret store %s: %w", filename, err)
+	}
+	if err := s.decrypt(raw); err != nil {
+		return nil, fmt.Errorf("failed to load secret store %s: %w", filename, err)
+	}
+	return s, nil
+}
+
+func (s *Store) decrypt(raw []byte) error {
+	if len(s.identities) == 0 {
+		return fmt.Errorf("no age identity configured to decrypt it")
+	}
+	var src io.Reader = bytes.NewReader(raw)
+	if bytes.HasPrefix(bytes.TrimSpace(raw), []byte(armor.Header)) {
+		src = armor.NewReader(bytes.NewReader(bytes.TrimSpace(raw)))
+	}
+	r, err := age.Decrypt(src, s.identities...)
+	if err != nil {
+		return err
+	}
+	plain, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if err := yaml.Unmarshal(plain, &s.data); err != nil {
+		return fmt.Errorf("invalid YAML: %w", err)
+	}
+	if s.data.Secrets == nil {
+		s.data.Secrets = map[string]*storedSecret{}
+	}
+	normalized := make(map[string]*storedSecret, len(s.data.Secrets))
+	for p, secret := range s.data.Secrets {
+		if secret == nil {
+			continue
+		}
+		if secret.Version == 0 {
+			secret.Version = 1
+		}
+		normalized[cleanPath(p)] = secret
+	}
+	s.data.Secrets = normalized
+	return nil
+}
+
+// save encrypts the store (ASCII-armored) and atomically replaces the file; callers hold s.mu
+func (s *Store) save() error {
+	if len(s.recipients) == 0 {
+		return fmt.Errorf("cannot write secret store %s: no age recipients configured", s.path)
+	}
+	plain, err := yaml.Marshal(&s.data)
+	if err != nil {
+		return fmt.Errorf("failed to encode secret store: %w", err)
+	}
+
+	var buf bytes.Buffer
+	aw := armor.NewWriter(&buf)
+	w, err := age.Encrypt(aw, s.recipients...)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt secret store: %w", err)
+	}
+	if _, err := w.Write(plain); err != nil {
+		return fmt.Errorf("failed to encrypt secret store: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to encrypt secret store: %w", err)
+	}
+	if err := aw.Close(); err != nil {
+		return fmt.Errorf("failed to encrypt secret store: %w", err)
+	}
+
+	dir := filepath.Dir(s.path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create directory for secret store: %w", err)
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(s.path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to write secret store: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write secret store: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write secret store: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to replace secret store %s: %w", s.path, err)
+	}
+	return nil
+}
+
+// GetSecrets reads the secret at path.
+func (s *Store) GetSecrets(_ context.Context, p string) (map[string]interface{}, error) {
+	data, _, err := s.get(p, 0)
+	return data, err
+}
+
+// GetSecretsVersion reads the secret at path; only the current version (or 0) is available.
+func (s *Store) GetSecretsVersion(_ context.Context, p string, version int) (map[string]interface{}, error) {
+	data, _, err := s.get(p, version)
+	return data, err
+}
+
+// GetSecretsWithVersion reads the secret at path along with its current version.
+func (s *Store) GetSecretsWithVersion(_ context.Context, p string) (map[string]interface{}, int, error) {
+	return s.get(p, 0)
+}
+
+func (s *Store) get(p string, version int) (map[string]interface{}, int, error) {
+	key := cleanPath(p)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	secret, ok := s.data.Secrets[key]
+	if !ok {
+		return nil, 0, fmt.Errorf("no secret found at path %s: %w", key, vault.ErrNotFound)
+	}
+	if version > 0 && version != secret.Version {
+		return nil, 0, fmt.Errorf("version %d of %s is not available (the file store only keeps version %d): %w", version, key, secret.Version, vault.ErrNotFound)
+	}
+	return copyData(secret.Data), secret.Version, nil
+}
+
+// PutSecrets replaces the secret at path.
+func (s *Store) PutSecrets(_ context.Context, p string, data map[string]interface{}) error {
+	return s.write(p, data, noCAS, false)
+}
+
+// PutSecretsCAS replaces the secret only if its current version equals version (0 = must not exist).
+func (s *Store) PutSecretsCAS(_ context.Context, p string, data map[string]interface{}, version int) error {
+	return s.write(p, data, version, false)
+}
+
+// PatchSecrets merges data into the secret at path, creating it if needed.
+func (s *Store) PatchSecrets(_ context.Context, p string, data map[string]interface{}) error {
+	return s.write(p, data, noCAS, true)
+}
+
+// PatchSecretsCAS merges data only if the current version equals version (0 = must not exist).
+func (s *Store) PatchSecretsCAS(_ context.Context, p string, data map[string]interface{}, version int) error {
+	return s.write(p, data, version, true)
+}
+
+func (s *Store) write(p string, data map[string]interface{}, cas int, merge bool) error {
+	key := cleanPath(p)
+	if key == "" {
+		return fmt.Errorf("cannot write a secret at an empty path")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current, exists := s.data.Secrets[key]
+	currentVersion := 0
+	if exists {
+		currentVersion = current.Version
+	}
+	if cas != noCAS && cas != currentVersion {
+		return fmt.Errorf("%w: %s was modified since version %d", vault.ErrVersionConflict, key, cas)
+	}
+
+	now := time.Now().UTC()
+	next := &storedSecret{Version: currentVersion + 1, CreatedTime: now, UpdatedTime: now}
+	if exists {
+		next.CreatedTime = current.CreatedTime
+	}
+	if merge && exists {
+		next.Data = copyData(current.Data)
+		for k, v := range data {
+			next.Data[k] = v
+		}
+	} else {
+		next.Data = copyData(data)
+	}
+
+	s.data.Secrets[key] = next
+	if err := s.save(); err != nil {
+		if exists {
+			s.data.Secrets[key] = current
+		} else {
+			delete(s.data.Secrets, key)
+		}
+		return err
+	}
+	return nil
+}
+
+// ListSecrets lists the keys directly below path; folders end with "/".
+func (s *Store) ListSecrets(_ context.Context, p string) ([]string, error) {
+	prefix := cleanPath(p)
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	seen := map[string]bool{}
+	for key := range s.data.Secrets {
+		rest, ok := strings.CutPrefix(key, prefix)
+		if !ok || rest == "" {
+			continue
+		}
+		if idx := strings.Index(rest, "/"); idx >= 0 {
+			rest = rest[:idx+1]
+		}
+		seen[rest] = true
+	}
+	result := make([]string, 0, len(seen))
+	for k := range seen {
+		result = append(result, k)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// DeleteSecret removes the secret at path. The file store keeps no history, so this is permanent.
+func (s *Store) DeleteSecret(_ context.Context, p string) error {
+	key := cleanPath(p)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current, ok := s.data.Secrets[key]
+	if !ok {
+		return nil
+	}
+	delete(s.data.Secrets, key)
+	if err := s.save(); err != nil {
+		s.data.Secrets[key] = current
+		return err
+	}
+	return nil
+}
+
+// GetSecretMetadata describes the current version of the secret at path.
+func (s *Store) GetSecretMetadata(_ context.Context, p string) (*vault.SecretMetadata, error) {
+	key := cleanPath(p)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	secret, ok := s.data.Secrets[key]
+	if !ok {
+		return nil, fmt.Errorf("no secret found at path %s: %w", key, vault.ErrNotFound)
+	}
+	created, updated := secret.CreatedTime, secret.UpdatedTime
+	return &vault.SecretMetadata{
+		CurrentVersion: secret.Version,
+		OldestVersion:  secret.Version,
+		CreatedTime:    &created,
+		UpdatedTime:    &updated,
+		Versions: map[int]vault.SecretVersionMetadata{
+			secret.Version: {Version: secret.Version, CreatedTime: &updated},
+		},
+	}, nil
+}
+
+// IsAbsolutePath reports whether the first segment of p is a mount: one listed under "mounts:"
+// or the first segment of any stored secret. The file has no mount table to consult beyond that,
+// so this is deliberately the only rule: a relative path whose first segment happens to equal a
+// mount name (e.g. "secret/db" under base path "secret/app") is taken as absolute and not joined
+// onto the base path. A leading "/" does not change the result.
+func (s *Store) IsAbsolutePath(_ context.Context, p string) bool {
+	key := cleanPath(p)
+	mount, _, ok := strings.Cut(key, "/")
+	if !ok {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, m := range s.data.Mounts {
+		if strings.Trim(m, "/") == mount {
+			return true
+		}
+	}
+	for existing := range s.data.Secrets {
+		if strings.HasPrefix(existing, mount+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// JoinBaseAndPath joins p onto basePath unless p already starts with a mount.
+func (s *Store) JoinBaseAndPath(ctx context.Context, basePath, p string) string {
+	if basePath == "" || s.IsAbsolutePath(ctx, p) {
+		return cleanPath(p)
+	}
+	return cleanPath(basePath + "/" + p)
+}
+
+// LookupToken returns the "token:" section of the file, used for {{ .Token.* }} templates.
+func (s *Store) LookupToken(_ context.Context) (map[string]interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return copyData(s.data.Token), nil
+}
+
+// cleanPath normalises a secret path: no leading/trailing or duplicate slashes
+func cleanPath(p string) string {
+	p = strings.Trim(strings.TrimSpace(p), "/")
+	if p == "" {
+		return ""
+	}
+	return path.Clean(p)
+}
+
+func copyData(data map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(data))
+	for k, v := range data {
+		result[k] = v
+	}
+	return result
+}
+
+func expandHome(p string) string {
+	if p == "~" || strings.HasPrefix(p, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, strings.TrimPrefix(p, "~"))
+		}
+	}
+	return p
+}
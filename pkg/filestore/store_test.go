@@ -0,0 +1,214 @@
+package filestore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-go-golems/vault-envrc-generator/pkg/vault"
+)
+
+const plainStore = `mounts: [secret]
+token:
+  display_name: oidc-alice
+secrets:
+  secret/app/db:
+    data:
+      username: app
+      password: s3cret
+`
+
+// newIdentity writes a fresh age identity file and returns its path and recipient
+func newIdentity(t *testing.T) (string, *age.X25519Recipient) {
+	t.Helper()
+	id, err := age.GenerateX25519Identity()
+	require.NoError(t, err)
+	file := filepath.Join(t.TempDir(), "key.txt")
+	require.NoError(t, os.WriteFile(file, []byte(id.String()+"\n"), 0o600))
+	return file, id.Recipient()
+}
+
+func encrypt(t *testing.T, plain string, armored bool, recipients ...age.Recipient) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var aw io.WriteCloser = nopCloser{&buf}
+	if armored {
+		aw = armor.NewWriter(&buf)
+	}
+	w, err := age.Encrypt(aw, recipients...)
+	require.NoError(t, err)
+	_, err = w.Write([]byte(plain))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.NoError(t, aw.Close())
+	return buf.Bytes()
+}
+
+type nopCloser struct{ *bytes.Buffer }
+
+func (nopCloser) Close() error { return nil }
+
+func TestOpenDecryptsArmoredAndBinaryFiles(t *testing.T) {
+	identity, recipient := newIdentity(t)
+	ctx := context.Background()
+	for _, armored := range []bool{true, false} {
+		file := filepath.Join(t.TempDir(), "secrets.age")
+		require.NoError(t, os.WriteFile(file, encrypt(t, plainStore, armored, recipient), 0o600))
+
+		s, err := Open(file, Options{IdentityFile: identity})
+		require.NoError(t, err)
+		data, version, err := s.GetSecretsWithVersion(ctx, "/secret//app/db/")
+		require.NoError(t, err)
+		require.Equal(t, map[string]interface{}{"username": "app", "password": "s3cret"}, data)
+		require.Equal(t, 1, version)
+		token, err := s.LookupToken(ctx)
+		require.NoError(t, err)
+		require.Equal(t, "oidc-alice", token["display_name"])
+		require.True(t, s.IsAbsolutePath(ctx, "secret/other"))
+		require.Equal(t, "base/app", s.JoinBaseAndPath(ctx, "base", "app"))
+	}
+
+	_, err := Open(filepath.Join(t.TempDir(), "missing.age"), Options{})
+	require.NoError(t, err, "a missing file is an empty store")
+	file := filepath.Join(t.TempDir(), "secrets.age")
+	require.NoError(t, os.WriteFile(file, encrypt(t, plainStore, true, recipient), 0o600))
+	_, err = Open(file, Options{})
+	require.ErrorContains(t, err, "no age identity configured")
+}
+
+func TestWriteRoundTrip(t *testing.T) {
+	identity, _ := newIdentity(t)
+	teammateIdentity, teammate := newIdentity(t)
+	file := filepath.Join(t.TempDir(), "store", "secrets.age")
+	ctx := context.Background()
+
+	s, err := Open(file, Options{IdentityFile: identity, Recipients: []string{teammate.String()}})
+	require.NoError(t, err)
+	require.NoError(t, s.PutSecrets(ctx, "secret/app/db", map[string]interface{}{"password": "v1"}))
+	require.NoError(t, s.PatchSecrets(ctx, "secret/app/db", map[string]interface{}{"user": "app"}))
+
+	raw, err := os.ReadFile(file)
+	require.NoError(t, err)
+	require.True(t, bytes.HasPrefix(raw, []byte(armor.Header)), "written armored")
+	require.NotContains(t, string(raw), "v1")
+
+	// The teammate's identity decrypts what the first identity wrote
+	reopened, err := Open(file, Options{IdentityFile: teammateIdentity})
+	require.NoError(t, err)
+	data, version, err := reopened.GetSecretsWithVersion(ctx, "secret/app/db")
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{"password": "v1", "user": "app"}, data)
+	require.Equal(t, 2, version)
+	meta, err := reopened.GetSecretMetadata(ctx, "secret/app/db")
+	require.NoError(t, err)
+	require.Equal(t, 2, meta.CurrentVersion)
+
+	readOnly, err := Open(file, Options{IdentityFile: identity})
+	require.NoError(t, err)
+	readOnly.recipients = nil
+	require.ErrorContains(t, readOnly.PutSecrets(ctx, "secret/x", map[string]interface{}{"a": "b"}), "no age recipients configured")
+	_, err = readOnly.GetSecrets(ctx, "secret/x")
+	require.ErrorIs(t, err, vault.ErrNotFound, "a failed write is rolled back")
+}
+
+func TestCheckAndSet(t *testing.T) {
+	identity, _ := newIdentity(t)
+	s, err := Open(filepath.Join(t.TempDir(), "secrets.age"), Options{IdentityFile: identity})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	require.NoError(t, s.PutSecretsCAS(ctx, "secret/app", map[string]interface{}{"a": "1"}, 0))
+	require.ErrorIs(t, s.PutSecretsCAS(ctx, "secret/app", map[string]interface{}{"a": "2"}, 0), vault.ErrVersionConflict)
+	require.NoError(t, s.PutSecretsCAS(ctx, "secret/app", map[string]interface{}{"a": "2"}, 1))
+	require.ErrorIs(t, s.PatchSecretsCAS(ctx, "secret/app", map[string]interface{}{"b": "x"}, 1), vault.ErrVersionConflict)
+	require.NoError(t, s.PatchSecretsCAS(ctx, "secret/app", map[string]interface{}{"b": "x"}, 2))
+	require.ErrorIs(t, s.PatchSecretsCAS(ctx, "secret/new", map[string]interface{}{"b": "x"}, 1), vault.ErrVersionConflict)
+
+	data, version, err := s.GetSecretsWithVersion(ctx, "secret/app")
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{"a": "2", "b": "x"}, data)
+	require.Equal(t, 3, version)
+}
+
+func TestListAndDelete(t *testing.T) {
+	identity, _ := newIdentity(t)
+	file := filepath.Join(t.TempDir(), "secrets.age")
+	s, err := Open(file, Options{IdentityFile: identity})
+	require.NoError(t, err)
+	ctx := context.Background()
+	for _, p := range []string{"secret/app/db", "secret/app/api", "secret/app/nested/deep", "secret/shared"} {
+		require.NoError(t, s.PutSecrets(ctx, p, map[string]interface{}{"k": p}))
+	}
+
+	keys, err := s.ListSecrets(ctx, "secret")
+	require.NoError(t, err)
+	require.Equal(t, []string{"app/", "shared"}, keys)
+	keys, err = s.ListSecrets(ctx, "/secret/app/")
+	require.NoError(t, err)
+	require.Equal(t, []string{"api", "db", "nested/"}, keys)
+	keys, err = s.ListSecrets(ctx, "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"secret/"}, keys)
+
+	require.NoError(t, s.DeleteSecret(ctx, "secret/app/db"))
+	require.NoError(t, s.DeleteSecret(ctx, "secret/app/db"), "deleting a missing secret is a no-op")
+	_, err = s.GetSecrets(ctx, "secret/app/db")
+	require.ErrorIs(t, err, vault.ErrNotFound)
+
+	reopened, err := Open(file, Options{IdentityFile: identity})
+	require.NoError(t, err)
+	keys, err = reopened.ListSecrets(ctx, "secret/app")
+	require.NoError(t, err)
+	require.Equal(t, []string{"api", "nested/"}, keys)
+}
+
+func TestRelativePathCollidingWithMount(t *testing.T) {
+	identity, _ := newIdentity(t)
+	s, err := Open(filepath.Join(t.TempDir(), "secrets.age"), Options{IdentityFile: identity})
+	require.NoError(t, err)
+	ctx := context.Background()
+	s.data.Mounts = []string{"kv-team/"}
+	require.NoError(t, s.PutSecrets(ctx, "secret/app/db", map[string]interface{}{"k": "v"}))
+
+	require.Equal(t, "secret/app/db", s.JoinBaseAndPath(ctx, "secret/app", "db"))
+	require.Equal(t, "kv-team/x", s.JoinBaseAndPath(ctx, "secret/app", "/kv-team/x"))
+	// "secret" is the first segment of a stored secret, so this is absolute, not secret/app/secret/db
+	require.True(t, s.IsAbsolutePath(ctx, "secret/db"))
+	require.Equal(t, "secret/db", s.JoinBaseAndPath(ctx, "secret/app", "secret/db"))
+	require.False(t, s.IsAbsolutePath(ctx, "secret"))
+	require.Equal(t, "secret/app/secret", s.JoinBaseAndPath(ctx, "secret/app", "secret"))
+}
+
+func TestVersionedReads(t *testing.T) {
+	identity, _ := newIdentity(t)
+	s, err := Open(filepath.Join(t.TempDir(), "secrets.age"), Options{IdentityFile: identity})
+	require.NoError(t, err)
+	ctx := context.Background()
+	require.NoError(t, s.PutSecrets(ctx, "secret/app/db", map[string]interface{}{"password": "v1"}))
+	require.NoError(t, s.PutSecrets(ctx, "secret/app/db", map[string]interface{}{"password": "v2"}))
+
+	data, version, err := s.GetSecretsWithVersion(ctx, "secret/app/db")
+	require.NoError(t, err)
+	require.Equal(t, "v2", data["password"])
+	require.Equal(t, 2, version)
+
+	// Only the current version is kept
+	data, err = vault.GetSecretsRef(ctx, s, "secret/app/db@2")
+	require.NoError(t, err)
+	require.Equal(t, "v2", data["password"])
+	_, err = vault.GetSecretsRef(ctx, s, "secret/app/db@1")
+	require.ErrorIs(t, err, vault.ErrNotFound)
+	require.ErrorContains(t, err, "only keeps version 2")
+
+	// Without a reference, "@" is part of the path
+	_, _, err = s.GetSecretsWithVersion(ctx, "secret/app/db@2")
+	require.True(t, errors.Is(err, vault.ErrNotFound))
+}
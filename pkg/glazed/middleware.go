@@ -30,6 +30,7 @@ import (
 //
 // Notes:
 //   - Vault connection settings are read from the `vault` section (see vaultlayer.NewVaultSection).
+//     The token lookup and the secret read share one vault.Session, and --store-file is honored.
 //   - The secret path supports Go template expressions using the current token context,
 //     via {{ .Token.* }} values (see vault.BuildTemplateContext).
 func UpdateFromVault(path string, options ...fields.ParseOption) sources.Middleware {
@@ -49,15 +50,11 @@ func UpdateFromVault(path string, options ...fields.ParseOption) sources.Middlew
 			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 			defer cancel()
 
-			token, err := vault.ResolveToken(ctx, vs.VaultToken, vault.TokenSource(vs.VaultTokenSource), vs.VaultTokenFile, false)
+			session, err := vs.OpenSession(ctx)
 			if err != nil {
-				return fmt.Errorf("failed to resolve Vault token: %w", err)
-			}
-
-			client, err := vault.NewClient(vs.VaultAddr, token)
-			if err != nil {
-				return fmt.Errorf("failed to create Vault client: %w", err)
+				return err
 			}
+			defer session.Close()
 
 			// Support templated paths using the token context
 			effectivePath := strings.TrimSpace(path)
@@ -66,7 +63,7 @@ func UpdateFromVault(path string, options ...fields.ParseOption) sources.Middlew
 			}
 
 			if strings.Contains(effectivePath, "{{") {
-				tctx, err := vault.BuildTemplateContext(client)
+				tctx, err := vault.BuildTemplateContext(ctx, session)
 				if err != nil {
 					return fmt.Errorf("failed to build Vault template context: %w", err)
 				}
@@ -77,7 +74,7 @@ func UpdateFromVault(path string, options ...fields.ParseOption) sources.Middlew
 				}
 			}
 
-			secrets, err := client.GetSecrets(effectivePath)
+			secrets, err := session.GetSecrets(ctx, effectivePath)
 			if err != nil {
 				return fmt.Errorf("failed to retrieve secrets from %s: %w", effectivePath, err)
 			}
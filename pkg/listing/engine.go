@@ -0,0 +1,248 @@
+package listing
+
+import (
+	"context"
+	"strings"
+
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/semaphore"
+	"golang.org/x/time/rate"
+
+	"github.com/go-go-golems/vault-envrc-generator/pkg/vault"
+)
+
+// DefaultConcurrency is the number of in-flight requests used when Options.Concurrency is unset
+const DefaultConcurrency = 8
+
+// Options configures a traversal
+type Options struct {
+	// Depth limits recursion: 1 only lists the root, 0 is unlimited
+	Depth int
+	// Concurrency bounds the number of requests in flight at once
+	Concurrency int
+	// RateLimit caps requests per second across all workers (0 = unlimited)
+	RateLimit float64
+	// ReadSecrets reads every leaf secret into Node.Data
+	ReadSecrets bool
+	// ReadMetadata reads the KV v2 metadata of every leaf secret into Node.Metadata
+	ReadMetadata bool
+	// ListBoundaryDirs lists directories at the depth limit to fill Node.Children without descending
+	ListBoundaryDirs bool
+}
+
+// Node is a path discovered during a traversal. Directory paths end with '/'.
+type Node struct {
+	Path  string
+	Dir   bool
+	Depth int
+	// Children holds the keys below a directory that was listed
+	Children []string
+	// Data and Metadata are filled for leaves when requested in Options
+	Data        map[string]interface{}
+	Metadata    *vault.SecretMetadata
+	MetadataErr error
+	// Err is the listing error of a directory or the read error of a leaf
+	Err error
+}
+
+// Engine traverses a secret store with a bounded number of concurrent, rate-limited requests
+type Engine struct {
+	client  vault.SecretStore
+	opts    Options
+	sem     *semaphore.Weighted
+	limiter *rate.Limiter
+}
+
+// NewEngine creates a traversal engine over client
+func NewEngine(client vault.SecretStore, opts Options) *Engine {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = DefaultConcurrency
+	}
+	e := &Engine{
+		client: client,
+		opts:   opts,
+		sem:    semaphore.NewWeighted(int64(opts.Concurrency)),
+	}
+	if opts.RateLimit > 0 {
+		burst := int(opts.RateLimit)
+		if burst < 1 {
+			burst = 1
+		}
+		e.limiter = rate.NewLimiter(rate.Limit(opts.RateLimit), burst)
+	}
+	return e
+}
+
+// Do runs fn as one request under the engine's concurrency bound and rate limit
+func (e *Engine) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	if err := e.sem.Acquire(ctx, 1); err != nil {
+		return err
+	}
+	defer e.sem.Release(1)
+	if e.limiter != nil {
+		if err := e.limiter.Wait(ctx); err != nil {
+			return err
+		}
+	}
+	return fn(ctx)
+}
+
+// ForEach calls fn concurrently for every path, each call counting as one request. The first
+// error returned by fn cancels the remaining calls and is returned.
+func (e *Engine) ForEach(ctx context.Context, paths []string, fn func(ctx context.Context, path string) error) error {
+	eg, ctx := errgroup.WithContext(ctx)
+	for _, p := range paths {
+		eg.Go(func() error {
+			return e.Do(ctx, func(ctx context.Context) error { return fn(ctx, p) })
+		})
+	}
+	return eg.Wait()
+}
+
+// Traverse walks the tree below path and streams every directory and secret to fn as soon as it
+// is discovered, in no particular order. fn is never called concurrently; returning an error from
+// it stops the traversal. The root itself is only reported when it is a leaf secret or cannot be
+// listed.
+func (e *Engine) Traverse(ctx context.Context, path string, fn func(Node) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	nodes := make(chan Node)
+	eg, gctx := errgroup.WithContext(ctx)
+	eg.Go(func() error {
+		return e.visitDir(gctx, eg, nodes, vault.NormalizeListPath(path), 0, true)
+	})
+	done := make(chan error, 1)
+	go func() {
+		done <- eg.Wait()
+		close(nodes)
+	}()
+
+	var fnErr error
+	for n := range nodes {
+		if fnErr != nil {
+			continue
+		}
+		if err := fn(n); err != nil {
+			fnErr = err
+			cancel()
+		}
+	}
+	if err := <-done; fnErr == nil {
+		return err
+	}
+	return fnErr
+}
+
+func (e *Engine) visitDir(ctx context.Context, eg *errgroup.Group, out chan<- Node, path string, depth int, descend bool) error {
+	var keys []string
+	err := e.Do(ctx, func(ctx context.Context) error {
+		var err error
+		keys, err = e.client.ListSecrets(ctx, path)
+		return err
+	})
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	// A failed or empty listing may mean the path is a leaf secret (KV v2 metadata lists return
+	// nothing for leaves)
+	if err != nil || len(keys) == 0 {
+		trimmed := strings.TrimSuffix(path, "/")
+		if trimmed != "" {
+			var data map[string]interface{}
+			rerr := e.Do(ctx, func(ctx context.Context) error {
+				var err error
+				data, err = e.client.GetSecrets(ctx, trimmed)
+				return err
+			})
+			if rerr == nil {
+				if depth > 0 {
+					if err := e.emit(ctx, out, Node{Path: path, Dir: true, Depth: depth, Err: err}); err != nil {
+						return err
+					}
+				}
+				return e.visitLeaf(ctx, out, trimmed, depth, data)
+			}
+		}
+		if err != nil {
+			return e.emit(ctx, out, Node{Path: path, Dir: true, Depth: depth, Err: err})
+		}
+	}
+
+	if depth > 0 {
+		if err := e.emit(ctx, out, Node{Path: path, Dir: true, Depth: depth, Children: keys}); err != nil {
+			return err
+		}
+	}
+	if !descend {
+		return nil
+	}
+
+	childDepth := depth + 1
+	for _, k := range keys {
+		full := path + k
+		if strings.HasSuffix(k, "/") {
+			next := e.opts.Depth == 0 || childDepth < e.opts.Depth
+			if !next && !e.opts.ListBoundaryDirs {
+				if err := e.emit(ctx, out, Node{Path: full, Dir: true, Depth: childDepth}); err != nil {
+					return err
+				}
+				continue
+			}
+			eg.Go(func() error { return e.visitDir(ctx, eg, out, full, childDepth, next) })
+			continue
+		}
+		if !e.opts.ReadSecrets && !e.opts.ReadMetadata {
+			if err := e.emit(ctx, out, Node{Path: full, Depth: childDepth}); err != nil {
+				return err
+			}
+			continue
+		}
+		eg.Go(func() error {
+			n := Node{Path: full, Depth: childDepth}
+			if e.opts.ReadSecrets {
+				n.Err = e.Do(ctx, func(ctx context.Context) error {
+					var err error
+					n.Data, err = e.client.GetSecrets(ctx, full)
+					return err
+				})
+			}
+			return e.finishLeaf(ctx, out, n)
+		})
+	}
+	return nil
+}
+
+// visitLeaf reports a path that turned out to be a secret after its data was already read
+func (e *Engine) visitLeaf(ctx context.Context, out chan<- Node, path string, depth int, data map[string]interface{}) error {
+	n := Node{Path: path, Depth: depth}
+	if e.opts.ReadSecrets {
+		n.Data = data
+	}
+	return e.finishLeaf(ctx, out, n)
+}
+
+func (e *Engine) finishLeaf(ctx context.Context, out chan<- Node, n Node) error {
+	if e.opts.ReadMetadata {
+		err := e.Do(ctx, func(ctx context.Context) error {
+			var err error
+			n.Metadata, err = e.client.GetSecretMetadata(ctx, n.Path)
+			return err
+		})
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		n.MetadataErr = err
+	}
+	return e.emit(ctx, out, n)
+}
+
+func (e *Engine) emit(ctx context.Context, out chan<- Node, n Node) error {
+	select {
+	case out <- n:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,134 @@
+package listing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-go-golems/vault-envrc-generator/pkg/vault"
+	"github.com/go-go-golems/vault-envrc-generator/pkg/vaulttest"
+)
+
+// slowStore delays every read and records the highest number of concurrent calls
+type slowStore struct {
+	vault.SecretStore
+	mu       sync.Mutex
+	inFlight int
+	peak     int
+}
+
+func (s *slowStore) track() func() {
+	s.mu.Lock()
+	s.inFlight++
+	if s.inFlight > s.peak {
+		s.peak = s.inFlight
+	}
+	s.mu.Unlock()
+	time.Sleep(5 * time.Millisecond)
+	return func() {
+		s.mu.Lock()
+		s.inFlight--
+		s.mu.Unlock()
+	}
+}
+
+func (s *slowStore) ListSecrets(ctx context.Context, path string) ([]string, error) {
+	defer s.track()()
+	return s.SecretStore.ListSecrets(ctx, path)
+}
+
+func (s *slowStore) GetSecrets(ctx context.Context, path string) (map[string]interface{}, error) {
+	defer s.track()()
+	return s.SecretStore.GetSecrets(ctx, path)
+}
+
+func TestTraverseReadsSecretsConcurrently(t *testing.T) {
+	srv := vaulttest.NewServer(t)
+	srv.LoadFixtureYAML([]byte(walkFixture))
+	store := &slowStore{SecretStore: srv.Client()}
+
+	data := map[string]map[string]interface{}{}
+	var dirs []string
+	engine := NewEngine(store, Options{Concurrency: 2, ReadSecrets: true, ReadMetadata: true})
+	err := engine.Traverse(context.Background(), "secret/app", func(n Node) error {
+		require.NoError(t, n.Err)
+		if n.Dir {
+			dirs = append(dirs, n.Path)
+			require.Equal(t, []string{"token", "webhook"}, n.Children)
+			return nil
+		}
+		require.NoError(t, n.MetadataErr)
+		require.Equal(t, 1, n.Metadata.CurrentVersion)
+		data[n.Path] = n.Data
+		return nil
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"secret/app/api/"}, dirs)
+	require.Equal(t, map[string]map[string]interface{}{
+		"secret/app/db":          {"username": "app"},
+		"secret/app/api/token":   {"value": "t0k3n"},
+		"secret/app/api/webhook": {"url": "https://example.com"},
+	}, data)
+	require.LessOrEqual(t, store.peak, 2)
+}
+
+func TestTraverseListsBoundaryDirs(t *testing.T) {
+	srv := vaulttest.NewServer(t)
+	srv.LoadFixtureYAML([]byte(walkFixture))
+
+	children := map[string][]string{}
+	engine := NewEngine(srv.Client(), Options{Depth: 1, ListBoundaryDirs: true})
+	require.NoError(t, engine.Traverse(context.Background(), "secret", func(n Node) error {
+		if n.Dir {
+			children[n.Path] = n.Children
+		}
+		return nil
+	}))
+	require.Equal(t, map[string][]string{"secret/app/": {"api/", "db"}}, children)
+}
+
+func TestTraverseStopsOnCallbackError(t *testing.T) {
+	srv := vaulttest.NewServer(t)
+	srv.LoadFixtureYAML([]byte(walkFixture))
+	store := &slowStore{SecretStore: srv.Client()}
+
+	stop := errors.New("stop")
+	var seen []string
+	err := NewEngine(store, Options{Concurrency: 1}).Traverse(context.Background(), "secret", func(n Node) error {
+		seen = append(seen, n.Path)
+		return stop
+	})
+	require.ErrorIs(t, err, stop)
+	require.Len(t, seen, 1)
+}
+
+func TestForEachRateLimit(t *testing.T) {
+	engine := NewEngine(nil, Options{Concurrency: 4, RateLimit: 20})
+	paths := make([]string, 25)
+	for i := range paths {
+		paths[i] = fmt.Sprintf("secret/p%d", i)
+	}
+	var calls atomic.Int64
+
+	start := time.Now()
+	err := engine.ForEach(context.Background(), paths, func(ctx context.Context, p string) error {
+		calls.Add(1)
+		return nil
+	})
+	require.NoError(t, err)
+	require.EqualValues(t, len(paths), calls.Load())
+	// The burst covers the first 20 calls; the remaining 5 are spaced 50ms apart
+	require.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = engine.ForEach(ctx, []string{"x"}, func(ctx context.Context, p string) error { return nil })
+	require.ErrorIs(t, err, context.Canceled)
+}
@@ -1,55 +1,34 @@
 package listing
 
 import (
+	"context"
 	"fmt"
 	"sort"
-	"strings"
 
 	"github.com/go-go-golems/vault-envrc-generator/pkg/vault"
 )
 
-// Walk recursively lists keys and subdirectories up to depth
-func Walk(client *vault.Client, path string, depth int) ([]string, []error) {
-	return walkVault(client, vault.NormalizeListPath(path), depth)
+// Walk recursively lists keys and subdirectories up to depth and returns them sorted
+func Walk(ctx context.Context, client vault.SecretStore, path string, depth int) ([]string, []error) {
+	return NewEngine(client, Options{Depth: depth}).Walk(ctx, path)
 }
 
-func walkVault(client *vault.Client, path string, depth int) ([]string, []error) {
+// Walk collects the traversal below path into a sorted list of paths and the listing errors
+func (e *Engine) Walk(ctx context.Context, path string) ([]string, []error) {
 	var results []string
 	var errs []error
-
-	keys, err := client.ListSecrets(path)
-	if err != nil {
-		// Fallback: try to treat path (without trailing '/') as a secret leaf
-		trimmed := strings.TrimSuffix(path, "/")
-		if trimmed != "" {
-			if _, err2 := client.GetSecrets(trimmed); err2 == nil {
-				// Return the leaf secret path
-				results = append(results, trimmed)
-				sort.Strings(results)
-				return results, errs
-			}
+	err := e.Traverse(ctx, path, func(n Node) error {
+		if n.Depth > 0 || !n.Dir {
+			results = append(results, n.Path)
 		}
-		errs = append(errs, fmt.Errorf("%s: %w", path, err))
-		return results, errs
-	}
-
-	for _, k := range keys {
-		full := path + k
-		results = append(results, full)
-		if strings.HasSuffix(k, "/") {
-			if depth == 1 {
-				continue
-			}
-			nextDepth := depth
-			if nextDepth > 0 {
-				nextDepth = depth - 1
-			}
-			subResults, subErrs := walkVault(client, full, nextDepth)
-			results = append(results, subResults...)
-			errs = append(errs, subErrs...)
+		if n.Err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", n.Path, n.Err))
 		}
+		return nil
+	})
+	if err != nil {
+		errs = append(errs, err)
 	}
-
 	sort.Strings(results)
 	return results, errs
 }
@@ -0,0 +1,96 @@
+package listing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-go-golems/vault-envrc-generator/pkg/vaulttest"
+)
+
+const walkFixture = `
+mounts:
+  legacy: 1
+secrets:
+  secret/app/db: {username: app}
+  secret/app/api/token: {value: t0k3n}
+  secret/app/api/webhook: {url: https://example.com}
+  secret/other: {a: b}
+  legacy/service/key: {value: v1}
+`
+
+func TestWalk(t *testing.T) {
+	srv := vaulttest.NewServer(t)
+	srv.LoadFixtureYAML([]byte(walkFixture))
+	client := srv.Client()
+	ctx := context.Background()
+
+	tests := []struct {
+		name  string
+		path  string
+		depth int
+		want  []string
+	}{
+		{
+			name:  "unlimited depth",
+			path:  "secret/app",
+			depth: 0,
+			want:  []string{"secret/app/api/", "secret/app/api/token", "secret/app/api/webhook", "secret/app/db"},
+		},
+		{
+			name:  "depth one stops at folders",
+			path:  "secret/app/",
+			depth: 1,
+			want:  []string{"secret/app/api/", "secret/app/db"},
+		},
+		{
+			name:  "leaf secret",
+			path:  "secret/app/db",
+			depth: 0,
+			want:  []string{"secret/app/db"},
+		},
+		{
+			name:  "KV v1 mount",
+			path:  "legacy",
+			depth: 0,
+			want:  []string{"legacy/service/", "legacy/service/key"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, errs := Walk(ctx, client, tt.path, tt.depth)
+			require.Empty(t, errs)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestWalkUsesMetadataListing(t *testing.T) {
+	srv := vaulttest.NewServer(t)
+	srv.LoadFixtureYAML([]byte(walkFixture))
+	client := srv.Client()
+	srv.ResetRequests()
+
+	_, errs := Walk(context.Background(), client, "secret/app", 1)
+	require.Empty(t, errs)
+
+	var lists []string
+	for _, r := range srv.Requests() {
+		if r.Method == "LIST" {
+			lists = append(lists, r.Path)
+		}
+	}
+	require.Equal(t, []string{"secret/metadata/app"}, lists)
+}
+
+func TestWalkReportsDeniedPaths(t *testing.T) {
+	srv := vaulttest.NewServer(t)
+	srv.LoadFixtureYAML([]byte(walkFixture))
+	srv.Deny("secret/metadata/app/api/")
+	client := srv.Client()
+
+	got, errs := Walk(context.Background(), client, "secret/app", 0)
+	require.Len(t, errs, 1)
+	require.Equal(t, []string{"secret/app/api/", "secret/app/db"}, got)
+}
@@ -0,0 +1,80 @@
+package output
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// dirManifest lists the files written to a secrets directory, so that files for keys that no
+// longer exist can be removed without touching files other tools put there
+const dirManifest = ".vault-envrc-generator"
+
+// writeDir writes each file into dir with mode perm, replacing files atomically, and removes
+// the files of the previous run that are not part of files. A new dir is created with mode 0700.
+// Callers hold the lock for dir.
+func writeDir(dir string, files map[string]string, perm os.FileMode) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create output directory %s: %w", dir, err)
+	}
+	previous, err := readDirManifest(dir)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(files))
+	for name, content := range files {
+		if err := writeFileAtomic(filepath.Join(dir, name), []byte(content), perm); err != nil {
+			return err
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range previous {
+		if _, ok := files[name]; ok {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, name)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove stale secret file: %w", err)
+		}
+		log.Debug().Str("dir", dir).Str("file", name).Msg("removed stale secret file")
+	}
+
+	manifest := strings.Join(names, "\n")
+	if manifest != "" {
+		manifest += "\n"
+	}
+	if err := writeFileAtomic(filepath.Join(dir, dirManifest), []byte(manifest), 0600); err != nil {
+		return err
+	}
+	log.Debug().Str("dir", dir).Int("files", len(names)).Msg("secrets directory written")
+	return nil
+}
+
+func readDirManifest(dir string) ([]string, error) {
+	f, err := os.Open(filepath.Join(dir, dirManifest))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", dirManifest, err)
+	}
+	defer func() { _ = f.Close() }()
+	var names []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// Ignore anything that is not a plain file name so a tampered manifest cannot remove
+		// files outside dir
+		name := strings.TrimSpace(scanner.Text())
+		if name != "" && name == filepath.Base(name) && !strings.HasPrefix(name, ".") {
+			names = append(names, name)
+		}
+	}
+	return names, scanner.Err()
+}
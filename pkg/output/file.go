@@ -0,0 +1,116 @@
+package output
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultFileMode is the permission of written files unless WriteOptions.Mode is set. Outputs
+// hold secrets, so only the owner can read them.
+const DefaultFileMode os.FileMode = 0600
+
+// ParseFileMode parses an octal permission such as "0640". An empty string yields 0, which
+// writers treat as DefaultFileMode.
+func ParseFileMode(s string) (os.FileMode, error) {
+	if s == "" {
+		return 0, nil
+	}
+	mode, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("invalid file mode %q: expected octal permissions such as 0600", s)
+	}
+	return os.FileMode(mode), nil
+}
+
+func (o WriteOptions) fileMode() os.FileMode {
+	if o.Mode == 0 {
+		return DefaultFileMode
+	}
+	return o.Mode
+}
+
+// Replace writes content to path without merging, under the same locking, permissions and
+// backup handling as Write
+func Replace(path string, content []byte, opts WriteOptions) error {
+	if dir := filepath.Dir(path); dir != "" && dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create output directory %s: %w", dir, err)
+		}
+	}
+	unlock, err := lockOutput(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return replaceFile(path, content, opts)
+}
+
+// replaceFile atomically replaces path with content, first copying the previous content to
+// path.bak when opts.Backup is set. A symlinked path has its target replaced. Callers hold
+// the lock for path.
+func replaceFile(path string, content []byte, opts WriteOptions) error {
+	if target, err := filepath.EvalSymlinks(path); err == nil {
+		path = target
+	}
+	if opts.Backup {
+		previous, err := os.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to read %s for backup: %w", path, err)
+		}
+		if err == nil && !bytes.Equal(previous, content) {
+			if err := writeFileAtomic(path+".bak", previous, opts.fileMode()); err != nil {
+				return err
+			}
+			log.Debug().Str("path", path+".bak").Msg("previous output backed up")
+		}
+	}
+	return writeFileAtomic(path, content, opts.fileMode())
+}
+
+// writeFileAtomic writes content to a temporary file next to path, syncs it and renames it
+// into place, so readers and crashes never see a partial file
+func writeFileAtomic(path string, content []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file for %s: %w", path, err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err := tmp.Write(content); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to set permissions on %s: %w", path, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to sync %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+	syncDir(filepath.Dir(path))
+	return nil
+}
+
+// syncDir makes a rename in dir durable. Not every platform can sync a directory, so errors
+// are only logged.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	defer func() { _ = d.Close() }()
+	if err := d.Sync(); err != nil {
+		log.Debug().Err(err).Str("dir", dir).Msg("directory sync failed")
+	}
+}
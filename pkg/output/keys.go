@@ -0,0 +1,74 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/go-go-golems/vault-envrc-generator/pkg/envrc"
+)
+
+// keyStateSuffix names the sidecar file <path>.vault-envrc-generator that records which keys
+// each owner wrote to a structured output
+const keyStateSuffix = ".vault-envrc-generator"
+
+type keyState struct {
+	Owners map[string][]envrc.KeyPath `json:"owners"`
+}
+
+// readKeyState reads the sidecar of path. A missing or unreadable sidecar yields an empty state,
+// so nothing is pruned.
+func readKeyState(path string) *keyState {
+	state := &keyState{Owners: map[string][]envrc.KeyPath{}}
+	b, err := os.ReadFile(path + keyStateSuffix)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warn().Err(err).Str("path", path).Msg("failed to read owned keys, not pruning")
+		}
+		return state
+	}
+	if err := json.Unmarshal(b, state); err != nil {
+		log.Warn().Err(err).Str("path", path).Msg("failed to parse owned keys, not pruning")
+		return &keyState{Owners: map[string][]envrc.KeyPath{}}
+	}
+	if state.Owners == nil {
+		state.Owners = map[string][]envrc.KeyPath{}
+	}
+	return state
+}
+
+// stale returns the keys owner wrote before that neither owner nor another owner writes now
+func (s *keyState) stale(owner string, keys []envrc.KeyPath) []envrc.KeyPath {
+	current := map[string]bool{}
+	for _, key := range keys {
+		current[keyID(key)] = true
+	}
+	for other, owned := range s.Owners {
+		if other == owner {
+			continue
+		}
+		for _, key := range owned {
+			current[keyID(key)] = true
+		}
+	}
+	var stale []envrc.KeyPath
+	for _, key := range s.Owners[owner] {
+		if !current[keyID(key)] {
+			stale = append(stale, key)
+		}
+	}
+	return stale
+}
+
+func (s *keyState) write(path string, perm os.FileMode) error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode owned keys of %s: %w", path, err)
+	}
+	return writeFileAtomic(path+keyStateSuffix, append(b, '\n'), perm)
+}
+
+func keyID(key envrc.KeyPath) string { return strings.Join(key, "\x00") }
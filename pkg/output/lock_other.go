@@ -0,0 +1,9 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package output
+
+// lockFile is a no-op where flock is unavailable; writes are then only serialized within
+// one process
+func lockFile(string) (func(), error) {
+	return func() {}, nil
+}
@@ -1,20 +1,30 @@
 package output
 
 import (
-	"bytes"
-	"encoding/json"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"os"
-	"sort"
+	"path/filepath"
 	"sync"
 
 	"github.com/rs/zerolog/log"
-	"gopkg.in/yaml.v3"
+
+	"github.com/go-go-golems/vault-envrc-generator/pkg/envrc"
 )
 
 type WriteOptions struct {
-	Format   string // envrc|json|yaml
+	Format   string // name of a registered envrc.Formatter
 	SortKeys bool
+	Mode     os.FileMode // permission of written files; 0 means DefaultFileMode
+	Backup   bool        // keep the previous content of a replaced file in <path>.bak
+	// Block names a managed block: content replaces only that block of the file instead of
+	// being merged. Needs a format with comments (envrc.Commenter).
+	Block string
+	// Owner names the writer of the content. For envrc.Keyed formats, the keys each owner
+	// writes are recorded next to the file, and keys the owner wrote before but no longer
+	// writes are removed. Keys added by hand are kept.
+	Owner string
 }
 
 var outputLocks = struct {
@@ -34,7 +44,68 @@ func lockForPath(path string) func() {
 	return func() { m.Unlock() }
 }
 
-// Write writes content to path according to options, performing merges for json/yaml
+// lockDir returns the directory holding the flock files, creating it if needed. Lock files
+// live in the user cache directory rather than next to the outputs so they never end up in a
+// project tree.
+func lockDir() (string, error) {
+	base, err := os.UserCacheDir()
+	if err != nil {
+		base = os.TempDir()
+	}
+	dir := filepath.Join(base, "vault-envrc-generator", "locks")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// lockFilePath returns the flock file for path, named after a hash of its absolute path with
+// symlinks resolved, so every process writing the same file picks the same lock
+func lockFilePath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		abs = resolved
+	} else if dir, err := filepath.EvalSymlinks(filepath.Dir(abs)); err == nil {
+		// The file does not exist yet
+		abs = filepath.Join(dir, filepath.Base(abs))
+	}
+	dir, err := lockDir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(abs))
+	return filepath.Join(dir, hex.EncodeToString(sum[:16])+".lock"), nil
+}
+
+// lockOutput serializes writes to path: goroutines through lockForPath and processes through
+// an flock on a lock file under the user cache directory (see lockFilePath)
+func lockOutput(path string) (func(), error) {
+	log.Debug().Str("path", path).Msg("acquiring output lock")
+	unlock := lockForPath(path)
+	lockPath, err := lockFilePath(path)
+	if err != nil {
+		unlock()
+		return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+	}
+	unlockFile, err := lockFile(lockPath)
+	if err != nil {
+		unlock()
+		return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+	}
+	log.Debug().Str("path", path).Msg("acquired output lock")
+	return func() {
+		unlockFile()
+		unlock()
+	}, nil
+}
+
+// Write writes content to path, merging it with the existing file using the format's Formatter,
+// or replacing the managed block opts.Block. For formats that write a directory (envrc.FileSet),
+// path is the directory. Files are replaced atomically with opts.Mode while holding the lock for
+// path.
 func Write(path string, content []byte, opts WriteOptions) error {
 	// stdout special-case
 	if path == "-" {
@@ -49,145 +120,68 @@ func Write(path string, content []byte, opts WriteOptions) error {
 		}
 	}
 
-	log.Debug().Str("path", path).Msg("acquiring output lock")
-	unlock := lockForPath(path)
-	log.Debug().Str("path", path).Msg("acquired output lock")
+	unlock, err := lockOutput(path)
+	if err != nil {
+		return err
+	}
 	defer unlock()
 	log.Debug().Str("path", path).Str("format", opts.Format).Int("size", len(content)).Msg("write start")
 
-	switch opts.Format {
-	case "json":
-		var existing map[string]interface{}
-		if b, err := os.ReadFile(path); err == nil && len(b) > 0 {
-			_ = json.Unmarshal(b, &existing)
-		}
-		if existing == nil {
-			existing = map[string]interface{}{}
-		}
-		var next map[string]interface{}
-		if err := json.Unmarshal(content, &next); err != nil {
-			return fmt.Errorf("failed to parse generated JSON for merge: %w", err)
-		}
-		for k, v := range next {
-			existing[k] = v
-		}
-		if opts.SortKeys {
-			keys := make([]string, 0, len(existing))
-			for k := range existing {
-				keys = append(keys, k)
-			}
-			sort.Strings(keys)
-			// custom ordered marshal to keep deterministic key order
-			var bld bytes.Buffer
-			bld.WriteByte('{')
-			for i, k := range keys {
-				kb, _ := json.Marshal(k)
-				vb, err := json.Marshal(existing[k])
-				if err != nil {
-					return fmt.Errorf("failed to marshal ordered json value: %w", err)
-				}
-				if i == 0 {
-					bld.WriteByte('\n')
-				} else {
-					bld.WriteByte(',')
-					bld.WriteByte('\n')
-				}
-				bld.WriteString("  ")
-				bld.Write(kb)
-				bld.WriteString(": ")
-				bld.Write(vb)
-			}
-			if len(keys) > 0 {
-				bld.WriteByte('\n')
-			}
-			bld.WriteByte('}')
-			if err := os.WriteFile(path, bld.Bytes(), 0644); err != nil {
-				return err
-			}
-			log.Debug().Str("path", path).Int("bytes", bld.Len()).Msg("merge json ordered written")
-			return nil
-		}
-		buf, err := json.MarshalIndent(existing, "", "  ")
+	f, err := envrc.LookupFormatter(opts.Format)
+	if err != nil {
+		return err
+	}
+	c, isCommenter := f.(envrc.Commenter)
+	if opts.Block != "" && !isCommenter {
+		return fmt.Errorf("format %s does not support managed blocks", f.Name())
+	}
+	if fs, ok := f.(envrc.FileSet); ok {
+		files, err := fs.Files(string(content))
 		if err != nil {
-			return fmt.Errorf("failed to marshal merged JSON: %w", err)
-		}
-		if err := os.WriteFile(path, buf, 0644); err != nil {
 			return err
 		}
-		log.Debug().Str("path", path).Int("bytes", len(buf)).Msg("merge json written")
-		return nil
-	case "yaml":
-		var existing map[string]interface{}
-		if b, err := os.ReadFile(path); err == nil && len(b) > 0 {
-			_ = yaml.Unmarshal(b, &existing)
-		}
-		if existing == nil {
-			existing = map[string]interface{}{}
-		}
-		var next map[string]interface{}
-		if err := yaml.Unmarshal(content, &next); err != nil {
-			return fmt.Errorf("failed to parse generated YAML for merge: %w", err)
-		}
-		for k, v := range next {
-			existing[k] = v
-		}
-		if opts.SortKeys {
-			keys := make([]string, 0, len(existing))
-			for k := range existing {
-				keys = append(keys, k)
-			}
-			sort.Strings(keys)
-			node := &yaml.Node{Kind: yaml.MappingNode}
-			for _, k := range keys {
-				keyNode := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: k}
-				var valueDoc yaml.Node
-				b, err := yaml.Marshal(existing[k])
-				if err != nil {
-					return fmt.Errorf("failed to marshal yaml value: %w", err)
-				}
-				if err := yaml.Unmarshal(b, &valueDoc); err != nil {
-					return fmt.Errorf("failed to unmarshal yaml value to node: %w", err)
-				}
-				var valueNode *yaml.Node
-				if len(valueDoc.Content) == 0 {
-					valueNode = &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "~"}
-				} else {
-					valueNode = valueDoc.Content[0]
-				}
-				node.Content = append(node.Content, keyNode, valueNode)
-			}
-			buf, err := yaml.Marshal(node)
-			if err != nil {
-				return fmt.Errorf("failed to marshal ordered YAML: %w", err)
-			}
-			if err := os.WriteFile(path, buf, 0644); err != nil {
-				return err
-			}
-			log.Debug().Str("path", path).Int("bytes", len(buf)).Msg("merge yaml ordered written")
-			return nil
-		}
-		buf, err := yaml.Marshal(existing)
+		return writeDir(path, files, opts.fileMode())
+	}
+	existing, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read existing output %s: %w", path, err)
+	}
+	fopts := envrc.FormatOptions{SortKeys: opts.SortKeys}
+	var state *keyState
+	keyed, isKeyed := f.(envrc.Keyed)
+	if opts.Owner != "" && isKeyed {
+		keys, err := keyed.Keys(string(content))
 		if err != nil {
-			return fmt.Errorf("failed to marshal merged YAML: %w", err)
-		}
-		if err := os.WriteFile(path, buf, 0644); err != nil {
-			return err
+			return fmt.Errorf("failed to read keys of generated %s output: %w", f.Name(), err)
 		}
-		log.Debug().Str("path", path).Int("bytes", len(buf)).Msg("merge yaml written")
-		return nil
-	default:
-		// For envrc and other text formats, append content
-		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
-		if err != nil {
-			return fmt.Errorf("failed to open output file %s: %w", path, err)
+		state = readKeyState(path)
+		fopts.Prune = state.stale(opts.Owner, keys)
+		if len(keys) > 0 {
+			state.Owners[opts.Owner] = keys
+		} else {
+			delete(state.Owners, opts.Owner)
 		}
-		defer func() { _ = f.Close() }()
-		if _, err := f.Write(content); err != nil {
-			return fmt.Errorf("failed to append to %s: %w", path, err)
+		log.Debug().Str("path", path).Str("owner", opts.Owner).Int("pruned", len(fopts.Prune)).Msg("pruning stale keys")
+	}
+	var merged []byte
+	if opts.Block != "" {
+		merged, err = envrc.ReplaceBlock(c, existing, opts.Block, string(content))
+	} else {
+		merged, err = f.Merge(existing, string(content), fopts)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update %s: %w", path, err)
+	}
+	if err := replaceFile(path, merged, opts); err != nil {
+		return err
+	}
+	if state != nil {
+		if err := state.write(path, opts.fileMode()); err != nil {
+			return err
 		}
-		log.Debug().Str("path", path).Int("bytes", len(content)).Msg("append text written")
-		return nil
 	}
+	log.Debug().Str("path", path).Str("format", f.Name()).Int("bytes", len(merged)).Msg("merged output written")
+	return nil
 }
 
 func dirOf(path string) string {
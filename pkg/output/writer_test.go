@@ -0,0 +1,169 @@
+package output
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-go-golems/vault-envrc-generator/pkg/envrc"
+)
+
+func TestWriteModeAndBackup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"A": "old"}`), 0o644))
+
+	require.NoError(t, Write(path, []byte(`{"B": "1"}`), WriteOptions{Format: "json", SortKeys: true, Backup: true}))
+	fi, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, DefaultFileMode, fi.Mode().Perm())
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "{\n  \"A\": \"old\",\n  \"B\": \"1\"\n}", string(content))
+	backup, err := os.ReadFile(path + ".bak")
+	require.NoError(t, err)
+	require.Equal(t, `{"A": "old"}`, string(backup))
+
+	require.NoError(t, Replace(path, []byte("{}"), WriteOptions{Mode: 0o640}))
+	fi, err = os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o640), fi.Mode().Perm())
+	// Without Backup the previous backup is left alone
+	backup, err = os.ReadFile(path + ".bak")
+	require.NoError(t, err)
+	require.Equal(t, `{"A": "old"}`, string(backup))
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	for _, e := range entries {
+		require.NotContains(t, e.Name(), ".tmp-", "temporary file left behind")
+	}
+}
+
+func TestReplaceFollowsSymlink(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "shared.envrc")
+	link := filepath.Join(dir, ".envrc")
+	require.NoError(t, os.WriteFile(target, []byte("old"), 0o600))
+	require.NoError(t, os.Symlink(target, link))
+
+	require.NoError(t, Replace(link, []byte("new"), WriteOptions{}))
+	fi, err := os.Lstat(link)
+	require.NoError(t, err)
+	require.Equal(t, os.ModeSymlink, fi.Mode().Type())
+	content, err := os.ReadFile(target)
+	require.NoError(t, err)
+	require.Equal(t, "new", string(content))
+}
+
+func TestParseFileMode(t *testing.T) {
+	mode, err := ParseFileMode("0640")
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o640), mode)
+	mode, err = ParseFileMode("")
+	require.NoError(t, err)
+	require.Zero(t, mode)
+	for _, s := range []string{"0999", "rw-r--r--", "01777"} {
+		_, err := ParseFileMode(s)
+		require.ErrorContains(t, err, "invalid file mode")
+	}
+}
+
+func TestLockFileExcludesOtherHolders(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("flock is not available")
+	}
+	path := filepath.Join(t.TempDir(), ".envrc.lock")
+	unlock, err := lockFile(path)
+	require.NoError(t, err)
+
+	// A second open file description conflicts like another process would
+	acquired := make(chan func())
+	go func() {
+		unlock2, err := lockFile(path)
+		if err != nil {
+			close(acquired)
+			return
+		}
+		acquired <- unlock2
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("lock acquired while held")
+	case <-time.After(100 * time.Millisecond):
+	}
+	unlock()
+	select {
+	case unlock2, ok := <-acquired:
+		require.True(t, ok, "second lock failed")
+		unlock2()
+	case <-time.After(5 * time.Second):
+		t.Fatal("lock not acquired after release")
+	}
+}
+
+func TestLockFilesStayOutOfTheOutputDirectory(t *testing.T) {
+	cache := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", cache)
+	t.Setenv("HOME", cache)
+	dir := t.TempDir()
+	target := filepath.Join(dir, "shared.envrc")
+	link := filepath.Join(dir, ".envrc")
+	require.NoError(t, os.WriteFile(target, []byte("old"), 0o600))
+	require.NoError(t, os.Symlink(target, link))
+	require.NoError(t, os.Symlink(dir, filepath.Join(dir, "alias")))
+
+	// Names that write the same file share one lock, whether or not the file exists yet
+	lockPath := func(path string) string {
+		t.Helper()
+		p, err := lockFilePath(path)
+		require.NoError(t, err)
+		return p
+	}
+	require.Equal(t, lockPath(target), lockPath(link))
+	require.Equal(t, lockPath(filepath.Join(dir, "new.envrc")), lockPath(filepath.Join(dir, "alias", "new.envrc")))
+	require.NotEqual(t, lockPath(target), lockPath(filepath.Join(dir, "new.envrc")))
+
+	require.NoError(t, Replace(link, []byte("new"), WriteOptions{}))
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	for _, e := range entries {
+		require.NotContains(t, e.Name(), ".lock", "lock file left in the output directory")
+	}
+	locks, err := os.ReadDir(filepath.Dir(lockPath(target)))
+	require.NoError(t, err)
+	require.Len(t, locks, 1)
+}
+
+func TestWritePrunesOwnedKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"manual": "kept"}`), 0o600))
+	write := func(owner, content string) map[string]interface{} {
+		t.Helper()
+		require.NoError(t, Write(path, []byte(content), WriteOptions{Format: "json", Owner: owner}))
+		b, err := os.ReadFile(path)
+		require.NoError(t, err)
+		var got map[string]interface{}
+		require.NoError(t, json.Unmarshal(b, &got))
+		return got
+	}
+
+	write("db", `{"DB_USER": "app", "DB_PASSWORD": "secret", "shared": "1"}`)
+	write("api", `{"API_TOKEN": "t", "shared": "2"}`)
+	// DB_PASSWORD is gone from Vault; shared is still written by api
+	got := write("db", `{"DB_USER": "app"}`)
+	require.Equal(t, map[string]interface{}{"manual": "kept", "DB_USER": "app", "API_TOKEN": "t", "shared": "2"}, got)
+
+	got = write("api", `{}`)
+	require.Equal(t, map[string]interface{}{"manual": "kept", "DB_USER": "app"}, got)
+
+	// Writes without an owner neither prune nor record keys
+	got = write("", `{"adhoc": "x"}`)
+	require.Equal(t, map[string]interface{}{"manual": "kept", "DB_USER": "app", "adhoc": "x"}, got)
+	state := readKeyState(path)
+	require.Equal(t, map[string][]envrc.KeyPath{"db": {{"DB_USER"}}}, state.Owners)
+}
@@ -2,7 +2,9 @@ package seed
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
@@ -34,9 +36,9 @@ const (
 	decAllNo
 )
 
-func Run(client *vault.Client, spec *Spec, opts Options) error {
+func Run(ctx context.Context, client vault.SecretStore, spec *Spec, opts Options) error {
 	// Build template context from token for rendering templated paths
-	tctx, err := vault.BuildTemplateContext(client)
+	tctx, err := vault.BuildTemplateContext(ctx, client)
 	if err != nil {
 		return fmt.Errorf("failed to build template context: %w", err)
 	}
@@ -68,18 +70,25 @@ func Run(client *vault.Client, spec *Spec, opts Options) error {
 	log.Info().Str("base_path", base).Int("sets_total", len(spec.Sets)).Msg("seed: start")
 
 	// Interactive state flags
-	overwriteAllAllow := false
-	overwriteAllSkip := false
+	overwrites := &overwriteState{}
 	commandAllRun := false
 	commandAllSkip := false
 
 	for i, set := range spec.Sets {
+		mode := set.Mode
+		if mode == "" {
+			mode = WriteModePatch
+		}
+		if mode != WriteModePatch && mode != WriteModeReplace {
+			return fmt.Errorf("set %d: unknown mode '%s' (expected %s or %s)", i+1, set.Mode, WriteModePatch, WriteModeReplace)
+		}
+
 		// Determine target path: join with base if relative; error if relative without base
 		target := set.Path
-		if !vault.IsAbsoluteVaultPath(target) && base == "" {
+		if !client.IsAbsolutePath(ctx, target) && base == "" {
 			return fmt.Errorf("set %d: relative path '%s' without base_path", i+1, target)
 		}
-		target = vault.JoinBaseAndPath(base, target)
+		target = client.JoinBaseAndPath(ctx, base, target)
 		renderedTarget, err := vault.RenderTemplateString(target, tctx)
 		if err != nil {
 			return fmt.Errorf("set %d: failed to render path '%s': %w", i+1, target, err)
@@ -253,7 +262,7 @@ func Run(client *vault.Client, spec *Spec, opts Options) error {
 						}
 					}
 				}
-				out, err := runShellCommand(cmdStr)
+				out, err := runShellCommand(ctx, cmdStr)
 				if err != nil {
 					return fmt.Errorf("set %d: setup command '%s' failed: %w", i+1, name, err)
 				}
@@ -310,7 +319,7 @@ func Run(client *vault.Client, spec *Spec, opts Options) error {
 						}
 					}
 				}
-				out, err := runShellCommand(cmdStr)
+				out, err := runShellCommand(ctx, cmdStr)
 				if err != nil {
 					return fmt.Errorf("set %d: command for key '%s' failed: %w", i+1, k, err)
 				}
@@ -343,79 +352,29 @@ func Run(client *vault.Client, spec *Spec, opts Options) error {
 			continue
 		}
 
-		// Compute and optionally print diff vs existing secrets
-		var existing map[string]interface{}
-		existing, _ = client.GetSecrets(renderedTarget)
-		if opts.DryRun || opts.ShowDiff {
-			printDiff(renderedTarget, existing, data)
-		}
-
-		// If dry-run, do not write
-		if opts.DryRun {
-			continue
-		}
-
-		// Ask for a confirmation per path after diff if requested
-		if opts.ConfirmApply {
-			prompt := fmt.Sprintf("Apply changes to '%s'? [y/N]: ", renderedTarget)
-			dec := askForDecision(prompt)
-			if dec != decYes && dec != decAllYes {
-				log.Debug().Str("path", renderedTarget).Msg("seed: user declined apply")
-				continue
-			}
-		}
-
-		// Handle overwrite confirmations when existing values are present
-		if !opts.ForceOverwrite {
-			existing, err := client.GetSecrets(renderedTarget)
-			if err != nil {
-				// if not found, skip prompting; otherwise propagate error
-				if !isNotFoundError(err) {
-					return fmt.Errorf("failed to check existing secrets at %s: %w", renderedTarget, err)
-				}
-			} else if len(existing) > 0 {
-				// Remove unchanged keys to avoid redundant writes
-				for k, v := range data {
-					if old, ok := existing[k]; ok && convertToString(old) == convertToString(v) {
-						delete(data, k)
-					}
-				}
-				for key := range data {
-					if _, ok := existing[key]; ok {
-						if overwriteAllSkip {
-							delete(data, key)
-							continue
-						}
-						if !overwriteAllAllow {
-							prompt := fmt.Sprintf("Key '%s' exists at '%s'. Overwrite? [y/N/a/s]: ", key, renderedTarget)
-							dec := askForDecision(prompt)
-							switch dec {
-							case decYes:
-								// keep value in data
-							case decAllYes:
-								overwriteAllAllow = true
-							case decAllNo:
-								overwriteAllSkip = true
-								fallthrough
-							case decNo:
-								delete(data, key)
-								continue
-							}
-						}
-					}
+		// Write with check-and-set against the version the diff was computed from; when someone else
+		// wrote in between, offer to re-diff against the new version and try again
+		written := false
+		showDiff := opts.DryRun || opts.ShowDiff
+		for {
+			written, err = applySet(ctx, client, renderedTarget, data, mode, opts, overwrites, showDiff)
+			if errors.Is(err, vault.ErrVersionConflict) && !opts.DryRun {
+				fmt.Fprintf(os.Stderr, "Conflict: '%s' was modified by someone else after the diff was computed.\n", renderedTarget)
+				dec := askForDecision(fmt.Sprintf("Re-diff '%s' against the new version and retry? [y/N]: ", renderedTarget))
+				if dec == decYes || dec == decAllYes {
+					// The user asked to see the new diff
+					showDiff = true
+					continue
 				}
 			}
+			break
 		}
-
-		if len(data) == 0 {
-			log.Debug().Str("path", renderedTarget).Msg("seed: skipping write (no data after confirmations)")
-			continue
+		if err != nil {
+			return fmt.Errorf("set %d: %w", i+1, err)
 		}
-
-		if err := client.PutSecrets(renderedTarget, data); err != nil {
-			return fmt.Errorf("failed to write %s: %w", renderedTarget, err)
+		if !written {
+			continue
 		}
-		log.Info().Str("path", renderedTarget).Int("keys", len(data)).Msg("seed: wrote secrets")
 
 		// Run cleanup_commands after writing (no persistence)
 		if len(set.CleanupCommands) > 0 {
@@ -451,7 +410,7 @@ func Run(client *vault.Client, spec *Spec, opts Options) error {
 						}
 					}
 				}
-				if _, err := runShellCommand(cmdStr); err != nil {
+				if _, err := runShellCommand(ctx, cmdStr); err != nil {
 					return fmt.Errorf("set %d: cleanup command failed: %w", i+1, err)
 				}
 			}
@@ -461,6 +420,128 @@ func Run(client *vault.Client, spec *Spec, opts Options) error {
 	return nil
 }
 
+// overwriteState remembers "all"/"skip all" answers to overwrite prompts across sets
+type overwriteState struct {
+	allowAll bool
+	skipAll  bool
+}
+
+// applySet diffs the set's data against the current secret and writes it using check-and-set
+// on the version that was read. It returns false when nothing was written.
+func applySet(ctx context.Context, client vault.SecretStore, target string, setData map[string]interface{}, mode WriteMode, opts Options, overwrites *overwriteState, showDiff bool) (bool, error) {
+	// Work on a copy so a retry after a version conflict starts from the full set data
+	data := make(map[string]interface{}, len(setData))
+	for k, v := range setData {
+		data[k] = v
+	}
+
+	// Compute and optionally print diff vs existing secrets, remembering the version it was computed from
+	useCAS := true
+	existing, version, err := client.GetSecretsWithVersion(ctx, target)
+	if err != nil {
+		switch {
+		case errors.Is(err, vault.ErrNotFound):
+		case opts.ForceOverwrite || opts.DryRun:
+			// forced writes may use write-only tokens; without a readable version there is nothing to check against
+			log.Warn().Err(err).Str("path", target).Msg("seed: cannot read existing secrets, diffing against empty state without check-and-set")
+			useCAS = false
+		default:
+			return false, fmt.Errorf("failed to read existing secrets at %s: %w", target, err)
+		}
+		existing = nil
+	}
+	if showDiff {
+		printDiff(target, existing, data, mode, version)
+	}
+
+	// If dry-run, do not write
+	if opts.DryRun {
+		return false, nil
+	}
+
+	// Ask for a confirmation per path after diff if requested
+	if opts.ConfirmApply {
+		prompt := fmt.Sprintf("Apply changes to '%s'? [y/N]: ", target)
+		dec := askForDecision(prompt)
+		if dec != decYes && dec != decAllYes {
+			log.Debug().Str("path", target).Msg("seed: user declined apply")
+			return false, nil
+		}
+	}
+
+	// Keep the full desired state for replace mode before pruning unchanged/declined keys
+	desired := make(map[string]interface{}, len(data))
+	for k, v := range data {
+		desired[k] = v
+	}
+
+	// Handle overwrite confirmations when existing values are present
+	if !opts.ForceOverwrite && len(existing) > 0 {
+		// Remove unchanged keys to avoid redundant writes
+		for k, v := range data {
+			if old, ok := existing[k]; ok && convertToString(old) == convertToString(v) {
+				delete(data, k)
+			}
+		}
+		for key := range data {
+			if _, ok := existing[key]; ok {
+				if overwrites.skipAll {
+					delete(data, key)
+					desired[key] = existing[key]
+					continue
+				}
+				if !overwrites.allowAll {
+					prompt := fmt.Sprintf("Key '%s' exists at '%s'. Overwrite? [y/N/a/s]: ", key, target)
+					dec := askForDecision(prompt)
+					switch dec {
+					case decYes:
+						// keep value in data
+					case decAllYes:
+						overwrites.allowAll = true
+					case decAllNo:
+						overwrites.skipAll = true
+						fallthrough
+					case decNo:
+						delete(data, key)
+						desired[key] = existing[key]
+						continue
+					}
+				}
+			}
+		}
+	}
+
+	switch mode {
+	case WriteModeReplace:
+		if !hasChanges(existing, desired) {
+			log.Debug().Str("path", target).Msg("seed: skipping write (no changes after confirmations)")
+			return false, nil
+		}
+		write := func() error { return client.PutSecretsCAS(ctx, target, desired, version) }
+		if !useCAS {
+			write = func() error { return client.PutSecrets(ctx, target, desired) }
+		}
+		if err := write(); err != nil {
+			return false, fmt.Errorf("failed to write %s: %w", target, err)
+		}
+		log.Info().Str("path", target).Int("keys", len(desired)).Str("mode", string(mode)).Int("cas", version).Msg("seed: wrote secrets")
+	default:
+		if len(data) == 0 {
+			log.Debug().Str("path", target).Msg("seed: skipping write (no data after confirmations)")
+			return false, nil
+		}
+		write := func() error { return client.PatchSecretsCAS(ctx, target, data, version) }
+		if !useCAS {
+			write = func() error { return client.PatchSecrets(ctx, target, data) }
+		}
+		if err := write(); err != nil {
+			return false, fmt.Errorf("failed to write %s: %w", target, err)
+		}
+		log.Info().Str("path", target).Int("keys", len(data)).Str("mode", string(mode)).Int("cas", version).Msg("seed: wrote secrets")
+	}
+	return true, nil
+}
+
 func storeSetupCommandOutput(key string) bool {
 	key = strings.TrimSpace(key)
 	if key == "" {
@@ -492,14 +573,6 @@ func askForDecision(prompt string) userDecision {
 	}
 }
 
-func isNotFoundError(err error) bool {
-	if err == nil {
-		return false
-	}
-	s := err.Error()
-	return strings.Contains(s, "no secret found at path") || strings.Contains(s, "no secret found at KV v2 path")
-}
-
 func isMissingDataKeyError(err error) bool {
 	if err == nil {
 		return false
@@ -508,8 +581,8 @@ func isMissingDataKeyError(err error) bool {
 	return strings.Contains(s, "map has no entry for key") || strings.Contains(s, "can't evaluate field")
 }
 
-func runShellCommand(command string) (string, error) {
-	cmd := exec.Command("/bin/sh", "-c", command)
+func runShellCommand(ctx context.Context, command string) (string, error) {
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", command)
 	out, err := cmd.Output()
 	if err != nil {
 		return "", err
@@ -660,14 +733,31 @@ func convertToString(value interface{}) string {
 	}
 }
 
-// printDiff renders a simple key-level diff between existing and desired data
-func printDiff(path string, existing map[string]interface{}, desired map[string]interface{}) {
+// hasChanges reports whether writing desired would change existing (added, updated or removed keys)
+func hasChanges(existing map[string]interface{}, desired map[string]interface{}) bool {
+	if len(existing) != len(desired) {
+		return true
+	}
+	for k, v := range desired {
+		old, ok := existing[k]
+		if !ok || convertToString(old) != convertToString(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// printDiff renders a simple key-level diff between existing and desired data.
+// Deletions are only shown in replace mode; patch writes keep keys that are not in the set.
+func printDiff(path string, existing map[string]interface{}, desired map[string]interface{}, mode WriteMode, version int) {
 	type change struct{ key, op, old, new string }
 	changes := []change{}
 	// Deletions (existing but not desired)
-	for k, v := range existing {
-		if _, ok := desired[k]; !ok {
-			changes = append(changes, change{key: k, op: "-", old: convertToString(v), new: ""})
+	if mode == WriteModeReplace {
+		for k, v := range existing {
+			if _, ok := desired[k]; !ok {
+				changes = append(changes, change{key: k, op: "-", old: convertToString(v), new: ""})
+			}
 		}
 	}
 	// Additions and updates
@@ -683,10 +773,10 @@ func printDiff(path string, existing map[string]interface{}, desired map[string]
 		}
 	}
 	if len(changes) == 0 {
-		log.Info().Str("path", path).Msg("seed: no changes (up to date)")
+		log.Info().Str("path", path).Int("version", version).Msg("seed: no changes (up to date)")
 		return
 	}
-	log.Info().Str("path", path).Int("changes", len(changes)).Msg("seed: diff")
+	log.Info().Str("path", path).Int("version", version).Int("changes", len(changes)).Msg("seed: diff")
 	// Stable ordering
 	sort.Slice(changes, func(i, j int) bool { return changes[i].key < changes[j].key })
 	for _, c := range changes {
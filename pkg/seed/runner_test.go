@@ -0,0 +1,170 @@
+package seed
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-go-golems/vault-envrc-generator/pkg/vault"
+	"github.com/go-go-golems/vault-envrc-generator/pkg/vaulttest"
+)
+
+func TestRunPatchAndReplace(t *testing.T) {
+	srv := vaulttest.NewServer(t)
+	srv.Put("secret/dev/db", map[string]interface{}{"host": "old", "keep": "me"})
+	srv.Put("secret/dev/api", map[string]interface{}{"stale": "x"})
+	client := srv.Client()
+
+	t.Setenv("SEED_TEST_DB_PASSWORD", "hunter2")
+	keyFile := filepath.Join(t.TempDir(), "key.pem")
+	require.NoError(t, os.WriteFile(keyFile, []byte("PEM"), 0o600))
+
+	spec := &Spec{
+		BasePath: "secret/dev",
+		Sets: []Set{
+			{
+				Path:  "db",
+				Data:  map[string]string{"host": "db.internal"},
+				Env:   map[string]string{"password": "SEED_TEST_DB_PASSWORD"},
+				Files: map[string]string{"tls_key": keyFile},
+			},
+			{Path: "api", Mode: WriteModeReplace, Data: map[string]string{"token": "t0k3n"}},
+			{Path: "secret/shared/new", Data: map[string]string{"a": "b"}},
+		},
+	}
+	require.NoError(t, Run(context.Background(), client, spec, Options{ForceOverwrite: true}))
+
+	db, ok := srv.Get("secret/dev/db")
+	require.True(t, ok)
+	require.Equal(t, map[string]interface{}{"host": "db.internal", "keep": "me", "password": "hunter2", "tls_key": "PEM"}, db)
+
+	api, ok := srv.Get("secret/dev/api")
+	require.True(t, ok)
+	require.Equal(t, map[string]interface{}{"token": "t0k3n"}, api)
+
+	shared, ok := srv.Get("secret/shared/new")
+	require.True(t, ok)
+	require.Equal(t, map[string]interface{}{"a": "b"}, shared)
+	require.Equal(t, 1, srv.Version("secret/shared/new"))
+}
+
+func TestRunWritesWithCheckAndSet(t *testing.T) {
+	srv := vaulttest.NewServer(t)
+	srv.Put("secret/dev/db", map[string]interface{}{"host": "v1"})
+	srv.Put("secret/dev/db", map[string]interface{}{"host": "v2"})
+	client := srv.Client()
+	srv.ResetRequests()
+
+	spec := &Spec{BasePath: "secret/dev", Sets: []Set{
+		{Path: "db", Data: map[string]string{"host": "v3"}},
+		{Path: "fresh", Data: map[string]string{"k": "v"}},
+	}}
+	require.NoError(t, Run(context.Background(), client, spec, Options{ForceOverwrite: true}))
+
+	cas := map[string]interface{}{}
+	for _, r := range srv.Requests() {
+		if r.Path != "secret/data/dev/db" && r.Path != "secret/data/dev/fresh" {
+			continue
+		}
+		if r.Method == "PATCH" || r.Method == "PUT" {
+			opts, _ := r.Body["options"].(map[string]interface{})
+			cas[r.Path] = opts["cas"]
+		}
+	}
+	require.Len(t, cas, 2)
+	require.Equal(t, json.Number("2"), cas["secret/data/dev/db"])
+	require.Equal(t, json.Number("0"), cas["secret/data/dev/fresh"])
+	require.Equal(t, 3, srv.Version("secret/dev/db"))
+}
+
+func TestRunDryRunDoesNotWrite(t *testing.T) {
+	srv := vaulttest.NewServer(t)
+	client := srv.Client()
+
+	spec := &Spec{BasePath: "secret/dev", Sets: []Set{{Path: "db", Data: map[string]string{"host": "x"}}}}
+	require.NoError(t, Run(context.Background(), client, spec, Options{DryRun: true}))
+
+	_, ok := srv.Get("secret/dev/db")
+	require.False(t, ok)
+	for _, r := range srv.Requests() {
+		require.NotContains(t, []string{"PUT", "POST", "PATCH", "DELETE"}, r.Method, "unexpected write %s %s", r.Method, r.Path)
+	}
+}
+
+func TestRunRejectsRelativePathWithoutBase(t *testing.T) {
+	srv := vaulttest.NewServer(t)
+	client := srv.Client()
+
+	spec := &Spec{Sets: []Set{{Path: "db", Data: map[string]string{"host": "x"}}}}
+	err := Run(context.Background(), client, spec, Options{ForceOverwrite: true})
+	require.ErrorContains(t, err, "without base_path")
+}
+
+// racingStore simulates another writer: after the first versioned read of a path it writes a
+// new version, so the following check-and-set write conflicts
+type racingStore struct {
+	vault.SecretStore
+	srv   *vaulttest.Server
+	raced bool
+}
+
+func (s *racingStore) GetSecretsWithVersion(ctx context.Context, path string) (map[string]interface{}, int, error) {
+	data, version, err := s.SecretStore.GetSecretsWithVersion(ctx, path)
+	if !s.raced {
+		s.raced = true
+		s.srv.Put(path, map[string]interface{}{"host": "theirs"})
+	}
+	return data, version, err
+}
+
+// withStdio feeds input to the prompts and returns what was printed
+func withStdio(t *testing.T, input string, fn func()) string {
+	t.Helper()
+	inR, inW, err := os.Pipe()
+	require.NoError(t, err)
+	_, err = inW.WriteString(input)
+	require.NoError(t, err)
+	require.NoError(t, inW.Close())
+	outR, outW, err := os.Pipe()
+	require.NoError(t, err)
+
+	stdin, stdout := os.Stdin, os.Stdout
+	os.Stdin, os.Stdout = inR, outW
+	defer func() { os.Stdin, os.Stdout = stdin, stdout }()
+	fn()
+	require.NoError(t, outW.Close())
+	out, err := io.ReadAll(outR)
+	require.NoError(t, err)
+	return string(out)
+}
+
+func TestRunVersionConflict(t *testing.T) {
+	srv := vaulttest.NewServer(t)
+	srv.Put("secret/dev/db", map[string]interface{}{"host": "v1"})
+	spec := &Spec{BasePath: "secret/dev", Sets: []Set{{Path: "db", Data: map[string]string{"host": "ours"}}}}
+
+	// Declining the retry reports the conflict
+	var err error
+	withStdio(t, "n\n", func() {
+		err = Run(context.Background(), &racingStore{SecretStore: srv.Client(), srv: srv}, spec, Options{ForceOverwrite: true})
+	})
+	require.True(t, errors.Is(err, vault.ErrVersionConflict), "got %v", err)
+	data, _ := srv.Get("secret/dev/db")
+	require.Equal(t, "theirs", data["host"])
+
+	// Accepting re-diffs against the new version, shows the diff and writes
+	out := withStdio(t, "y\n", func() {
+		err = Run(context.Background(), &racingStore{SecretStore: srv.Client(), srv: srv}, spec, Options{ForceOverwrite: true})
+	})
+	require.NoError(t, err)
+	require.Contains(t, out, `~ host: "theirs" -> "ours"`)
+	data, _ = srv.Get("secret/dev/db")
+	require.Equal(t, "ours", data["host"])
+	require.Equal(t, 4, srv.Version("secret/dev/db"))
+}
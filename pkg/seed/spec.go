@@ -5,9 +5,20 @@ type Spec struct {
 	Sets     []Set  `yaml:"sets"`
 }
 
+// WriteMode controls how a set's data is written to its Vault path
+type WriteMode string
+
+const (
+	// WriteModePatch merges the set's keys into the existing secret, keeping all other keys (default)
+	WriteModePatch WriteMode = "patch"
+	// WriteModeReplace makes the secret contain exactly the set's keys, removing any others
+	WriteModeReplace WriteMode = "replace"
+)
+
 type Set struct {
 	Name            string                       `yaml:"name,omitempty"`
 	Path            string                       `yaml:"path"`
+	Mode            WriteMode                    `yaml:"mode,omitempty"`
 	Data            map[string]string            `yaml:"data"`
 	Env             map[string]string            `yaml:"env"`
 	Files           map[string]string            `yaml:"files"`
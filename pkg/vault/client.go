@@ -1,7 +1,11 @@
 package vault
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/hashicorp/vault/api"
@@ -10,12 +14,20 @@ import (
 // Client wraps the Vault API client with additional functionality
 type Client struct {
 	client *api.Client
+	mounts mountTable
 }
 
-// NewClient creates a new Vault client with the given address and token
-func NewClient(address, token string) (*Client, error) {
-	config := api.DefaultConfig()
-	config.Address = address
+// NewClient creates a new Vault client from cfg and token. Unset fields of cfg are taken from the
+// standard VAULT_* environment variables before connecting.
+func NewClient(ctx context.Context, cfg Config, token string) (*Client, error) {
+	cfg, err := cfg.WithEnvironment()
+	if err != nil {
+		return nil, err
+	}
+	config, err := cfg.apiConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure Vault client: %w", err)
+	}
 
 	client, err := api.NewClient(config)
 	if err != nil {
@@ -23,181 +35,296 @@ func NewClient(address, token string) (*Client, error) {
 	}
 
 	client.SetToken(token)
+	if cfg.Namespace != "" {
+		client.SetNamespace(cfg.Namespace)
+	}
 
 	// Test the connection
-	_, err = client.Sys().Health()
+	_, err = client.Sys().HealthWithContext(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to Vault at %s: %w", address, err)
+		return nil, fmt.Errorf("failed to connect to Vault at %s: %w", cfg.Address, classify(err))
 	}
 
 	return &Client{client: client}, nil
 }
 
-// GetSecrets retrieves secrets from the given path, handling both KV v1 and v2
-func (c *Client) GetSecrets(path string) (map[string]interface{}, error) {
-	mountPath, secretPath := c.parsePath(path)
+// GetSecrets retrieves secrets from the given path, routing to the KV v1 or v2 API based on the mount.
+// The path is used literally; see GetSecretsRef for "path@version" references.
+func (c *Client) GetSecrets(ctx context.Context, path string) (map[string]interface{}, error) {
+	data, _, err := c.getSecrets(ctx, path, 0)
+	return data, err
+}
+
+// GetSecretsVersion retrieves a specific KV v2 version of the secret at path (0 = latest).
+func (c *Client) GetSecretsVersion(ctx context.Context, path string, version int) (map[string]interface{}, error) {
+	data, _, err := c.getSecrets(ctx, path, version)
+	return data, err
+}
 
-	// Try KV v2 first (common default), then fall back to KV v1 if needed
-	if data, err := c.getKVv2Secrets(mountPath, secretPath); err == nil {
-		return data, nil
+// GetSecretsWithVersion retrieves the latest secrets along with the KV v2 version that was read.
+// The version is 0 for KV v1 mounts, which are not versioned.
+func (c *Client) GetSecretsWithVersion(ctx context.Context, path string) (map[string]interface{}, int, error) {
+	return c.getSecrets(ctx, path, 0)
+}
+
+func (c *Client) getSecrets(ctx context.Context, path string, version int) (map[string]interface{}, int, error) {
+	mount, secretPath, err := c.ResolveMount(ctx, path)
+	if err != nil {
+		return nil, 0, err
+	}
+	if mount.IsKVv2() {
+		return c.getKVv2Secrets(ctx, mount.Path, secretPath, version)
 	}
+	if version > 0 {
+		return nil, 0, fmt.Errorf("cannot read version %d of %s: mount %s is not a KV v2 engine", version, path, mount.Path)
+	}
+	data, err := c.getKVv1Secrets(ctx, path)
+	return data, 0, err
+}
 
-	// Fallback: KV v1 direct read
-	if data, err := c.getKVv1Secrets(path); err == nil {
-		return data, nil
-	} else {
-		return nil, err
+// PutSecrets writes secrets to the given path, routing to the KV v1 or v2 API based on the mount
+func (c *Client) PutSecrets(ctx context.Context, path string, data map[string]interface{}) error {
+	mount, secretPath, err := c.ResolveMount(ctx, path)
+	if err != nil {
+		return err
+	}
+	if mount.IsKVv2() {
+		return c.putKVv2Secrets(ctx, mount.Path, secretPath, data, noCAS)
 	}
+	return c.putKVv1Secrets(ctx, path, data)
 }
 
-// PutSecrets writes secrets to the given path, handling KV v2 and v1
-func (c *Client) PutSecrets(path string, data map[string]interface{}) error {
-	mountPath, secretPath := c.parsePath(path)
-	// Try KV v2 first
-	if err := c.putKVv2Secrets(mountPath, secretPath, data); err == nil {
-		return nil
+// PutSecretsCAS writes secrets only if the current KV v2 version still equals version
+// (0 means the secret must not exist yet). A mismatch returns an error wrapping ErrVersionConflict.
+// KV v1 has no check-and-set support, so the write is unconditional there.
+func (c *Client) PutSecretsCAS(ctx context.Context, path string, data map[string]interface{}, version int) error {
+	mount, secretPath, err := c.ResolveMount(ctx, path)
+	if err != nil {
+		return err
+	}
+	if mount.IsKVv2() {
+		return c.putKVv2Secrets(ctx, mount.Path, secretPath, data, version)
 	}
-	// Fallback KV v1
-	if err := c.putKVv1Secrets(path, data); err == nil {
-		return nil
-	} else {
+	return c.putKVv1Secrets(ctx, path, data)
+}
+
+// PatchSecrets merges data into the secret at path, leaving keys that are not in data untouched.
+// KV v2 uses a JSON merge-patch request (creating the secret if it does not exist yet); KV v1 has no
+// native patch, so the current data is read, merged and written back.
+func (c *Client) PatchSecrets(ctx context.Context, path string, data map[string]interface{}) error {
+	mount, secretPath, err := c.ResolveMount(ctx, path)
+	if err != nil {
 		return err
 	}
+	if mount.IsKVv2() {
+		return c.patchKVv2Secrets(ctx, mount.Path, secretPath, data, noCAS)
+	}
+	return c.patchKVv1Secrets(ctx, path, data)
 }
 
-// DeleteSecret deletes a secret at the given path, handling KV v2 and v1
-func (c *Client) DeleteSecret(path string) error {
-	mountPath, secretPath := c.parsePath(path)
-	// Try KV v2 delete (metadata delete latest version)
-	if err := c.deleteKVv2Secret(mountPath, secretPath); err == nil {
-		return nil
+// PatchSecretsCAS merges data into the secret only if the current KV v2 version still equals version
+// (0 means the secret must not exist yet). A mismatch returns an error wrapping ErrVersionConflict.
+func (c *Client) PatchSecretsCAS(ctx context.Context, path string, data map[string]interface{}, version int) error {
+	mount, secretPath, err := c.ResolveMount(ctx, path)
+	if err != nil {
+		return err
 	}
-	// Fallback KV v1 delete
-	if err := c.deleteKVv1Secret(path); err == nil {
-		return nil
-	} else {
+	if mount.IsKVv2() {
+		return c.patchKVv2Secrets(ctx, mount.Path, secretPath, data, version)
+	}
+	return c.patchKVv1Secrets(ctx, path, data)
+}
+
+// DeleteSecret deletes a secret at the given path; on KV v2 this soft-deletes the latest version
+func (c *Client) DeleteSecret(ctx context.Context, path string) error {
+	mount, secretPath, err := c.ResolveMount(ctx, path)
+	if err != nil {
 		return err
 	}
+	if mount.IsKVv2() {
+		return c.deleteKVv2Secret(ctx, mount.Path, secretPath)
+	}
+	return c.deleteKVv1Secret(ctx, path)
 }
 
-func (c *Client) deleteKVv1Secret(path string) error {
-	_, err := c.client.Logical().Delete(path)
+func (c *Client) deleteKVv1Secret(ctx context.Context, path string) error {
+	_, err := c.client.Logical().DeleteWithContext(ctx, path)
 	if err != nil {
-		return fmt.Errorf("failed to delete secret at path %s: %w", path, err)
+		return fmt.Errorf("failed to delete secret at path %s: %w", path, classify(err))
 	}
 	return nil
 }
 
-func (c *Client) deleteKVv2Secret(mountPath, secretPath string) error {
-	// KV v2 delete latest version uses delete path
-	fullPath := fmt.Sprintf("%s/delete/%s", mountPath, secretPath)
-	_, err := c.client.Logical().Write(fullPath, map[string]interface{}{})
+func (c *Client) deleteKVv2Secret(ctx context.Context, mountPath, secretPath string) error {
+	// DELETE on the data/ path soft-deletes the latest version
+	fullPath := kvv2Path(mountPath, "data", secretPath)
+	_, err := c.client.Logical().DeleteWithContext(ctx, fullPath)
 	if err != nil {
-		return fmt.Errorf("failed to delete KV v2 secret at %s: %w", fullPath, err)
+		return fmt.Errorf("failed to delete KV v2 secret at %s: %w", fullPath, classify(err))
 	}
 	return nil
 }
 
 // getKVv1Secrets retrieves secrets from KV v1 engine
-func (c *Client) getKVv1Secrets(path string) (map[string]interface{}, error) {
-	secret, err := c.client.Logical().Read(path)
+func (c *Client) getKVv1Secrets(ctx context.Context, path string) (map[string]interface{}, error) {
+	secret, err := c.client.Logical().ReadWithContext(ctx, path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read secret from path %s: %w", path, err)
+		return nil, fmt.Errorf("failed to read secret from path %s: %w", path, classify(err))
 	}
 
 	if secret == nil {
-		return nil, fmt.Errorf("no secret found at path %s", path)
+		return nil, fmt.Errorf("no secret found at path %s: %w", path, ErrNotFound)
 	}
 
 	return secret.Data, nil
 }
 
-// getKVv2Secrets retrieves secrets from KV v2 engine
-func (c *Client) getKVv2Secrets(mountPath, secretPath string) (map[string]interface{}, error) {
+// getKVv2Secrets retrieves secrets and their version from KV v2 engine; version 0 reads the latest
+func (c *Client) getKVv2Secrets(ctx context.Context, mountPath, secretPath string, version int) (map[string]interface{}, int, error) {
 	// KV v2 requires reading from data/ prefix
-	fullPath := fmt.Sprintf("%s/data/%s", mountPath, secretPath)
+	fullPath := kvv2Path(mountPath, "data", secretPath)
 
-	secret, err := c.client.Logical().Read(fullPath)
+	var query map[string][]string
+	if version > 0 {
+		query = map[string][]string{"version": {strconv.Itoa(version)}}
+	}
+	secret, err := c.client.Logical().ReadWithDataWithContext(ctx, fullPath, query)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read secret from KV v2 path %s: %w", fullPath, err)
+		return nil, 0, fmt.Errorf("failed to read secret from KV v2 path %s: %w", fullPath, classify(err))
 	}
 
 	if secret == nil {
-		return nil, fmt.Errorf("no secret found at KV v2 path %s", fullPath)
+		return nil, 0, fmt.Errorf("no secret found at KV v2 path %s: %w", fullPath, ErrNotFound)
 	}
 
-	// KV v2 wraps the actual data in a "data" field
+	readVersion := intFromAny(fromMap(secret.Data["metadata"], "version"))
+
+	// KV v2 wraps the actual data in a "data" field; it is null for deleted or destroyed versions
 	if data, ok := secret.Data["data"].(map[string]interface{}); ok {
-		return data, nil
+		return data, readVersion, nil
+	}
+	if raw, ok := secret.Data["data"]; ok && raw == nil {
+		return nil, readVersion, fmt.Errorf("no secret found at KV v2 path %s (version %d deleted or destroyed): %w", fullPath, readVersion, ErrNotFound)
 	}
 
-	return nil, fmt.Errorf("invalid KV v2 secret format at path %s", fullPath)
+	return nil, 0, fmt.Errorf("invalid KV v2 secret format at path %s", fullPath)
 }
 
 // putKVv1Secrets writes secrets to KV v1 engine
-func (c *Client) putKVv1Secrets(path string, data map[string]interface{}) error {
-	_, err := c.client.Logical().Write(path, data)
+func (c *Client) putKVv1Secrets(ctx context.Context, path string, data map[string]interface{}) error {
+	_, err := c.client.Logical().WriteWithContext(ctx, path, data)
 	if err != nil {
-		return fmt.Errorf("failed to write secret to path %s: %w", path, err)
+		return fmt.Errorf("failed to write secret to path %s: %w", path, classify(err))
 	}
 	return nil
 }
 
-// putKVv2Secrets writes secrets to KV v2 engine
-func (c *Client) putKVv2Secrets(mountPath, secretPath string, data map[string]interface{}) error {
-	fullPath := fmt.Sprintf("%s/data/%s", mountPath, secretPath)
-	payload := map[string]interface{}{"data": data}
-	_, err := c.client.Logical().Write(fullPath, payload)
+// noCAS disables check-and-set on KV v2 writes
+const noCAS = -1
+
+// putKVv2Secrets writes secrets to KV v2 engine, with check-and-set when cas is not noCAS
+func (c *Client) putKVv2Secrets(ctx context.Context, mountPath, secretPath string, data map[string]interface{}, cas int) error {
+	fullPath := kvv2Path(mountPath, "data", secretPath)
+	payload := kvv2Payload(data, cas)
+	_, err := c.client.Logical().WriteWithContext(ctx, fullPath, payload)
 	if err != nil {
-		return fmt.Errorf("failed to write KV v2 secret to %s: %w", fullPath, err)
+		if isCASMismatch(err) {
+			return fmt.Errorf("%w: %s was modified since version %d", ErrVersionConflict, fullPath, cas)
+		}
+		return fmt.Errorf("failed to write KV v2 secret to %s: %w", fullPath, classify(err))
 	}
 	return nil
 }
 
-// parsePath splits a path into mount path and secret path
-func (c *Client) parsePath(path string) (string, string) {
-	parts := strings.SplitN(path, "/", 2)
-	if len(parts) == 1 {
-		return parts[0], ""
-	}
-	return parts[0], parts[1]
-}
-
-// ListSecrets lists all secrets at the given path (for interactive mode)
-func (c *Client) ListSecrets(path string) ([]string, error) {
-	// First try direct list (works for KV v1 and some KV v2 setups)
-	secret, err := c.client.Logical().List(path)
-	if err == nil && secret != nil && secret.Data != nil {
-		if keys, ok := secret.Data["keys"].([]interface{}); ok {
-			var result []string
-			for _, key := range keys {
-				if keyStr, ok := key.(string); ok {
-					result = append(result, keyStr)
-				}
-			}
-			return result, nil
+// patchKVv2Secrets merges data into a KV v2 secret using the PATCH method
+func (c *Client) patchKVv2Secrets(ctx context.Context, mountPath, secretPath string, data map[string]interface{}, cas int) error {
+	fullPath := kvv2Path(mountPath, "data", secretPath)
+	payload := kvv2Payload(data, cas)
+	_, err := c.client.Logical().JSONMergePatch(ctx, fullPath, payload)
+	if err != nil {
+		// PATCH requires an existing secret; create it with a regular write instead
+		var respErr *api.ResponseError
+		if errors.As(err, &respErr) && respErr.StatusCode == http.StatusNotFound {
+			return c.putKVv2Secrets(ctx, mountPath, secretPath, data, cas)
+		}
+		if isCASMismatch(err) {
+			return fmt.Errorf("%w: %s was modified since version %d", ErrVersionConflict, fullPath, cas)
 		}
+		return fmt.Errorf("failed to patch KV v2 secret at %s: %w", fullPath, classify(err))
 	}
+	return nil
+}
 
-	// If that failed or returned nothing, try KV v2 metadata listing
-	mountPath, secretPath := c.parsePath(path)
-	var metaPath string
-	if secretPath == "" {
-		metaPath = fmt.Sprintf("%s/metadata", mountPath)
-	} else {
-		metaPath = fmt.Sprintf("%s/metadata/%s", mountPath, strings.TrimSuffix(secretPath, "/"))
+func kvv2Payload(data map[string]interface{}, cas int) map[string]interface{} {
+	payload := map[string]interface{}{"data": data}
+	if cas != noCAS {
+		payload["options"] = map[string]interface{}{"cas": cas}
+	}
+	return payload
+}
+
+// isCASMismatch detects Vault's check-and-set rejection
+func isCASMismatch(err error) bool {
+	var respErr *api.ResponseError
+	if !errors.As(err, &respErr) || respErr.StatusCode != http.StatusBadRequest {
+		return false
+	}
+	for _, e := range respErr.Errors {
+		if strings.Contains(e, "check-and-set") {
+			return true
+		}
 	}
+	return false
+}
 
-	metaList, err2 := c.client.Logical().List(metaPath)
-	if err2 != nil || metaList == nil || metaList.Data == nil {
-		// Return original error if we had one; otherwise, a generic not found
-		if err != nil {
-			return nil, fmt.Errorf("failed to list secrets at path %s: %w", path, err)
+// patchKVv1Secrets merges data into a KV v1 secret via read-merge-write
+func (c *Client) patchKVv1Secrets(ctx context.Context, path string, data map[string]interface{}) error {
+	secret, err := c.client.Logical().ReadWithContext(ctx, path)
+	if err != nil {
+		return fmt.Errorf("failed to read secret from path %s: %w", path, classify(err))
+	}
+	merged := map[string]interface{}{}
+	if secret != nil {
+		for k, v := range secret.Data {
+			merged[k] = v
 		}
+	}
+	for k, v := range data {
+		merged[k] = v
+	}
+	return c.putKVv1Secrets(ctx, path, merged)
+}
+
+// kvv2Path builds a KV v2 API path such as "<mount>/data/<secret>" or "<mount>/metadata/<secret>"
+func kvv2Path(mountPath, kind, secretPath string) string {
+	mountPath = strings.TrimSuffix(mountPath, "/")
+	secretPath = strings.Trim(secretPath, "/")
+	if secretPath == "" {
+		return fmt.Sprintf("%s/%s", mountPath, kind)
+	}
+	return fmt.Sprintf("%s/%s/%s", mountPath, kind, secretPath)
+}
+
+// ListSecrets lists the keys directly below the given path; on KV v2 mounts the metadata API is used
+func (c *Client) ListSecrets(ctx context.Context, path string) ([]string, error) {
+	mount, secretPath, err := c.ResolveMount(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	listPath := path
+	if mount.IsKVv2() {
+		listPath = kvv2Path(mount.Path, "metadata", secretPath)
+	}
+
+	secret, err := c.client.Logical().ListWithContext(ctx, listPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list secrets at path %s: %w", path, classify(err))
+	}
+	if secret == nil || secret.Data == nil {
 		return []string{}, nil
 	}
 
-	keys, ok := metaList.Data["keys"].([]interface{})
+	keys, ok := secret.Data["keys"].([]interface{})
 	if !ok {
 		return []string{}, nil
 	}
@@ -218,11 +345,11 @@ func (c *Client) GetClient() *api.Client {
 }
 
 // TestConnection tests the Vault connection and authentication
-func (c *Client) TestConnection() error {
+func (c *Client) TestConnection(ctx context.Context) error {
 	// Test basic connectivity
-	health, err := c.client.Sys().Health()
+	health, err := c.client.Sys().HealthWithContext(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to check Vault health: %w", err)
+		return fmt.Errorf("failed to check Vault health: %w", classify(err))
 	}
 
 	if !health.Initialized {
@@ -230,13 +357,13 @@ func (c *Client) TestConnection() error {
 	}
 
 	if health.Sealed {
-		return fmt.Errorf("vault is sealed")
+		return ErrSealed
 	}
 
 	// Test authentication by trying to read token info
-	_, err = c.client.Auth().Token().LookupSelf()
+	_, err = c.client.Auth().Token().LookupSelfWithContext(ctx)
 	if err != nil {
-		return fmt.Errorf("authentication failed: %w", err)
+		return fmt.Errorf("authentication failed: %w", classify(err))
 	}
 
 	return nil
@@ -0,0 +1,45 @@
+package vault_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-go-golems/vault-envrc-generator/pkg/vault"
+	"github.com/go-go-golems/vault-envrc-generator/pkg/vaulttest"
+)
+
+func TestClientRetriesServerErrors(t *testing.T) {
+	srv := vaulttest.NewServer(t)
+	srv.Put("secret/app/db", map[string]interface{}{"password": "v1"})
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		maxRetries int
+		attempts   int
+	}{
+		{maxRetries: 3, attempts: 4},
+		{maxRetries: 1, attempts: 2},
+		{maxRetries: -1, attempts: 1},
+	} {
+		srv.SetSealed(false)
+		client, err := vault.NewClient(ctx, vault.Config{
+			Address:      srv.URL,
+			MaxRetries:   tc.maxRetries,
+			MinRetryWait: time.Millisecond,
+			MaxRetryWait: time.Millisecond,
+		}, srv.Token)
+		require.NoError(t, err)
+		_, err = client.GetSecrets(ctx, "secret/app/db")
+		require.NoError(t, err)
+
+		// Every request now fails with 503 and is retried up to MaxRetries times
+		srv.SetSealed(true)
+		srv.ResetRequests()
+		_, err = client.GetSecrets(ctx, "secret/app/db")
+		require.ErrorIs(t, err, vault.ErrSealed)
+		require.Len(t, srv.Requests(), tc.attempts, "max retries %d", tc.maxRetries)
+	}
+}
@@ -0,0 +1,139 @@
+package vault
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// DefaultAddress is used when neither the configuration nor VAULT_ADDR provide an address.
+const DefaultAddress = "http://127.0.0.1:8200"
+
+// Config holds the connection settings for a Vault client. Empty fields fall back to the
+// standard VAULT_* environment variables (see WithEnvironment), so explicit settings always
+// win over the environment, which wins over the built-in defaults.
+type Config struct {
+	Address       string
+	CACert        string
+	CAPath        string
+	ClientCert    string
+	ClientKey     string
+	TLSServerName string
+	SkipVerify    bool
+	Timeout       time.Duration
+	Namespace     string
+
+	// MaxRetries is the number of retries for requests that fail with 429 or 5xx responses or
+	// connection errors: 0 uses $VAULT_MAX_RETRIES or the Vault default (2), negative disables retries.
+	MaxRetries int
+	// MinRetryWait and MaxRetryWait bound the jittered backoff between retries (0 = Vault defaults)
+	MinRetryWait time.Duration
+	MaxRetryWait time.Duration
+}
+
+// WithEnvironment returns a copy of cfg where unset fields are filled from VAULT_ADDR,
+// VAULT_CACERT, VAULT_CAPATH, VAULT_CLIENT_CERT, VAULT_CLIENT_KEY, VAULT_TLS_SERVER_NAME,
+// VAULT_SKIP_VERIFY, VAULT_CLIENT_TIMEOUT, VAULT_NAMESPACE and VAULT_MAX_RETRIES, and the
+// address defaults to DefaultAddress.
+func (cfg Config) WithEnvironment() (Config, error) {
+	fill := func(field *string, env string) {
+		if *field == "" {
+			*field = os.Getenv(env)
+		}
+	}
+	fill(&cfg.Address, "VAULT_ADDR")
+	fill(&cfg.CACert, "VAULT_CACERT")
+	fill(&cfg.CAPath, "VAULT_CAPATH")
+	fill(&cfg.ClientCert, "VAULT_CLIENT_CERT")
+	fill(&cfg.ClientKey, "VAULT_CLIENT_KEY")
+	fill(&cfg.TLSServerName, "VAULT_TLS_SERVER_NAME")
+	fill(&cfg.Namespace, "VAULT_NAMESPACE")
+
+	if !cfg.SkipVerify {
+		if v := os.Getenv("VAULT_SKIP_VERIFY"); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid VAULT_SKIP_VERIFY %q: %w", v, err)
+			}
+			cfg.SkipVerify = b
+		}
+	}
+	if cfg.Timeout == 0 {
+		if v := os.Getenv("VAULT_CLIENT_TIMEOUT"); v != "" {
+			d, err := parseTimeout(v)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid VAULT_CLIENT_TIMEOUT %q: %w", v, err)
+			}
+			cfg.Timeout = d
+		}
+	}
+	if cfg.MaxRetries == 0 {
+		if v := os.Getenv("VAULT_MAX_RETRIES"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid VAULT_MAX_RETRIES %q: %w", v, err)
+			}
+			if n == 0 {
+				n = -1
+			}
+			cfg.MaxRetries = n
+		}
+	}
+	if cfg.Address == "" {
+		cfg.Address = DefaultAddress
+	}
+	return cfg, nil
+}
+
+// apiConfig converts cfg into a Vault API configuration
+func (cfg Config) apiConfig() (*api.Config, error) {
+	config := api.DefaultConfig()
+	if config.Error != nil {
+		return nil, config.Error
+	}
+	config.Address = cfg.Address
+	if cfg.Timeout > 0 {
+		config.Timeout = cfg.Timeout
+	}
+	switch {
+	case cfg.MaxRetries > 0:
+		config.MaxRetries = cfg.MaxRetries
+	case cfg.MaxRetries < 0:
+		config.MaxRetries = 0
+	}
+	if cfg.MinRetryWait > 0 {
+		config.MinRetryWait = cfg.MinRetryWait
+	}
+	if cfg.MaxRetryWait > 0 {
+		config.MaxRetryWait = cfg.MaxRetryWait
+	}
+	if config.MaxRetryWait < config.MinRetryWait {
+		config.MaxRetryWait = config.MinRetryWait
+	}
+
+	tlsConfig := &api.TLSConfig{
+		CACert:        cfg.CACert,
+		CAPath:        cfg.CAPath,
+		ClientCert:    cfg.ClientCert,
+		ClientKey:     cfg.ClientKey,
+		TLSServerName: cfg.TLSServerName,
+		Insecure:      cfg.SkipVerify,
+	}
+	if err := config.ConfigureTLS(tlsConfig); err != nil {
+		return nil, fmt.Errorf("failed to configure TLS: %w", err)
+	}
+	return config, nil
+}
+
+// parseTimeout accepts Go durations ("30s", "1m") as well as plain seconds ("30"), like the Vault CLI
+func parseTimeout(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if secs, err := strconv.Atoi(s); err == nil {
+		return time.Duration(secs) * time.Second, nil
+	}
+	return time.ParseDuration(s)
+}
@@ -1,7 +1,7 @@
 package vault
 
 import (
-	"fmt"
+	"context"
 	"regexp"
 	"strings"
 )
@@ -29,62 +29,61 @@ type TokenContext struct {
 	OIDCUserID  string
 }
 
-// BuildTemplateContext populates TemplateContext from the current token info
-func BuildTemplateContext(vc *Client) (TemplateContext, error) {
-	client := vc.GetClient()
-	tInfo, err := client.Auth().Token().LookupSelf()
+// BuildTemplateContext populates TemplateContext from the store's current token info
+func BuildTemplateContext(ctx context.Context, store SecretStore) (TemplateContext, error) {
+	data, err := store.LookupToken(ctx)
 	if err != nil {
-		return TemplateContext{}, fmt.Errorf("token lookup failed: %w", err)
+		return TemplateContext{}, err
 	}
-	ctx := TemplateContext{Token: TokenContext{}}
-	if tInfo != nil && tInfo.Data != nil {
+	tctx := TemplateContext{Token: TokenContext{}}
+	if data != nil {
 		getStr := func(key string) string {
-			if v, ok := tInfo.Data[key]; ok {
+			if v, ok := data[key]; ok {
 				if s, ok := v.(string); ok {
 					return s
 				}
 			}
 			return ""
 		}
-		ctx.Token.Accessor = getStr("accessor")
-		ctx.Token.CreationTTL = getStr("creation_ttl")
-		ctx.Token.DisplayName = getStr("display_name")
-		ctx.Token.EntityID = getStr("entity_id")
-		ctx.Token.ExpireTime = getStr("expire_time")
-		ctx.Token.ID = getStr("id")
-		ctx.Token.IssueTime = getStr("issue_time")
-		ctx.Token.Path = getStr("path")
-		ctx.Token.TTL = getStr("ttl")
-		ctx.Token.Type = getStr("type")
+		tctx.Token.Accessor = getStr("accessor")
+		tctx.Token.CreationTTL = getStr("creation_ttl")
+		tctx.Token.DisplayName = getStr("display_name")
+		tctx.Token.EntityID = getStr("entity_id")
+		tctx.Token.ExpireTime = getStr("expire_time")
+		tctx.Token.ID = getStr("id")
+		tctx.Token.IssueTime = getStr("issue_time")
+		tctx.Token.Path = getStr("path")
+		tctx.Token.TTL = getStr("ttl")
+		tctx.Token.Type = getStr("type")
 		// Policies
-		if pv, ok := tInfo.Data["policies"]; ok {
+		if pv, ok := data["policies"]; ok {
 			if arr, ok := pv.([]interface{}); ok {
 				for _, it := range arr {
 					if s, ok := it.(string); ok {
-						ctx.Token.Policies = append(ctx.Token.Policies, s)
+						tctx.Token.Policies = append(tctx.Token.Policies, s)
 					}
 				}
 			}
 		}
 		// Meta (flatten map[string]string)
-		ctx.Token.Meta = map[string]string{}
-		if mv, ok := tInfo.Data["meta"]; ok {
+		tctx.Token.Meta = map[string]string{}
+		if mv, ok := data["meta"]; ok {
 			if m, ok := mv.(map[string]interface{}); ok {
 				for k, v := range m {
 					if s, ok := v.(string); ok {
-						ctx.Token.Meta[k] = s
+						tctx.Token.Meta[k] = s
 					}
 				}
 			}
 		}
 		// Derive OIDCUserID from display_name like "oidc-123456"
-		if strings.HasPrefix(ctx.Token.DisplayName, "oidc-") {
+		if strings.HasPrefix(tctx.Token.DisplayName, "oidc-") {
 			re := regexp.MustCompile(`oidc-([0-9A-Za-z_-]+)`)
-			m := re.FindStringSubmatch(ctx.Token.DisplayName)
+			m := re.FindStringSubmatch(tctx.Token.DisplayName)
 			if len(m) == 2 {
-				ctx.Token.OIDCUserID = m[1]
+				tctx.Token.OIDCUserID = m[1]
 			}
 		}
 	}
-	return ctx, nil
+	return tctx, nil
 }
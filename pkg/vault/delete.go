@@ -0,0 +1,142 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// DeleteMode selects how a secret is removed.
+type DeleteMode string
+
+const (
+	// DeleteModeSoft soft-deletes versions on KV v2 (recoverable with UndeleteVersions).
+	// On KV v1 it is a regular, permanent delete.
+	DeleteModeSoft DeleteMode = "soft"
+	// DeleteModeDestroy permanently destroys version data on KV v2 but keeps the metadata.
+	DeleteModeDestroy DeleteMode = "destroy"
+	// DeleteModeMetadata removes the metadata and all versions on KV v2, so the path disappears from listings.
+	DeleteModeMetadata DeleteMode = "metadata"
+)
+
+// ParseDeleteMode validates a delete mode string; an empty string means DeleteModeSoft.
+func ParseDeleteMode(s string) (DeleteMode, error) {
+	switch DeleteMode(s) {
+	case "", DeleteModeSoft:
+		return DeleteModeSoft, nil
+	case DeleteModeDestroy, DeleteModeMetadata:
+		return DeleteMode(s), nil
+	default:
+		return "", fmt.Errorf("invalid delete mode %q (expected soft, destroy or metadata)", s)
+	}
+}
+
+// DeleteSecretWithMode removes the secret at path using mode. versions selects the KV v2 versions
+// for soft and destroy modes; when empty, soft mode deletes the latest version and destroy mode
+// destroys every version. On KV v1 mounts every mode is a plain delete, and versions must be empty.
+func (c *Client) DeleteSecretWithMode(ctx context.Context, path string, mode DeleteMode, versions []int) error {
+	mount, secretPath, err := c.ResolveMount(ctx, path)
+	if err != nil {
+		return err
+	}
+	if !mount.IsKVv2() {
+		if len(versions) > 0 {
+			return fmt.Errorf("cannot select versions for %s: mount %s is not KV v2", path, mount.Path)
+		}
+		return c.deleteKVv1Secret(ctx, path)
+	}
+
+	switch mode {
+	case DeleteModeSoft, "":
+		if len(versions) == 0 {
+			return c.deleteKVv2Secret(ctx, mount.Path, secretPath)
+		}
+		return c.writeKVv2Versions(ctx, mount.Path, "delete", secretPath, versions)
+	case DeleteModeDestroy:
+		if len(versions) == 0 {
+			meta, err := c.GetSecretMetadata(ctx, path)
+			if err != nil {
+				return err
+			}
+			versions = meta.VersionNumbers()
+		}
+		if len(versions) == 0 {
+			return nil
+		}
+		return c.writeKVv2Versions(ctx, mount.Path, "destroy", secretPath, versions)
+	case DeleteModeMetadata:
+		fullPath := kvv2Path(mount.Path, "metadata", secretPath)
+		if _, err := c.client.Logical().DeleteWithContext(ctx, fullPath); err != nil {
+			return fmt.Errorf("failed to delete metadata at %s: %w", fullPath, classify(err))
+		}
+		return nil
+	default:
+		return fmt.Errorf("invalid delete mode %q", mode)
+	}
+}
+
+// UndeleteVersions restores soft-deleted KV v2 versions of the secret at path. When versions is
+// empty, every soft-deleted (but not destroyed) version is restored. It returns the restored versions.
+func (c *Client) UndeleteVersions(ctx context.Context, path string, versions []int) ([]int, error) {
+	mount, secretPath, err := c.ResolveMount(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	if !mount.IsKVv2() {
+		return nil, fmt.Errorf("cannot undelete %s: mount %s is not KV v2", path, mount.Path)
+	}
+	if len(versions) == 0 {
+		meta, err := c.GetSecretMetadata(ctx, path)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range meta.VersionNumbers() {
+			vm := meta.Versions[v]
+			if !vm.Destroyed && !vm.IsReadable() {
+				versions = append(versions, v)
+			}
+		}
+	}
+	if len(versions) == 0 {
+		return nil, nil
+	}
+	if err := c.writeKVv2Versions(ctx, mount.Path, "undelete", secretPath, versions); err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+// writeKVv2Versions posts a version list to one of the KV v2 delete/undelete/destroy endpoints
+func (c *Client) writeKVv2Versions(ctx context.Context, mountPath, kind, secretPath string, versions []int) error {
+	fullPath := kvv2Path(mountPath, kind, secretPath)
+	payload := map[string]interface{}{"versions": versions}
+	if _, err := c.client.Logical().WriteWithContext(ctx, fullPath, payload); err != nil {
+		return fmt.Errorf("failed to %s versions %v at %s: %w", kind, versions, fullPath, classify(err))
+	}
+	return nil
+}
+
+// VersionNumbers returns the known version numbers in ascending order.
+func (m *SecretMetadata) VersionNumbers() []int {
+	versions := make([]int, 0, len(m.Versions))
+	for v := range m.Versions {
+		versions = append(versions, v)
+	}
+	sort.Ints(versions)
+	return versions
+}
+
+// Status describes the state of the current version: "active", "deleted" or "destroyed".
+func (m *SecretMetadata) Status() string {
+	vm, ok := m.Versions[m.CurrentVersion]
+	switch {
+	case !ok:
+		return "active"
+	case vm.Destroyed:
+		return "destroyed"
+	case !vm.IsReadable():
+		return "deleted"
+	default:
+		return "active"
+	}
+}
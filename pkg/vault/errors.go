@@ -0,0 +1,57 @@
+package vault
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+)
+
+var (
+	// ErrNotFound indicates that no secret (or no readable version of it) exists at the path.
+	ErrNotFound = errors.New("not found")
+	// ErrPermissionDenied indicates that the token is not allowed to perform the operation.
+	ErrPermissionDenied = errors.New("permission denied")
+	// ErrSealed indicates that the Vault server is sealed.
+	ErrSealed = errors.New("vault is sealed")
+	// ErrVersionConflict indicates that a check-and-set write was rejected because the secret
+	// was modified after the version the caller read.
+	ErrVersionConflict = errors.New("secret version conflict")
+)
+
+// classifiedError tags a Vault API error with one of the sentinel errors so callers can use
+// errors.Is while the message stays the one returned by Vault.
+type classifiedError struct {
+	kind error
+	err  error
+}
+
+func (e *classifiedError) Error() string   { return e.err.Error() }
+func (e *classifiedError) Unwrap() []error { return []error{e.kind, e.err} }
+
+// classify wraps err with ErrNotFound, ErrPermissionDenied or ErrSealed based on the HTTP status
+// of a Vault response error. Other errors are returned unchanged.
+func classify(err error) error {
+	var respErr *api.ResponseError
+	if err == nil || !errors.As(err, &respErr) {
+		return err
+	}
+	var kind error
+	switch respErr.StatusCode {
+	case http.StatusNotFound:
+		kind = ErrNotFound
+	case http.StatusForbidden:
+		kind = ErrPermissionDenied
+	case http.StatusServiceUnavailable:
+		for _, e := range respErr.Errors {
+			if strings.Contains(strings.ToLower(e), "sealed") {
+				kind = ErrSealed
+			}
+		}
+	}
+	if kind == nil {
+		return err
+	}
+	return &classifiedError{kind: kind, err: err}
+}
@@ -0,0 +1,19 @@
+package vault
+
+import (
+	"context"
+	"time"
+)
+
+// SetMinTokenRefresh shortens how often the token watcher wakes up; call the returned function
+// once the watcher has stopped
+func SetMinTokenRefresh(d time.Duration) func() {
+	previous := minTokenRefresh
+	minTokenRefresh = d
+	return func() { minTokenRefresh = previous }
+}
+
+// RefreshToken exposes refreshToken to the external tests
+func (c *Client) RefreshToken(ctx context.Context, ttl time.Duration, renewable bool, opts TokenWatchOptions) (time.Duration, bool, bool) {
+	return c.refreshToken(ctx, ttl, renewable, opts)
+}
@@ -0,0 +1,148 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// minTokenRefresh bounds how often the token watcher wakes up for short-lived tokens (a
+// variable so tests can shorten it)
+var minTokenRefresh = 5 * time.Second
+
+// TokenWatchOptions configures WatchToken.
+type TokenWatchOptions struct {
+	// WarnTTL logs a warning when the token's remaining TTL is below this duration (0 disables the warning)
+	WarnTTL time.Duration
+	// Renew renews renewable tokens in the background before they expire
+	Renew bool
+	// Relogin obtains a fresh token when the current one cannot be renewed any further; may be nil
+	Relogin func(ctx context.Context) (string, error)
+}
+
+// TokenTTL looks up the current token and returns its remaining TTL and whether it is renewable.
+// A TTL of zero means the token does not expire (e.g. root tokens).
+func (c *Client) TokenTTL(ctx context.Context) (time.Duration, bool, error) {
+	secret, err := c.client.Auth().Token().LookupSelfWithContext(ctx)
+	if err != nil {
+		return 0, false, fmt.Errorf("token lookup failed: %w", err)
+	}
+	if secret == nil {
+		return 0, false, fmt.Errorf("token lookup returned no data")
+	}
+	ttl, err := secret.TokenTTL()
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to read token TTL: %w", err)
+	}
+	renewable, err := secret.TokenIsRenewable()
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to read token renewability: %w", err)
+	}
+	return ttl, renewable, nil
+}
+
+// WatchToken warns when the token's remaining TTL is below opts.WarnTTL and, for expiring tokens,
+// keeps the client authenticated in the background: renewable tokens are renewed when two thirds
+// of their TTL has elapsed, and opts.Relogin is used once renewal is impossible or capped by the
+// token's max TTL. Call the returned function to stop watching.
+func (c *Client) WatchToken(ctx context.Context, opts TokenWatchOptions) func() {
+	ttl, renewable, err := c.TokenTTL(ctx)
+	if err != nil {
+		log.Debug().Err(err).Msg("vault: cannot inspect token, not watching it")
+		return func() {}
+	}
+	warnTokenTTL(ttl, renewable, opts)
+	if ttl == 0 || (!opts.Renew && opts.Relogin == nil) {
+		return func() {}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.keepTokenAlive(ctx, ttl, renewable, opts)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+func warnTokenTTL(ttl time.Duration, renewable bool, opts TokenWatchOptions) {
+	if ttl == 0 || opts.WarnTTL <= 0 || ttl >= opts.WarnTTL {
+		return
+	}
+	ev := log.Warn().Dur("ttl", ttl).Bool("renewable", renewable)
+	switch {
+	case renewable && opts.Renew:
+		ev.Msg("vault: token expires soon, it will be renewed in the background")
+	case opts.Relogin != nil:
+		ev.Msg("vault: token expires soon, a new token will be requested from the auth method")
+	default:
+		ev.Msg("vault: token expires soon and will not be renewed; long operations may fail")
+	}
+}
+
+func (c *Client) keepTokenAlive(ctx context.Context, ttl time.Duration, renewable bool, opts TokenWatchOptions) {
+	for {
+		wait := ttl * 2 / 3
+		if wait < minTokenRefresh {
+			wait = minTokenRefresh
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+
+		newTTL, newRenewable, ok := c.refreshToken(ctx, ttl, renewable, opts)
+		if !ok {
+			return
+		}
+		ttl, renewable = newTTL, newRenewable
+	}
+}
+
+// refreshToken renews or replaces the token; ok is false when there is nothing more to do
+func (c *Client) refreshToken(ctx context.Context, ttl time.Duration, renewable bool, opts TokenWatchOptions) (time.Duration, bool, bool) {
+	if renewable && opts.Renew {
+		secret, err := c.client.Auth().Token().RenewSelfWithContext(ctx, 0)
+		if err == nil && secret != nil && secret.Auth != nil {
+			renewed := time.Duration(secret.Auth.LeaseDuration) * time.Second
+			// A renewal that no longer extends the TTL means the token's max TTL is near
+			if renewed >= ttl/2 || opts.Relogin == nil {
+				log.Debug().Dur("ttl", renewed).Msg("vault: token renewed")
+				if renewed < minTokenRefresh {
+					log.Warn().Dur("ttl", renewed).Msg("vault: token reached its max TTL and cannot be renewed further")
+					return 0, false, false
+				}
+				return renewed, secret.Auth.Renewable, true
+			}
+		} else if ctx.Err() == nil {
+			log.Warn().Err(err).Msg("vault: token renewal failed")
+		}
+	}
+
+	if opts.Relogin == nil {
+		if ctx.Err() == nil {
+			log.Warn().Msg("vault: token cannot be renewed and no auth method is configured for re-login")
+		}
+		return 0, false, false
+	}
+	token, err := opts.Relogin(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Warn().Err(err).Msg("vault: re-login failed")
+		}
+		return 0, false, false
+	}
+	c.client.SetToken(token)
+	newTTL, newRenewable, err := c.TokenTTL(ctx)
+	if err != nil || newTTL == 0 {
+		return 0, false, false
+	}
+	log.Info().Dur("ttl", newTTL).Msg("vault: obtained a new token from the auth method")
+	return newTTL, newRenewable, true
+}
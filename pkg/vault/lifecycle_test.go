@@ -0,0 +1,90 @@
+package vault_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-go-golems/vault-envrc-generator/pkg/vault"
+	"github.com/go-go-golems/vault-envrc-generator/pkg/vaulttest"
+)
+
+func TestRefreshTokenRenews(t *testing.T) {
+	srv := vaulttest.NewServer(t)
+	srv.SetTokenData(map[string]interface{}{"ttl": 3600, "renewable": true})
+	client := srv.Client()
+
+	ttl, renewable, ok := client.RefreshToken(context.Background(), time.Hour, true, vault.TokenWatchOptions{Renew: true})
+	require.True(t, ok)
+	require.Equal(t, time.Hour, ttl)
+	require.True(t, renewable)
+	require.Equal(t, 1, countRequests(srv, "PUT", "auth/token/renew-self"))
+}
+
+func TestRefreshTokenReloginsWhenRenewalStopsExtending(t *testing.T) {
+	srv := vaulttest.NewServer(t)
+	// The token is close to its max TTL: renewing grants one minute instead of an hour
+	srv.SetTokenData(map[string]interface{}{"ttl": 60, "renewable": true})
+	client := srv.Client()
+	ctx := context.Background()
+
+	relogins := 0
+	opts := vault.TokenWatchOptions{Renew: true, Relogin: func(context.Context) (string, error) {
+		relogins++
+		srv.SetTokenData(map[string]interface{}{"ttl": 7200})
+		return srv.Token, nil
+	}}
+	ttl, renewable, ok := client.RefreshToken(ctx, time.Hour, true, opts)
+	require.True(t, ok)
+	require.Equal(t, 2*time.Hour, ttl)
+	require.True(t, renewable)
+	require.Equal(t, 1, relogins)
+
+	// Without an auth method the capped renewal is kept until it drops below minTokenRefresh
+	srv.SetTokenData(map[string]interface{}{"ttl": 60})
+	ttl, _, ok = client.RefreshToken(ctx, time.Hour, true, vault.TokenWatchOptions{Renew: true})
+	require.True(t, ok)
+	require.Equal(t, time.Minute, ttl)
+	srv.SetTokenData(map[string]interface{}{"ttl": 1})
+	_, _, ok = client.RefreshToken(ctx, time.Minute, true, vault.TokenWatchOptions{Renew: true})
+	require.False(t, ok)
+
+	// A token that cannot be renewed is replaced right away
+	_, _, ok = client.RefreshToken(ctx, time.Minute, false, opts)
+	require.True(t, ok)
+	require.Equal(t, 2, relogins)
+	_, _, ok = client.RefreshToken(ctx, time.Minute, false, vault.TokenWatchOptions{Renew: true})
+	require.False(t, ok)
+}
+
+func TestWatchTokenStopsOnCancel(t *testing.T) {
+	t.Cleanup(vault.SetMinTokenRefresh(10 * time.Millisecond))
+	srv := vaulttest.NewServer(t)
+	srv.SetTokenData(map[string]interface{}{"ttl": 1, "renewable": true})
+	client := srv.Client()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stop := client.WatchToken(ctx, vault.TokenWatchOptions{Renew: true})
+	require.Eventually(t, func() bool {
+		return countRequests(srv, "PUT", "auth/token/renew-self") >= 2
+	}, 5*time.Second, 10*time.Millisecond, "token not renewed in the background")
+
+	cancel()
+	stopped := make(chan struct{})
+	go func() {
+		stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("stop did not return after the context was cancelled")
+	}
+
+	// Once stop has returned the watcher makes no further requests
+	renewals := countRequests(srv, "PUT", "auth/token/renew-self")
+	time.Sleep(time.Second)
+	require.Equal(t, renewals, countRequests(srv, "PUT", "auth/token/renew-self"))
+}
@@ -0,0 +1,217 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// DefaultKubernetesTokenFile is the service account token mounted into Kubernetes pods.
+const DefaultKubernetesTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// AuthConfig holds the credentials for the login token sources. Secrets can be given inline,
+// read from a file, or taken from an environment variable (VAULT_ROLE_ID, VAULT_SECRET_ID,
+// VAULT_USERNAME, VAULT_PASSWORD, VAULT_JWT), in that order of precedence.
+type AuthConfig struct {
+	// Mount is the auth method mount path; defaults to the method name (approle, userpass, jwt, kubernetes)
+	Mount string
+
+	// AppRole
+	RoleID       string
+	RoleIDFile   string
+	SecretID     string
+	SecretIDFile string
+
+	// Userpass
+	Username     string
+	Password     string
+	PasswordFile string
+
+	// JWT and Kubernetes
+	Role    string
+	JWT     string
+	JWTFile string
+
+	// CacheToken writes the issued token to the token file and reuses it while it is still valid
+	CacheToken bool
+}
+
+// Login authenticates against the auth method for source and returns the client token.
+// When auth.CacheToken is set, a still-valid token in tokenFile is reused and a freshly
+// issued token is written back to tokenFile (default ~/.vault-token) with 0600 permissions.
+func Login(ctx context.Context, source TokenSource, cfg Config, auth AuthConfig, tokenFile string) (string, error) {
+	return login(ctx, source, cfg, auth, tokenFile, true)
+}
+
+// ReloginFunc returns a function that always performs a fresh login with the configured auth
+// method (still caching the new token if requested), or nil when the source does not log in.
+func (o TokenOptions) ReloginFunc() func(ctx context.Context) (string, error) {
+	if !o.Source.IsLogin() {
+		return nil
+	}
+	return func(ctx context.Context) (string, error) {
+		return login(ctx, o.Source, o.Config, o.Auth, expandHome(o.TokenFile), false)
+	}
+}
+
+func login(ctx context.Context, source TokenSource, cfg Config, auth AuthConfig, tokenFile string, reuseCached bool) (string, error) {
+	if !source.IsLogin() {
+		return "", fmt.Errorf("token source %s does not log in", source)
+	}
+	cfg, err := cfg.WithEnvironment()
+	if err != nil {
+		return "", err
+	}
+	config, err := cfg.apiConfig()
+	if err != nil {
+		return "", fmt.Errorf("failed to configure Vault client: %w", err)
+	}
+	client, err := api.NewClient(config)
+	if err != nil {
+		return "", fmt.Errorf("failed to create Vault client: %w", err)
+	}
+	// Never send a token inherited from VAULT_TOKEN along with the login request
+	client.SetToken("")
+	if cfg.Namespace != "" {
+		client.SetNamespace(cfg.Namespace)
+	}
+
+	if tokenFile == "" {
+		tokenFile = defaultTokenFile()
+	}
+	if reuseCached && auth.CacheToken && tokenFile != "" {
+		if token, ok := cachedToken(ctx, client, tokenFile); ok {
+			return token, nil
+		}
+	}
+
+	path, payload, err := loginRequest(source, auth)
+	if err != nil {
+		return "", err
+	}
+	secret, err := client.Logical().WriteWithContext(ctx, path, payload)
+	if err != nil {
+		return "", fmt.Errorf("%s login failed: %w", source, err)
+	}
+	if secret == nil || secret.Auth == nil || secret.Auth.ClientToken == "" {
+		return "", fmt.Errorf("%s login at %s returned no token", source, path)
+	}
+	token := secret.Auth.ClientToken
+
+	if auth.CacheToken && tokenFile != "" {
+		if err := writeTokenFile(tokenFile, token); err != nil {
+			return "", err
+		}
+	}
+	return token, nil
+}
+
+// loginRequest builds the login path and payload for source
+func loginRequest(source TokenSource, auth AuthConfig) (string, map[string]interface{}, error) {
+	mount := strings.Trim(auth.Mount, "/")
+	if mount == "" {
+		mount = string(source)
+	}
+
+	switch source {
+	case TokenSourceAppRole:
+		roleID, err := credential("role ID", auth.RoleID, auth.RoleIDFile, "VAULT_ROLE_ID")
+		if err != nil {
+			return "", nil, err
+		}
+		payload := map[string]interface{}{"role_id": roleID}
+		// The secret ID is optional for roles with bind_secret_id=false, but one that was
+		// configured and cannot be read is an error
+		if auth.SecretID != "" || auth.SecretIDFile != "" || os.Getenv("VAULT_SECRET_ID") != "" {
+			secretID, err := credential("secret ID", auth.SecretID, auth.SecretIDFile, "VAULT_SECRET_ID")
+			if err != nil {
+				return "", nil, err
+			}
+			payload["secret_id"] = secretID
+		}
+		return "auth/" + mount + "/login", payload, nil
+
+	case TokenSourceUserpass:
+		username := auth.Username
+		if username == "" {
+			username = os.Getenv("VAULT_USERNAME")
+		}
+		if username == "" {
+			return "", nil, fmt.Errorf("userpass login requires a username")
+		}
+		password, err := credential("password", auth.Password, auth.PasswordFile, "VAULT_PASSWORD")
+		if err != nil {
+			return "", nil, err
+		}
+		return "auth/" + mount + "/login/" + username, map[string]interface{}{"password": password}, nil
+
+	case TokenSourceJWT, TokenSourceKubernetes:
+		if auth.Role == "" {
+			return "", nil, fmt.Errorf("%s login requires a role", source)
+		}
+		jwtFile := auth.JWTFile
+		if jwtFile == "" && auth.JWT == "" && os.Getenv("VAULT_JWT") == "" && source == TokenSourceKubernetes {
+			jwtFile = DefaultKubernetesTokenFile
+		}
+		jwt, err := credential("JWT", auth.JWT, jwtFile, "VAULT_JWT")
+		if err != nil {
+			return "", nil, err
+		}
+		return "auth/" + mount + "/login", map[string]interface{}{"role": auth.Role, "jwt": jwt}, nil
+	}
+	return "", nil, fmt.Errorf("unknown login source: %s", source)
+}
+
+// credential returns value, else the trimmed content of file, else the environment variable env
+func credential(name, value, file, env string) (string, error) {
+	if value != "" {
+		return value, nil
+	}
+	if file != "" {
+		data, err := os.ReadFile(expandHome(file))
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s file %s: %w", name, file, err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+	if v := os.Getenv(env); v != "" {
+		return v, nil
+	}
+	return "", fmt.Errorf("no %s provided (set it directly, via a file, or $%s)", name, env)
+}
+
+// cachedToken returns the token stored in tokenFile if Vault still accepts it
+func cachedToken(ctx context.Context, client *api.Client, tokenFile string) (string, bool) {
+	data, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return "", false
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", false
+	}
+	clone, err := client.Clone()
+	if err != nil {
+		return "", false
+	}
+	clone.SetToken(token)
+	secret, err := clone.Auth().Token().LookupSelfWithContext(ctx)
+	if err != nil || secret == nil {
+		return "", false
+	}
+	return token, true
+}
+
+func writeTokenFile(tokenFile, token string) error {
+	if err := os.MkdirAll(filepath.Dir(tokenFile), 0o700); err != nil {
+		return fmt.Errorf("failed to create directory for token file %s: %w", tokenFile, err)
+	}
+	if err := os.WriteFile(tokenFile, []byte(token), 0o600); err != nil {
+		return fmt.Errorf("failed to cache token in %s: %w", tokenFile, err)
+	}
+	return nil
+}
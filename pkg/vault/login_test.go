@@ -0,0 +1,89 @@
+package vault
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoginRequestPayloads(t *testing.T) {
+	dir := t.TempDir()
+	secretFile := filepath.Join(dir, "secret-id")
+	require.NoError(t, os.WriteFile(secretFile, []byte("from-file\n"), 0o600))
+	jwtFile := filepath.Join(dir, "jwt")
+	require.NoError(t, os.WriteFile(jwtFile, []byte("eyJ.file\n"), 0o600))
+	for _, env := range []string{"VAULT_ROLE_ID", "VAULT_SECRET_ID", "VAULT_USERNAME", "VAULT_PASSWORD", "VAULT_JWT"} {
+		t.Setenv(env, "")
+	}
+
+	for _, tc := range []struct {
+		name    string
+		source  TokenSource
+		auth    AuthConfig
+		env     map[string]string
+		path    string
+		payload map[string]interface{}
+		err     string
+	}{
+		{
+			name: "approle inline", source: TokenSourceAppRole,
+			auth: AuthConfig{RoleID: "role", SecretID: "inline"},
+			path: "auth/approle/login", payload: map[string]interface{}{"role_id": "role", "secret_id": "inline"},
+		},
+		{
+			name: "approle secret id file", source: TokenSourceAppRole,
+			auth: AuthConfig{RoleID: "role", SecretIDFile: secretFile, Mount: "/ci-approle/"},
+			path: "auth/ci-approle/login", payload: map[string]interface{}{"role_id": "role", "secret_id": "from-file"},
+		},
+		{
+			name: "approle environment", source: TokenSourceAppRole,
+			env:  map[string]string{"VAULT_ROLE_ID": "env-role", "VAULT_SECRET_ID": "env-secret"},
+			path: "auth/approle/login", payload: map[string]interface{}{"role_id": "env-role", "secret_id": "env-secret"},
+		},
+		{
+			name: "approle without secret id", source: TokenSourceAppRole,
+			auth: AuthConfig{RoleID: "role"},
+			path: "auth/approle/login", payload: map[string]interface{}{"role_id": "role"},
+		},
+		{
+			name: "approle unreadable secret id file", source: TokenSourceAppRole,
+			auth: AuthConfig{RoleID: "role", SecretIDFile: filepath.Join(dir, "missing")},
+			err:  "failed to read secret ID file",
+		},
+		{
+			name: "approle without role id", source: TokenSourceAppRole,
+			err: "no role ID provided",
+		},
+		{
+			name: "userpass", source: TokenSourceUserpass,
+			auth: AuthConfig{Username: "alice"}, env: map[string]string{"VAULT_PASSWORD": "pw"},
+			path: "auth/userpass/login/alice", payload: map[string]interface{}{"password": "pw"},
+		},
+		{
+			name: "jwt file", source: TokenSourceJWT,
+			auth: AuthConfig{Role: "ci", JWTFile: jwtFile},
+			path: "auth/jwt/login", payload: map[string]interface{}{"role": "ci", "jwt": "eyJ.file"},
+		},
+		{
+			name: "kubernetes environment", source: TokenSourceKubernetes,
+			auth: AuthConfig{Role: "app"}, env: map[string]string{"VAULT_JWT": "eyJ.env"},
+			path: "auth/kubernetes/login", payload: map[string]interface{}{"role": "app", "jwt": "eyJ.env"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			for k, v := range tc.env {
+				t.Setenv(k, v)
+			}
+			path, payload, err := loginRequest(tc.source, tc.auth)
+			if tc.err != "" {
+				require.ErrorContains(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.path, path)
+			require.Equal(t, tc.payload, payload)
+		})
+	}
+}
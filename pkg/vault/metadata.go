@@ -1,6 +1,8 @@
 package vault
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"strconv"
@@ -29,16 +31,22 @@ type SecretVersionMetadata struct {
 }
 
 // GetSecretMetadata retrieves KV v2 metadata for the provided secret path.
-func (c *Client) GetSecretMetadata(path string) (*SecretMetadata, error) {
-	mountPath, secretPath := c.parsePath(path)
+func (c *Client) GetSecretMetadata(ctx context.Context, path string) (*SecretMetadata, error) {
+	mount, secretPath, err := c.ResolveMount(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	if !mount.IsKVv2() {
+		return nil, ErrMetadataNotAvailable
+	}
 	if secretPath == "" {
 		return nil, fmt.Errorf("cannot retrieve metadata for mount path %q", path)
 	}
 
-	fullPath := fmt.Sprintf("%s/metadata/%s", mountPath, secretPath)
-	secret, err := c.client.Logical().Read(fullPath)
+	fullPath := kvv2Path(mount.Path, "metadata", secretPath)
+	secret, err := c.client.Logical().ReadWithContext(ctx, fullPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read metadata from %s: %w", fullPath, err)
+		return nil, fmt.Errorf("failed to read metadata from %s: %w", fullPath, classify(err))
 	}
 	if secret == nil {
 		return nil, ErrMetadataNotAvailable
@@ -99,6 +107,8 @@ func intFromAny(v interface{}) int {
 		return int(t)
 	case float32:
 		return int(t)
+	case json.Number:
+		return intFromString(t.String())
 	case string:
 		return intFromString(t)
 	default:
@@ -159,3 +169,23 @@ func timePtrFromAny(v interface{}) *time.Time {
 	}
 	return nil
 }
+
+// VersionAt returns the version that was current at time t: the newest version created at or
+// before t. The boolean is false when no version existed yet.
+func (m *SecretMetadata) VersionAt(t time.Time) (int, bool) {
+	best := 0
+	for v, vm := range m.Versions {
+		if vm.CreatedTime == nil || vm.CreatedTime.After(t) {
+			continue
+		}
+		if v > best {
+			best = v
+		}
+	}
+	return best, best > 0
+}
+
+// IsReadable reports whether the version's data can still be read (not soft-deleted or destroyed).
+func (vm SecretVersionMetadata) IsReadable() bool {
+	return !vm.Destroyed && (vm.DeletionTime == nil || vm.DeletionTime.IsZero())
+}
@@ -0,0 +1,241 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// systemPrefixes are Vault paths that are always absolute, even when they do not
+// show up in the secret mount listing.
+var systemPrefixes = []string{"sys/", "auth/", "identity/", "cubbyhole/"}
+
+// MountInfo describes a secrets engine mount discovered on the Vault server.
+type MountInfo struct {
+	// Path is the mount path including the trailing slash, e.g. "secret/" or "kv-team/".
+	Path string
+	// Type is the secrets engine type, e.g. "kv", "generic", "transit".
+	Type string
+	// Version is the KV engine version (1 or 2); 0 for non-KV engines.
+	Version int
+}
+
+// IsKV reports whether the mount is a key/value engine (KV v1, KV v2 or legacy generic).
+func (m MountInfo) IsKV() bool {
+	return m.Version > 0
+}
+
+// IsKVv2 reports whether the mount is a versioned KV v2 engine.
+func (m MountInfo) IsKVv2() bool {
+	return m.Version == 2
+}
+
+// mountTable caches mount information for the lifetime of a Client.
+type mountTable struct {
+	mu sync.Mutex
+	// loaded is true once the mounts were listed or the server refused to list them; after a
+	// transient failure the next call tries again
+	loaded bool
+	// listed is true when the full mount list could be read; lookups that miss are then definitive
+	listed bool
+	mounts map[string]MountInfo
+	// unmounted caches the paths the server reported to be outside of any mount when listing
+	// was refused
+	unmounted map[string]bool
+}
+
+// ResolveMount returns the mount that contains path along with the path relative to that mount.
+// Mounts are discovered once per client and cached (a failed discovery is retried on the next
+// call); when the token is not allowed to list mounts, the mount for the specific path is looked
+// up and cached instead, including the answer that the path is not under any mount.
+func (c *Client) ResolveMount(ctx context.Context, path string) (MountInfo, string, error) {
+	path = strings.TrimPrefix(normalizeSlashes(path), "/")
+	c.loadMounts(ctx)
+	if m, ok := c.lookupMount(path); ok {
+		return m, relativeToMount(m, path), nil
+	}
+	c.mounts.mu.Lock()
+	known := c.mounts.listed || c.mounts.unmounted[path]
+	c.mounts.mu.Unlock()
+	if known {
+		return MountInfo{}, "", fmt.Errorf("no mount found for path %s", path)
+	}
+	m, err := c.readMountForPath(ctx, path)
+	if err != nil {
+		if isRefusal(err) {
+			c.markUnmounted(path)
+		}
+		return MountInfo{}, "", fmt.Errorf("failed to determine mount for path %s: %w", path, err)
+	}
+	if m.Path == "" || !strings.HasPrefix(path+"/", m.Path) {
+		c.markUnmounted(path)
+		return MountInfo{}, "", fmt.Errorf("no mount found for path %s", path)
+	}
+	c.mounts.mu.Lock()
+	c.mounts.mounts[m.Path] = m
+	c.mounts.mu.Unlock()
+	return m, relativeToMount(m, path), nil
+}
+
+// Mounts returns the discovered mounts sorted by path.
+func (c *Client) Mounts(ctx context.Context) []MountInfo {
+	c.loadMounts(ctx)
+	c.mounts.mu.Lock()
+	defer c.mounts.mu.Unlock()
+	result := make([]MountInfo, 0, len(c.mounts.mounts))
+	for _, m := range c.mounts.mounts {
+		result = append(result, m)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Path < result[j].Path })
+	return result
+}
+
+// IsAbsolutePath reports whether p starts with a mount known to the server (or a system prefix
+// such as sys/ or auth/) and should therefore not be joined onto a base path.
+func (c *Client) IsAbsolutePath(ctx context.Context, p string) bool {
+	p = strings.TrimPrefix(normalizeSlashes(p), "/")
+	for _, prefix := range systemPrefixes {
+		if strings.HasPrefix(p, prefix) {
+			return true
+		}
+	}
+	if !strings.Contains(p, "/") {
+		return false
+	}
+	_, _, err := c.ResolveMount(ctx, p)
+	return err == nil
+}
+
+// JoinBaseAndPath joins p onto basePath unless p already starts with a mount.
+func (c *Client) JoinBaseAndPath(ctx context.Context, basePath, p string) string {
+	if basePath == "" || c.IsAbsolutePath(ctx, p) {
+		return normalizeSlashes(p)
+	}
+	bp := strings.TrimSuffix(basePath, "/")
+	pp := strings.TrimPrefix(p, "/")
+	return normalizeSlashes(bp + "/" + pp)
+}
+
+func (c *Client) loadMounts(ctx context.Context) {
+	c.mounts.mu.Lock()
+	defer c.mounts.mu.Unlock()
+	if c.mounts.loaded {
+		return
+	}
+	if c.mounts.mounts == nil {
+		c.mounts.mounts = map[string]MountInfo{}
+	}
+
+	// sys/internal/ui/mounts is readable by most tokens and lists the mounts they can see
+	secret, uiErr := c.client.Logical().ReadWithContext(ctx, "sys/internal/ui/mounts")
+	if uiErr == nil && secret != nil {
+		if secretMounts, ok := secret.Data["secret"].(map[string]interface{}); ok {
+			for p, raw := range secretMounts {
+				if m, ok := raw.(map[string]interface{}); ok {
+					c.mounts.mounts[p] = mountInfoFromMap(p, m)
+				}
+			}
+			c.mounts.loaded, c.mounts.listed = true, true
+			return
+		}
+	}
+
+	// Fall back to sys/mounts, which needs read capability on sys/mounts
+	mounts, err := c.client.Sys().ListMountsWithContext(ctx)
+	if err == nil {
+		c.mounts.loaded, c.mounts.listed = true, true
+		for p, m := range mounts {
+			if m == nil {
+				continue
+			}
+			c.mounts.mounts[p] = MountInfo{Path: p, Type: m.Type, Version: kvVersion(m.Type, m.Options["version"])}
+		}
+		return
+	}
+	// Mounts are looked up per path from now on only when the token may not list them
+	c.mounts.loaded = (uiErr == nil || isRefusal(uiErr)) && isRefusal(err)
+}
+
+func (c *Client) markUnmounted(path string) {
+	c.mounts.mu.Lock()
+	defer c.mounts.mu.Unlock()
+	if c.mounts.unmounted == nil {
+		c.mounts.unmounted = map[string]bool{}
+	}
+	c.mounts.unmounted[path] = true
+}
+
+// isRefusal reports whether err is a definitive client error from Vault, such as 403, as opposed
+// to a transient failure (cancelled context, connection error, 429 or 5xx) worth retrying later
+func isRefusal(err error) bool {
+	var respErr *api.ResponseError
+	if !errors.As(err, &respErr) {
+		return false
+	}
+	return respErr.StatusCode >= 400 && respErr.StatusCode < 500 && respErr.StatusCode != http.StatusTooManyRequests
+}
+
+func (c *Client) lookupMount(path string) (MountInfo, bool) {
+	c.mounts.mu.Lock()
+	defer c.mounts.mu.Unlock()
+	var best MountInfo
+	found := false
+	for p, m := range c.mounts.mounts {
+		if strings.HasPrefix(path+"/", p) && len(p) > len(best.Path) {
+			best = m
+			found = true
+		}
+	}
+	return best, found
+}
+
+// readMountForPath asks Vault which mount contains path
+func (c *Client) readMountForPath(ctx context.Context, path string) (MountInfo, error) {
+	secret, err := c.client.Logical().ReadWithContext(ctx, "sys/internal/ui/mounts/"+strings.TrimSuffix(path, "/"))
+	if err != nil {
+		return MountInfo{}, classify(err)
+	}
+	if secret == nil || secret.Data == nil {
+		return MountInfo{}, fmt.Errorf("no mount information returned")
+	}
+	p, _ := secret.Data["path"].(string)
+	return mountInfoFromMap(p, secret.Data), nil
+}
+
+func mountInfoFromMap(path string, m map[string]interface{}) MountInfo {
+	if !strings.HasSuffix(path, "/") && path != "" {
+		path += "/"
+	}
+	t, _ := m["type"].(string)
+	version := ""
+	if opts, ok := m["options"].(map[string]interface{}); ok {
+		if v, ok := opts["version"].(string); ok {
+			version = v
+		}
+	}
+	return MountInfo{Path: path, Type: t, Version: kvVersion(t, version)}
+}
+
+func kvVersion(engineType, version string) int {
+	switch engineType {
+	case "kv":
+		if version == "2" {
+			return 2
+		}
+		return 1
+	case "generic":
+		return 1
+	default:
+		return 0
+	}
+}
+
+func relativeToMount(m MountInfo, path string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(path, strings.TrimSuffix(m.Path, "/")), "/")
+}
@@ -0,0 +1,49 @@
+package vault_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-go-golems/vault-envrc-generator/pkg/vaulttest"
+)
+
+func TestMountDiscoveryRetriesAfterTransientErrors(t *testing.T) {
+	srv := vaulttest.NewServer(t)
+	client := srv.Client()
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.Empty(t, client.Mounts(cancelled))
+	srv.SetSealed(true)
+	require.Empty(t, client.Mounts(context.Background()))
+	srv.SetSealed(false)
+
+	mounts := client.Mounts(context.Background())
+	require.Len(t, mounts, 1)
+	require.Equal(t, "secret/", mounts[0].Path)
+
+	// Once listed, the table is not fetched again
+	srv.ResetRequests()
+	require.True(t, client.IsAbsolutePath(context.Background(), "secret/app/db"))
+	require.False(t, client.IsAbsolutePath(context.Background(), "app/db"))
+	require.Empty(t, srv.Requests())
+}
+
+func TestMountLookupCachesMisses(t *testing.T) {
+	srv := vaulttest.NewServer(t)
+	// The token may neither list mounts nor look them up per path
+	srv.Deny("sys/")
+	client := srv.Client()
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		require.False(t, client.IsAbsolutePath(ctx, "app/db"))
+		_, err := client.GetSecrets(ctx, "app/db")
+		require.Error(t, err)
+	}
+	require.Equal(t, 1, countRequests(srv, "GET", "sys/internal/ui/mounts"))
+	require.Equal(t, 1, countRequests(srv, "GET", "sys/mounts"))
+	require.Equal(t, 1, countRequests(srv, "GET", "sys/internal/ui/mounts/app/db"))
+}
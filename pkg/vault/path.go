@@ -1,18 +1,48 @@
 package vault
 
-import "strings"
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
 
-func IsAbsoluteVaultPath(p string) bool {
-	return strings.HasPrefix(p, "secrets/") || strings.HasPrefix(p, "secret/") || strings.HasPrefix(p, "auth/") || strings.HasPrefix(p, "sys/") || strings.HasPrefix(p, "transit/")
+// SplitPathVersion splits a "path@version" reference such as "app/db@3" into its path and KV v2
+// version. Paths without a numeric "@" suffix are returned unchanged with version 0 (latest).
+func SplitPathVersion(p string) (string, int, error) {
+	idx := strings.LastIndex(p, "@")
+	if idx < 0 || idx == len(p)-1 || strings.Contains(p[idx+1:], "/") {
+		return p, 0, nil
+	}
+	suffix := p[idx+1:]
+	for _, r := range suffix {
+		if r < '0' || r > '9' {
+			return p, 0, nil
+		}
+	}
+	version, err := strconv.Atoi(suffix)
+	if err != nil || version <= 0 {
+		return "", 0, fmt.Errorf("invalid version in path %q: versions start at 1", p)
+	}
+	return p[:idx], version, nil
 }
 
-func JoinBaseAndPath(basePath, p string) string {
-	if basePath == "" || IsAbsoluteVaultPath(p) {
-		return normalizeSlashes(p)
+// GetSecretsRef reads a "path@version" reference from store, as accepted by generate --path,
+// batch section paths, tree and diff-env. A reference without a version reads the latest one.
+func GetSecretsRef(ctx context.Context, store SecretStore, ref string) (map[string]interface{}, error) {
+	p, version, err := SplitPathVersion(ref)
+	if err != nil {
+		return nil, err
+	}
+	return store.GetSecretsVersion(ctx, p, version)
+}
+
+// JoinPathVersion formats a "path@version" reference; version 0 returns path unchanged.
+func JoinPathVersion(p string, version int) string {
+	if version <= 0 {
+		return p
 	}
-	bp := strings.TrimSuffix(basePath, "/")
-	pp := strings.TrimPrefix(p, "/")
-	return normalizeSlashes(bp + "/" + pp)
+	return fmt.Sprintf("%s@%d", p, version)
 }
 
 func NormalizeListPath(p string) string {
@@ -0,0 +1,68 @@
+package vault_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-go-golems/vault-envrc-generator/pkg/vault"
+	"github.com/go-go-golems/vault-envrc-generator/pkg/vaulttest"
+)
+
+func TestSplitPathVersion(t *testing.T) {
+	for _, tc := range []struct {
+		ref     string
+		path    string
+		version int
+		err     string
+	}{
+		{ref: "app/db", path: "app/db"},
+		{ref: "a@3", path: "a", version: 3},
+		{ref: "secret/app/db@12", path: "secret/app/db", version: 12},
+		{ref: "a@0", err: "versions start at 1"},
+		{ref: "a@", path: "a@"},
+		{ref: "a@b", path: "a@b"},
+		{ref: "user@example.com", path: "user@example.com"},
+		{ref: "a@3/b", path: "a@3/b"},
+	} {
+		t.Run(tc.ref, func(t *testing.T) {
+			p, version, err := vault.SplitPathVersion(tc.ref)
+			if tc.err != "" {
+				require.ErrorContains(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.path, p)
+			require.Equal(t, tc.version, version)
+
+			// Only references with a version round-trip through JoinPathVersion unchanged
+			require.Equal(t, tc.ref, vault.JoinPathVersion(p, version))
+		})
+	}
+	require.Equal(t, "app/db", vault.JoinPathVersion("app/db", 0))
+}
+
+func TestGetSecretsRef(t *testing.T) {
+	srv := vaulttest.NewServer(t)
+	srv.Put("secret/app/db", map[string]interface{}{"password": "v1"})
+	srv.Put("secret/app/db", map[string]interface{}{"password": "v2"})
+	srv.Put("secret/team/release@2", map[string]interface{}{"literal": "yes"})
+	client := srv.Client()
+	ctx := context.Background()
+
+	data, err := vault.GetSecretsRef(ctx, client, "secret/app/db@1")
+	require.NoError(t, err)
+	require.Equal(t, "v1", data["password"])
+	data, err = vault.GetSecretsRef(ctx, client, "secret/app/db")
+	require.NoError(t, err)
+	require.Equal(t, "v2", data["password"])
+
+	// Plain reads take "@" literally
+	data, err = client.GetSecrets(ctx, "secret/team/release@2")
+	require.NoError(t, err)
+	require.Equal(t, "yes", data["literal"])
+	_, version, err := client.GetSecretsWithVersion(ctx, "secret/app/db")
+	require.NoError(t, err)
+	require.Equal(t, 2, version)
+}
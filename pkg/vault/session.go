@@ -0,0 +1,272 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// Stats counts the requests a Session sent to its store and the reads it answered itself
+type Stats struct {
+	Reads         int64
+	Lists         int64
+	Writes        int64
+	Deletes       int64
+	MetadataReads int64
+	TokenLookups  int64
+	// CacheHits counts reads served from the cache or shared with an identical in-flight read
+	CacheHits int64
+}
+
+// Calls returns the total number of requests sent to the store
+func (s Stats) Calls() int64 {
+	return s.Reads + s.Lists + s.Writes + s.Deletes + s.MetadataReads + s.TokenLookups
+}
+
+func (s Stats) String() string {
+	return fmt.Sprintf("vault calls: %d (reads %d, lists %d, writes %d, deletes %d, metadata %d, token lookups %d), cache hits: %d",
+		s.Calls(), s.Reads, s.Lists, s.Writes, s.Deletes, s.MetadataReads, s.TokenLookups, s.CacheHits)
+}
+
+// Session wraps the store used for one run. It reads each secret and the token information at
+// most once, shares identical concurrent reads, and drops cached secrets when they are written
+// or deleted through the session. Changes made by other clients during the run are not seen.
+type Session struct {
+	store   SecretStore
+	onClose func()
+
+	group singleflight.Group
+
+	mu      sync.Mutex
+	secrets map[string]cachedSecret
+	token   map[string]interface{}
+
+	reads, lists, writes, deletes, metadata, lookups, hits atomic.Int64
+}
+
+// cachedSecret is a read result; version is -1 when it came from a read that did not report one
+type cachedSecret struct {
+	data    map[string]interface{}
+	version int
+	err     error
+}
+
+var _ SecretStore = &Session{}
+
+// NewSession wraps store in a session; onClose (may be nil) runs when the session is closed
+func NewSession(store SecretStore, onClose func()) *Session {
+	return &Session{
+		store:   store,
+		onClose: onClose,
+		secrets: map[string]cachedSecret{},
+	}
+}
+
+// Store returns the underlying store
+func (s *Session) Store() SecretStore {
+	return s.store
+}
+
+// Close releases the resources held by the underlying store, such as the token watcher
+func (s *Session) Close() {
+	if s.onClose != nil {
+		s.onClose()
+	}
+}
+
+// Stats returns a snapshot of the session's request counters
+func (s *Session) Stats() Stats {
+	return Stats{
+		Reads:         s.reads.Load(),
+		Lists:         s.lists.Load(),
+		Writes:        s.writes.Load(),
+		Deletes:       s.deletes.Load(),
+		MetadataReads: s.metadata.Load(),
+		TokenLookups:  s.lookups.Load(),
+		CacheHits:     s.hits.Load(),
+	}
+}
+
+func (s *Session) GetSecrets(ctx context.Context, path string) (map[string]interface{}, error) {
+	c, err := s.read(ctx, path, false)
+	if err != nil {
+		return nil, err
+	}
+	return copyData(c.data), nil
+}
+
+// GetSecretsVersion reads a pinned version straight from the store; version 0 is GetSecrets
+func (s *Session) GetSecretsVersion(ctx context.Context, path string, version int) (map[string]interface{}, error) {
+	if version == 0 {
+		return s.GetSecrets(ctx, path)
+	}
+	s.reads.Add(1)
+	return s.store.GetSecretsVersion(ctx, path, version)
+}
+
+func (s *Session) GetSecretsWithVersion(ctx context.Context, path string) (map[string]interface{}, int, error) {
+	c, err := s.read(ctx, path, true)
+	if err != nil {
+		// A soft-deleted latest version is ErrNotFound but still has a version to write against
+		return nil, max(c.version, 0), err
+	}
+	return copyData(c.data), c.version, nil
+}
+
+// read returns the cached result for path, reading it when missing. Only successful reads and
+// ErrNotFound are cached; other errors are retried on the next call.
+func (s *Session) read(ctx context.Context, path string, needVersion bool) (cachedSecret, error) {
+	key := sessionKey(path)
+	s.mu.Lock()
+	c, ok := s.secrets[key]
+	s.mu.Unlock()
+	if ok && (!needVersion || c.version >= 0) {
+		s.hits.Add(1)
+		return c, c.err
+	}
+
+	flightKey := "get:" + key
+	if needVersion {
+		flightKey = "version:" + key
+	}
+	leader := false
+	v, err, _ := s.group.Do(flightKey, func() (interface{}, error) {
+		leader = true
+		s.reads.Add(1)
+		c := cachedSecret{version: -1}
+		var err error
+		if needVersion {
+			c.data, c.version, err = s.store.GetSecretsWithVersion(ctx, path)
+		} else {
+			c.data, err = s.store.GetSecrets(ctx, path)
+		}
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return nil, err
+		}
+		c.err = err
+		s.mu.Lock()
+		s.secrets[key] = c
+		s.mu.Unlock()
+		return c, nil
+	})
+	if !leader {
+		s.hits.Add(1)
+	}
+	if err != nil {
+		return cachedSecret{}, err
+	}
+	c = v.(cachedSecret)
+	return c, c.err
+}
+
+func (s *Session) forget(path string) {
+	key := sessionKey(path)
+	s.mu.Lock()
+	delete(s.secrets, key)
+	s.mu.Unlock()
+	s.group.Forget("get:" + key)
+	s.group.Forget("version:" + key)
+}
+
+func (s *Session) PutSecrets(ctx context.Context, path string, data map[string]interface{}) error {
+	defer s.forget(path)
+	s.writes.Add(1)
+	return s.store.PutSecrets(ctx, path, data)
+}
+
+func (s *Session) PutSecretsCAS(ctx context.Context, path string, data map[string]interface{}, cas int) error {
+	defer s.forget(path)
+	s.writes.Add(1)
+	return s.store.PutSecretsCAS(ctx, path, data, cas)
+}
+
+func (s *Session) PatchSecrets(ctx context.Context, path string, data map[string]interface{}) error {
+	defer s.forget(path)
+	s.writes.Add(1)
+	return s.store.PatchSecrets(ctx, path, data)
+}
+
+func (s *Session) PatchSecretsCAS(ctx context.Context, path string, data map[string]interface{}, cas int) error {
+	defer s.forget(path)
+	s.writes.Add(1)
+	return s.store.PatchSecretsCAS(ctx, path, data, cas)
+}
+
+func (s *Session) DeleteSecret(ctx context.Context, path string) error {
+	defer s.forget(path)
+	s.deletes.Add(1)
+	return s.store.DeleteSecret(ctx, path)
+}
+
+func (s *Session) ListSecrets(ctx context.Context, path string) ([]string, error) {
+	s.lists.Add(1)
+	return s.store.ListSecrets(ctx, path)
+}
+
+func (s *Session) GetSecretMetadata(ctx context.Context, path string) (*SecretMetadata, error) {
+	s.metadata.Add(1)
+	return s.store.GetSecretMetadata(ctx, path)
+}
+
+// LookupToken returns the token information, looking it up only once per session
+func (s *Session) LookupToken(ctx context.Context) (map[string]interface{}, error) {
+	s.mu.Lock()
+	token := s.token
+	s.mu.Unlock()
+	if token != nil {
+		s.hits.Add(1)
+		return token, nil
+	}
+	leader := false
+	v, err, _ := s.group.Do("token", func() (interface{}, error) {
+		leader = true
+		s.lookups.Add(1)
+		data, err := s.store.LookupToken(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if data == nil {
+			data = map[string]interface{}{}
+		}
+		s.mu.Lock()
+		s.token = data
+		s.mu.Unlock()
+		return data, nil
+	})
+	if !leader {
+		s.hits.Add(1)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return v.(map[string]interface{}), nil
+}
+
+func (s *Session) IsAbsolutePath(ctx context.Context, path string) bool {
+	return s.store.IsAbsolutePath(ctx, path)
+}
+
+func (s *Session) JoinBaseAndPath(ctx context.Context, base, path string) string {
+	return s.store.JoinBaseAndPath(ctx, base, path)
+}
+
+func sessionKey(path string) string {
+	return strings.Trim(path, "/")
+}
+
+// copyData returns a shallow copy so callers cannot modify cached data
+func copyData(data map[string]interface{}) map[string]interface{} {
+	if data == nil {
+		return nil
+	}
+	out := make(map[string]interface{}, len(data))
+	for k, v := range data {
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,124 @@
+package vault_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-go-golems/vault-envrc-generator/pkg/vault"
+	"github.com/go-go-golems/vault-envrc-generator/pkg/vaulttest"
+)
+
+func countRequests(srv *vaulttest.Server, method, path string) int {
+	n := 0
+	for _, r := range srv.Requests() {
+		if r.Method == method && r.Path == path {
+			n++
+		}
+	}
+	return n
+}
+
+func TestSessionCachesReads(t *testing.T) {
+	srv := vaulttest.NewServer(t)
+	srv.Put("secret/app/db", map[string]interface{}{"user": "app"})
+	session := vault.NewSession(srv.Client(), nil)
+	srv.ResetRequests()
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			data, err := session.GetSecrets(ctx, "secret/app/db")
+			require.NoError(t, err)
+			require.Equal(t, "app", data["user"])
+		}()
+	}
+	wg.Wait()
+
+	// Callers get copies, so modifying a result does not leak into the cache
+	data, err := session.GetSecrets(ctx, "secret/app/db/")
+	require.NoError(t, err)
+	data["user"] = "changed"
+	data, version, err := session.GetSecretsWithVersion(ctx, "secret/app/db")
+	require.NoError(t, err)
+	require.Equal(t, "app", data["user"])
+	require.Equal(t, 1, version)
+
+	_, err = session.GetSecrets(ctx, "secret/app/missing")
+	require.True(t, errors.Is(err, vault.ErrNotFound))
+	_, err = session.GetSecrets(ctx, "secret/app/missing")
+	require.True(t, errors.Is(err, vault.ErrNotFound))
+
+	// One plain read, one versioned read, one miss
+	require.Equal(t, 2, countRequests(srv, "GET", "secret/data/app/db"))
+	require.Equal(t, 1, countRequests(srv, "GET", "secret/data/app/missing"))
+	stats := session.Stats()
+	require.EqualValues(t, 3, stats.Reads)
+	require.EqualValues(t, 3, stats.Calls())
+	require.EqualValues(t, 9, stats.CacheHits)
+}
+
+func TestSessionWriteInvalidatesCache(t *testing.T) {
+	srv := vaulttest.NewServer(t)
+	srv.Put("secret/app/db", map[string]interface{}{"user": "app"})
+	session := vault.NewSession(srv.Client(), nil)
+	ctx := context.Background()
+
+	_, version, err := session.GetSecretsWithVersion(ctx, "secret/app/db")
+	require.NoError(t, err)
+	require.NoError(t, session.PatchSecretsCAS(ctx, "secret/app/db", map[string]interface{}{"user": "new"}, version))
+
+	data, version, err := session.GetSecretsWithVersion(ctx, "secret/app/db")
+	require.NoError(t, err)
+	require.Equal(t, "new", data["user"])
+	require.Equal(t, 2, version)
+	require.EqualValues(t, 1, session.Stats().Writes)
+}
+
+func TestSessionSoftDeletedSecretKeepsVersion(t *testing.T) {
+	srv := vaulttest.NewServer(t)
+	srv.Put("secret/app/db", map[string]interface{}{"user": "app"})
+	srv.Put("secret/app/db", map[string]interface{}{"user": "app2"})
+	client := srv.Client()
+	ctx := context.Background()
+	require.NoError(t, client.DeleteSecretWithMode(ctx, "secret/app/db", vault.DeleteModeSoft, nil))
+
+	session := vault.NewSession(client, nil)
+	// A plain miss is cached without a version, so the versioned read still asks the store
+	_, err := session.GetSecrets(ctx, "secret/app/db")
+	require.ErrorIs(t, err, vault.ErrNotFound)
+	for i := 0; i < 2; i++ {
+		_, version, err := session.GetSecretsWithVersion(ctx, "secret/app/db")
+		require.ErrorIs(t, err, vault.ErrNotFound)
+		require.Equal(t, 2, version)
+	}
+
+	// Writing on top of the deleted version succeeds with its version as check-and-set
+	require.NoError(t, session.PutSecretsCAS(ctx, "secret/app/db", map[string]interface{}{"user": "new"}, 2))
+	data, version, err := session.GetSecretsWithVersion(ctx, "secret/app/db")
+	require.NoError(t, err)
+	require.Equal(t, "new", data["user"])
+	require.Equal(t, 3, version)
+	require.EqualValues(t, 3, session.Stats().Reads)
+}
+
+func TestSessionLooksUpTokenOnce(t *testing.T) {
+	srv := vaulttest.NewServer(t)
+	srv.SetTokenData(map[string]interface{}{"display_name": "oidc-alice"})
+	session := vault.NewSession(srv.Client(), nil)
+	srv.ResetRequests()
+
+	for i := 0; i < 3; i++ {
+		tctx, err := vault.BuildTemplateContext(context.Background(), session)
+		require.NoError(t, err)
+		require.Equal(t, "alice", tctx.Token.OIDCUserID)
+	}
+	require.Equal(t, 1, countRequests(srv, "GET", "auth/token/lookup-self"))
+	require.EqualValues(t, 1, session.Stats().TokenLookups)
+}
@@ -0,0 +1,53 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+)
+
+// SecretStore is the storage used by the batch, seed, diff-env and listing packages. *Client
+// implements it against a Vault server; other backends (see pkg/filestore) let the same
+// configurations run without one. Paths, versions and errors follow KV v2 semantics: reads of
+// missing secrets wrap ErrNotFound and rejected check-and-set writes wrap ErrVersionConflict.
+type SecretStore interface {
+	// GetSecrets reads the latest version of the secret at path; "@" has no special meaning.
+	GetSecrets(ctx context.Context, path string) (map[string]interface{}, error)
+	// GetSecretsVersion reads the given version of the secret at path (0 = latest).
+	GetSecretsVersion(ctx context.Context, path string, version int) (map[string]interface{}, error)
+	// GetSecretsWithVersion reads the secret at path and returns the version that was read (0 if unversioned).
+	GetSecretsWithVersion(ctx context.Context, path string) (map[string]interface{}, int, error)
+	// PutSecrets replaces the secret at path with data.
+	PutSecrets(ctx context.Context, path string, data map[string]interface{}) error
+	// PutSecretsCAS replaces the secret only if its current version equals version (0 = must not exist).
+	PutSecretsCAS(ctx context.Context, path string, data map[string]interface{}, version int) error
+	// PatchSecrets merges data into the secret at path, creating it if needed.
+	PatchSecrets(ctx context.Context, path string, data map[string]interface{}) error
+	// PatchSecretsCAS merges data only if the current version equals version (0 = must not exist).
+	PatchSecretsCAS(ctx context.Context, path string, data map[string]interface{}, version int) error
+	// ListSecrets lists the keys directly below path; folders end with "/".
+	ListSecrets(ctx context.Context, path string) ([]string, error)
+	// DeleteSecret removes the latest version of the secret at path.
+	DeleteSecret(ctx context.Context, path string) error
+	// GetSecretMetadata returns version metadata, or ErrMetadataNotAvailable for unversioned secrets.
+	GetSecretMetadata(ctx context.Context, path string) (*SecretMetadata, error)
+	// IsAbsolutePath reports whether p starts with a mount and should not be joined onto a base path.
+	IsAbsolutePath(ctx context.Context, p string) bool
+	// JoinBaseAndPath joins p onto basePath unless p is already absolute.
+	JoinBaseAndPath(ctx context.Context, basePath, p string) string
+	// LookupToken returns the token-lookup data used to fill {{ .Token.* }} in templates.
+	LookupToken(ctx context.Context) (map[string]interface{}, error)
+}
+
+var _ SecretStore = &Client{}
+
+// LookupToken returns the lookup-self data of the client token
+func (c *Client) LookupToken(ctx context.Context) (map[string]interface{}, error) {
+	secret, err := c.client.Auth().Token().LookupSelfWithContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("token lookup failed: %w", classify(err))
+	}
+	if secret == nil {
+		return nil, nil
+	}
+	return secret.Data, nil
+}
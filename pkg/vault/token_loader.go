@@ -18,22 +18,58 @@ const (
 	TokenSourceEnv    TokenSource = "env"
 	TokenSourceFile   TokenSource = "file"
 	TokenSourceLookup TokenSource = "lookup"
+
+	// Login sources authenticate against an auth method and return the issued token
+	TokenSourceAppRole    TokenSource = "approle"
+	TokenSourceUserpass   TokenSource = "userpass"
+	TokenSourceJWT        TokenSource = "jwt"
+	TokenSourceKubernetes TokenSource = "kubernetes"
 )
 
+// TokenOptions selects how ResolveToken obtains a token.
+type TokenOptions struct {
+	// Token is an explicit token, used directly by the auto and env sources
+	Token  string
+	Source TokenSource
+	// TokenFile defaults to ~/.vault-token
+	TokenFile string
+	Verbose   bool
+	// Config is used to reach Vault for the login sources
+	Config Config
+	// Auth holds the credentials for the login sources
+	Auth AuthConfig
+}
+
+// IsLogin reports whether the source logs in to an auth method.
+func (s TokenSource) IsLogin() bool {
+	switch s {
+	case TokenSourceAppRole, TokenSourceUserpass, TokenSourceJWT, TokenSourceKubernetes:
+		return true
+	default:
+		return false
+	}
+}
+
 // ResolveToken attempts to resolve a Vault token using the specified source strategy.
-// If explicitToken is provided and source is Auto or Env, it will be used directly.
+// If an explicit token is provided and source is Auto or Env, it will be used directly.
 // For Auto, the order is: explicit/env -> file -> lookup.
-func ResolveToken(ctx context.Context, explicitToken string, source TokenSource, tokenFilePath string, verbose bool) (string, error) {
+// Login sources (approle, userpass, jwt, kubernetes) authenticate with opts.Auth; see Login.
+func ResolveToken(ctx context.Context, opts TokenOptions) (string, error) {
+	explicitToken := opts.Token
+	source := opts.Source
+	tokenFilePath := opts.TokenFile
+	verbose := opts.Verbose
+
 	// Normalize source
 	if source == "" {
 		source = TokenSourceAuto
 	}
 
 	// Expand ~ in tokenFilePath if present
-	if tokenFilePath != "" && strings.HasPrefix(tokenFilePath, "~") {
-		if home, err := os.UserHomeDir(); err == nil {
-			tokenFilePath = filepath.Join(home, strings.TrimPrefix(tokenFilePath, "~"))
-		}
+	tokenFilePath = expandHome(tokenFilePath)
+
+	if source.IsLogin() {
+		return Login(ctx, source, opts.Config, opts.Auth, tokenFilePath)
 	}
 
 	switch source {
@@ -48,10 +84,7 @@ func ResolveToken(ctx context.Context, explicitToken string, source TokenSource,
 
 	case TokenSourceFile:
 		if tokenFilePath == "" {
-			// default to ~/.vault-token
-			if home, err := os.UserHomeDir(); err == nil {
-				tokenFilePath = filepath.Join(home, ".vault-token")
-			}
+			tokenFilePath = defaultTokenFile()
 		}
 		data, err := os.ReadFile(tokenFilePath)
 		if err != nil {
@@ -71,11 +104,11 @@ func ResolveToken(ctx context.Context, explicitToken string, source TokenSource,
 			return t, nil
 		}
 		// 2) file
-		if token, err := ResolveToken(ctx, "", TokenSourceFile, tokenFilePath, verbose); err == nil && token != "" {
+		if token, err := ResolveToken(ctx, TokenOptions{Source: TokenSourceFile, TokenFile: tokenFilePath, Verbose: verbose}); err == nil && token != "" {
 			return token, nil
 		}
 		// 3) lookup
-		if token, err := ResolveToken(ctx, "", TokenSourceLookup, tokenFilePath, verbose); err == nil && token != "" {
+		if token, err := lookupTokenViaCLI(ctx, verbose); err == nil && token != "" {
 			return token, nil
 		}
 		return "", fmt.Errorf("unable to resolve Vault token (tried env, file, lookup)")
@@ -84,6 +117,24 @@ func ResolveToken(ctx context.Context, explicitToken string, source TokenSource,
 	return "", fmt.Errorf("unknown token source: %s", source)
 }
 
+// expandHome expands a leading ~ in p
+func expandHome(p string) string {
+	if p != "" && strings.HasPrefix(p, "~") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, strings.TrimPrefix(p, "~"))
+		}
+	}
+	return p
+}
+
+// defaultTokenFile returns ~/.vault-token, or "" when the home directory is unknown
+func defaultTokenFile() string {
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".vault-token")
+	}
+	return ""
+}
+
 // lookupTokenViaCLI runs `vault token lookup -format=json` and extracts .data.id.
 func lookupTokenViaCLI(ctx context.Context, verbose bool) (string, error) {
 	cmd := exec.CommandContext(ctx, "vault", "token", "lookup", "-format=json")
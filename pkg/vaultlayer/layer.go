@@ -1,21 +1,74 @@
 package vaultlayer
 
 import (
+	"context"
 	"fmt"
+	"time"
 
 	glzcms "github.com/go-go-golems/glazed/pkg/cmds"
 	"github.com/go-go-golems/glazed/pkg/cmds/fields"
 	"github.com/go-go-golems/glazed/pkg/cmds/schema"
 	"github.com/go-go-golems/glazed/pkg/cmds/values"
+
+	"github.com/go-go-golems/vault-envrc-generator/pkg/filestore"
+	"github.com/go-go-golems/vault-envrc-generator/pkg/listing"
+	"github.com/go-go-golems/vault-envrc-generator/pkg/vault"
 )
 
 const VaultLayerSlug = "vault"
 
 type VaultSettings struct {
-	VaultAddr        string `glazed:"vault-addr"`
-	VaultToken       string `glazed:"vault-token"`
-	VaultTokenSource string `glazed:"vault-token-source"`
-	VaultTokenFile   string `glazed:"vault-token-file"`
+	VaultAddr          string  `glazed:"vault-addr"`
+	VaultToken         string  `glazed:"vault-token"`
+	VaultTokenSource   string  `glazed:"vault-token-source"`
+	VaultTokenFile     string  `glazed:"vault-token-file"`
+	VaultCACert        string  `glazed:"vault-cacert"`
+	VaultCAPath        string  `glazed:"vault-capath"`
+	VaultClientCert    string  `glazed:"vault-client-cert"`
+	VaultClientKey     string  `glazed:"vault-client-key"`
+	VaultTLSServerName string  `glazed:"vault-tls-server-name"`
+	VaultSkipVerify    bool    `glazed:"vault-skip-verify"`
+	VaultTimeout       int     `glazed:"vault-timeout"`
+	VaultNamespace     string  `glazed:"vault-namespace"`
+	VaultAuthMount     string  `glazed:"vault-auth-mount"`
+	VaultRoleID        string  `glazed:"vault-role-id"`
+	VaultRoleIDFile    string  `glazed:"vault-role-id-file"`
+	VaultSecretIDFile  string  `glazed:"vault-secret-id-file"`
+	VaultUsername      string  `glazed:"vault-username"`
+	VaultPasswordFile  string  `glazed:"vault-password-file"`
+	VaultAuthRole      string  `glazed:"vault-auth-role"`
+	VaultJWTFile       string  `glazed:"vault-jwt-file"`
+	VaultCacheToken    bool    `glazed:"vault-cache-token"`
+	VaultTokenWarnTTL  int     `glazed:"vault-token-warn-ttl"`
+	VaultTokenRenew    bool    `glazed:"vault-token-renew"`
+	VaultMaxRetries    int     `glazed:"vault-max-retries"`
+	VaultRetryWaitMin  int     `glazed:"vault-retry-wait-min"`
+	VaultRetryWaitMax  int     `glazed:"vault-retry-wait-max"`
+	VaultConcurrency   int     `glazed:"vault-concurrency"`
+	VaultRateLimit     float64 `glazed:"vault-rate-limit"`
+
+	StoreFile       string   `glazed:"store-file"`
+	StoreIdentity   string   `glazed:"store-identity"`
+	StoreRecipients []string `glazed:"store-recipients"`
+}
+
+// ClientConfig converts the settings into a vault.Config. Empty values are filled from the
+// standard VAULT_* environment variables when the client is created.
+func (s *VaultSettings) ClientConfig() vault.Config {
+	return vault.Config{
+		Address:       s.VaultAddr,
+		CACert:        s.VaultCACert,
+		CAPath:        s.VaultCAPath,
+		ClientCert:    s.VaultClientCert,
+		ClientKey:     s.VaultClientKey,
+		TLSServerName: s.VaultTLSServerName,
+		SkipVerify:    s.VaultSkipVerify,
+		Timeout:       time.Duration(s.VaultTimeout) * time.Second,
+		Namespace:     s.VaultNamespace,
+		MaxRetries:    s.VaultMaxRetries,
+		MinRetryWait:  time.Duration(s.VaultRetryWaitMin) * time.Millisecond,
+		MaxRetryWait:  time.Duration(s.VaultRetryWaitMax) * time.Millisecond,
+	}
 }
 
 // NewVaultSection defines a reusable section for Vault configuration.
@@ -27,8 +80,8 @@ func NewVaultSection() (schema.Section, error) {
 			fields.New(
 				"vault-addr",
 				fields.TypeString,
-				fields.WithHelp("Vault server address"),
-				fields.WithDefault("http://127.0.0.1:8200"),
+				fields.WithHelp("Vault server address (default: $VAULT_ADDR, then http://127.0.0.1:8200)"),
+				fields.WithDefault(""),
 			),
 			fields.New(
 				"vault-token",
@@ -39,9 +92,9 @@ func NewVaultSection() (schema.Section, error) {
 			fields.New(
 				"vault-token-source",
 				fields.TypeChoice,
-				fields.WithHelp("Token source: auto|env|file|lookup"),
+				fields.WithHelp("Token source: auto|env|file|lookup, or log in with approle|userpass|jwt|kubernetes"),
 				fields.WithDefault("auto"),
-				fields.WithChoices("auto", "env", "file", "lookup"),
+				fields.WithChoices("auto", "env", "file", "lookup", "approle", "userpass", "jwt", "kubernetes"),
 			),
 			fields.New(
 				"vault-token-file",
@@ -49,6 +102,167 @@ func NewVaultSection() (schema.Section, error) {
 				fields.WithHelp("Path to token file (default ~/.vault-token)"),
 				fields.WithDefault(""),
 			),
+			fields.New(
+				"vault-cacert",
+				fields.TypeString,
+				fields.WithHelp("PEM CA certificate file used to verify the Vault server (default: $VAULT_CACERT)"),
+				fields.WithDefault(""),
+			),
+			fields.New(
+				"vault-capath",
+				fields.TypeString,
+				fields.WithHelp("Directory of PEM CA certificates (default: $VAULT_CAPATH)"),
+				fields.WithDefault(""),
+			),
+			fields.New(
+				"vault-client-cert",
+				fields.TypeString,
+				fields.WithHelp("PEM client certificate for TLS authentication (default: $VAULT_CLIENT_CERT)"),
+				fields.WithDefault(""),
+			),
+			fields.New(
+				"vault-client-key",
+				fields.TypeString,
+				fields.WithHelp("PEM private key for the client certificate (default: $VAULT_CLIENT_KEY)"),
+				fields.WithDefault(""),
+			),
+			fields.New(
+				"vault-tls-server-name",
+				fields.TypeString,
+				fields.WithHelp("SNI host name to use when connecting via TLS (default: $VAULT_TLS_SERVER_NAME)"),
+				fields.WithDefault(""),
+			),
+			fields.New(
+				"vault-skip-verify",
+				fields.TypeBool,
+				fields.WithHelp("Skip TLS certificate verification (insecure; also enabled by $VAULT_SKIP_VERIFY)"),
+				fields.WithDefault(false),
+			),
+			fields.New(
+				"vault-timeout",
+				fields.TypeInteger,
+				fields.WithHelp("Client request timeout in seconds (0 = $VAULT_CLIENT_TIMEOUT or the Vault default of 60s)"),
+				fields.WithDefault(0),
+			),
+			fields.New(
+				"vault-namespace",
+				fields.TypeString,
+				fields.WithHelp("Vault Enterprise namespace (default: $VAULT_NAMESPACE)"),
+				fields.WithDefault(""),
+			),
+			fields.New(
+				"vault-max-retries",
+				fields.TypeInteger,
+				fields.WithHelp("Retries for requests failing with 429/5xx or connection errors (0 = $VAULT_MAX_RETRIES or 2, -1 = no retries)"),
+				fields.WithDefault(0),
+			),
+			fields.New(
+				"vault-retry-wait-min",
+				fields.TypeInteger,
+				fields.WithHelp("Minimum backoff between retries in milliseconds (0 = 1000)"),
+				fields.WithDefault(0),
+			),
+			fields.New(
+				"vault-retry-wait-max",
+				fields.TypeInteger,
+				fields.WithHelp("Maximum backoff between retries in milliseconds (0 = 1500)"),
+				fields.WithDefault(0),
+			),
+			fields.New(
+				"vault-concurrency",
+				fields.TypeInteger,
+				fields.WithHelp("Maximum number of concurrent requests when traversing a tree"),
+				fields.WithDefault(listing.DefaultConcurrency),
+			),
+			fields.New(
+				"vault-rate-limit",
+				fields.TypeFloat,
+				fields.WithHelp("Maximum requests per second when traversing a tree (0 = unlimited)"),
+				fields.WithDefault(0.0),
+			),
+			fields.New(
+				"vault-auth-mount",
+				fields.TypeString,
+				fields.WithHelp("Auth method mount path for login token sources (default: the method name)"),
+				fields.WithDefault(""),
+			),
+			fields.New(
+				"vault-role-id",
+				fields.TypeString,
+				fields.WithHelp("AppRole role ID (default: $VAULT_ROLE_ID)"),
+				fields.WithDefault(""),
+			),
+			fields.New(
+				"vault-role-id-file",
+				fields.TypeString,
+				fields.WithHelp("File containing the AppRole role ID"),
+				fields.WithDefault(""),
+			),
+			fields.New(
+				"vault-secret-id-file",
+				fields.TypeString,
+				fields.WithHelp("File containing the AppRole secret ID (default: $VAULT_SECRET_ID)"),
+				fields.WithDefault(""),
+			),
+			fields.New(
+				"vault-username",
+				fields.TypeString,
+				fields.WithHelp("Userpass username (default: $VAULT_USERNAME)"),
+				fields.WithDefault(""),
+			),
+			fields.New(
+				"vault-password-file",
+				fields.TypeString,
+				fields.WithHelp("File containing the userpass password (default: $VAULT_PASSWORD)"),
+				fields.WithDefault(""),
+			),
+			fields.New(
+				"vault-auth-role",
+				fields.TypeString,
+				fields.WithHelp("Role for JWT/Kubernetes login"),
+				fields.WithDefault(""),
+			),
+			fields.New(
+				"vault-jwt-file",
+				fields.TypeString,
+				fields.WithHelp("File containing the JWT for JWT/Kubernetes login (default: $VAULT_JWT, or the pod service account token for kubernetes)"),
+				fields.WithDefault(""),
+			),
+			fields.New(
+				"vault-cache-token",
+				fields.TypeBool,
+				fields.WithHelp("Cache the login token in the token file and reuse it while valid"),
+				fields.WithDefault(false),
+			),
+			fields.New(
+				"vault-token-warn-ttl",
+				fields.TypeInteger,
+				fields.WithHelp("Warn when the token expires in less than this many seconds (0 = never)"),
+				fields.WithDefault(300),
+			),
+			fields.New(
+				"vault-token-renew",
+				fields.TypeBool,
+				fields.WithHelp("Renew renewable tokens in the background and re-login with the auth method when renewal is no longer possible"),
+				fields.WithDefault(true),
+			),
+			fields.New(
+				"store-file",
+				fields.TypeString,
+				fields.WithHelp("Read and write secrets in this age-encrypted YAML file instead of a Vault server"),
+				fields.WithDefault(""),
+			),
+			fields.New(
+				"store-identity",
+				fields.TypeString,
+				fields.WithHelp("age identity file used to decrypt (and, by default, encrypt) --store-file"),
+				fields.WithDefault(""),
+			),
+			fields.New(
+				"store-recipients",
+				fields.TypeStringList,
+				fields.WithHelp("Additional age recipients (age1...) that --store-file is encrypted to; writes re-encrypt to these and your identity only, so list every teammate"),
+			),
 		),
 	)
 }
@@ -63,6 +277,82 @@ func AddVaultSectionToCommand(c glzcms.Command) (glzcms.Command, error) {
 	return c, nil
 }
 
+// TokenOptions converts the settings into options for vault.ResolveToken.
+func (s *VaultSettings) TokenOptions() vault.TokenOptions {
+	return vault.TokenOptions{
+		Token:     s.VaultToken,
+		Source:    vault.TokenSource(s.VaultTokenSource),
+		TokenFile: s.VaultTokenFile,
+		Config:    s.ClientConfig(),
+		Auth: vault.AuthConfig{
+			Mount:        s.VaultAuthMount,
+			RoleID:       s.VaultRoleID,
+			RoleIDFile:   s.VaultRoleIDFile,
+			SecretIDFile: s.VaultSecretIDFile,
+			Username:     s.VaultUsername,
+			PasswordFile: s.VaultPasswordFile,
+			Role:         s.VaultAuthRole,
+			JWTFile:      s.VaultJWTFile,
+			CacheToken:   s.VaultCacheToken,
+		},
+	}
+}
+
+// TokenWatchOptions converts the settings into options for vault.Client.WatchToken. Re-login is
+// only possible when the token comes from an auth method login source.
+func (s *VaultSettings) TokenWatchOptions() vault.TokenWatchOptions {
+	return vault.TokenWatchOptions{
+		WarnTTL: time.Duration(s.VaultTokenWarnTTL) * time.Second,
+		Renew:   s.VaultTokenRenew,
+		Relogin: s.TokenOptions().ReloginFunc(),
+	}
+}
+
+// TraversalOptions converts the settings into options for the listing engine.
+func (s *VaultSettings) TraversalOptions(depth int) listing.Options {
+	return listing.Options{
+		Depth:       depth,
+		Concurrency: s.VaultConcurrency,
+		RateLimit:   s.VaultRateLimit,
+	}
+}
+
+// OpenSession opens the secret store selected by the settings and wraps it in a caching
+// session: the age-encrypted file store when --store-file is set, otherwise a Vault client
+// whose token is watched until the session is closed.
+func (s *VaultSettings) OpenSession(ctx context.Context) (*vault.Session, error) {
+	store, closeStore, err := s.openStore(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return vault.NewSession(store, closeStore), nil
+}
+
+func (s *VaultSettings) openStore(ctx context.Context) (vault.SecretStore, func(), error) {
+	if s.StoreFile != "" {
+		store, err := filestore.Open(s.StoreFile, filestore.Options{
+			IdentityFile: s.StoreIdentity,
+			Recipients:   s.StoreRecipients,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		return store, func() {}, nil
+	}
+
+	ctx2, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+	token, err := vault.ResolveToken(ctx2, s.TokenOptions())
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to resolve Vault token: %w", err)
+	}
+	client, err := vault.NewClient(ctx, s.ClientConfig(), token)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create Vault client: %w", err)
+	}
+	return client, client.WatchToken(ctx, s.TokenWatchOptions()), nil
+}
+
 // GetVaultSettings returns parsed vault settings from the Values.
 func GetVaultSettings(parsed *values.Values) (*VaultSettings, error) {
 	var s VaultSettings
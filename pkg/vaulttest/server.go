@@ -0,0 +1,670 @@
+// Package vaulttest provides an in-process fake Vault server for tests. It speaks enough of the
+// Vault HTTP API to drive vault.NewClient: KV v1 and KV v2 (data, metadata, delete, undelete,
+// destroy), LIST, auth/token/lookup-self and renew-self, sys/health and the mount listings.
+// Secrets can be loaded from YAML fixtures and every request is recorded so tests can assert on
+// the traffic.
+package vaulttest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/go-go-golems/vault-envrc-generator/pkg/vault"
+)
+
+// DefaultToken is the only token the server accepts unless Server.Token is changed.
+const DefaultToken = "vaulttest-root-token"
+
+// Request is a recorded API request.
+type Request struct {
+	// Method is GET, PUT, POST, PATCH, DELETE or LIST (list requests sent as GET ?list=true are reported as LIST)
+	Method string
+	// Path is the API path without the /v1/ prefix, e.g. "secret/data/app/db"
+	Path  string
+	Query url.Values
+	Body  map[string]interface{}
+}
+
+// Server is a fake Vault server backed by httptest.Server.
+type Server struct {
+	// URL is the server address to use as the Vault address
+	URL string
+	// Token is the token clients must send
+	Token string
+
+	t   testing.TB
+	srv *httptest.Server
+
+	mu       sync.Mutex
+	mounts   map[string]int // mount path ("secret/") -> KV version
+	kv1      map[string]map[string]interface{}
+	kv2      map[string]*kv2Secret
+	token    map[string]interface{}
+	sealed   bool
+	denied   []string
+	requests []Request
+}
+
+type kv2Secret struct {
+	created  time.Time
+	updated  time.Time
+	versions []*kv2Version // versions[i] is version i+1
+}
+
+type kv2Version struct {
+	data      map[string]interface{}
+	created   time.Time
+	deleted   *time.Time
+	destroyed bool
+}
+
+func (v *kv2Version) readable() bool { return v.deleted == nil && !v.destroyed }
+
+// NewServer starts a fake Vault server with a KV v2 engine mounted at secret/ (like a dev server).
+// It is closed automatically when the test finishes.
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+	s := &Server{
+		Token:  DefaultToken,
+		t:      t,
+		mounts: map[string]int{"secret/": 2},
+		kv1:    map[string]map[string]interface{}{},
+		kv2:    map[string]*kv2Secret{},
+		token: map[string]interface{}{
+			"display_name": "token",
+			"policies":     []interface{}{"root"},
+			"path":         "auth/token/root",
+			"type":         "service",
+			"ttl":          0,
+			"renewable":    false,
+			"meta":         nil,
+		},
+	}
+	s.srv = httptest.NewServer(s)
+	s.URL = s.srv.URL
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Close shuts the server down.
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// Client returns a vault.Client connected to the server with Server.Token.
+func (s *Server) Client() *vault.Client {
+	s.t.Helper()
+	client, err := vault.NewClient(context.Background(), vault.Config{Address: s.URL, MaxRetries: -1}, s.Token)
+	if err != nil {
+		s.t.Fatalf("vaulttest: failed to create client: %v", err)
+	}
+	return client
+}
+
+// Mount mounts a KV engine of the given version (1 or 2) at path.
+func (s *Server) Mount(path string, kvVersion int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mounts[strings.Trim(path, "/")+"/"] = kvVersion
+}
+
+// SetTokenData merges data into the auth/token/lookup-self response, e.g. {"display_name": "oidc-alice"}.
+func (s *Server) SetTokenData(data map[string]interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, v := range data {
+		s.token[k] = v
+	}
+}
+
+// SetSealed makes every request except sys/health fail with a 503 "Vault is sealed" error.
+func (s *Server) SetSealed(sealed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sealed = sealed
+}
+
+// Deny makes requests to API paths starting with prefix (e.g. "secret/data/prod/") fail with 403.
+func (s *Server) Deny(prefix string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.denied = append(s.denied, prefix)
+}
+
+// Put stores data at the logical secret path (e.g. "secret/app/db"), creating a new version on KV v2.
+func (s *Server) Put(path string, data map[string]interface{}) {
+	s.t.Helper()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.put(path, data); err != nil {
+		s.t.Fatalf("vaulttest: %v", err)
+	}
+}
+
+// Get returns the latest readable data at the logical secret path.
+func (s *Server) Get(path string) (map[string]interface{}, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	mount, rel, ok := s.resolve(path)
+	if !ok {
+		return nil, false
+	}
+	key := mount + rel
+	if s.mounts[mount] != 2 {
+		data, ok := s.kv1[key]
+		return copyMap(data), ok
+	}
+	secret, ok := s.kv2[key]
+	if !ok {
+		return nil, false
+	}
+	latest := secret.versions[len(secret.versions)-1]
+	if !latest.readable() {
+		return nil, false
+	}
+	return copyMap(latest.data), true
+}
+
+// Version returns the current KV v2 version at the logical secret path (0 if it does not exist).
+func (s *Server) Version(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	mount, rel, ok := s.resolve(path)
+	if !ok {
+		return 0
+	}
+	if secret, ok := s.kv2[mount+rel]; ok {
+		return len(secret.versions)
+	}
+	return 0
+}
+
+// Requests returns the requests recorded so far.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// ResetRequests clears the recorded requests.
+func (s *Server) ResetRequests() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = nil
+}
+
+// Fixture is the YAML fixture format:
+//
+//	token:                 # merged into the lookup-self response
+//	  display_name: oidc-alice
+//	mounts:                # mount path -> KV version
+//	  legacy: 1
+//	secrets:
+//	  secret/app/db:       # a map is stored as one version
+//	    username: app
+//	  secret/app/api:      # a list stores several KV v2 versions, oldest first
+//	    - {key: old}
+//	    - {key: new}
+type Fixture struct {
+	Token   map[string]interface{} `yaml:"token"`
+	Mounts  map[string]int         `yaml:"mounts"`
+	Secrets map[string]interface{} `yaml:"secrets"`
+}
+
+// LoadFixture loads a YAML fixture file into the server.
+func (s *Server) LoadFixture(filename string) {
+	s.t.Helper()
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		s.t.Fatalf("vaulttest: failed to read fixture: %v", err)
+	}
+	s.LoadFixtureYAML(data)
+}
+
+// LoadFixtureYAML loads a YAML fixture into the server.
+func (s *Server) LoadFixtureYAML(data []byte) {
+	s.t.Helper()
+	var f Fixture
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		s.t.Fatalf("vaulttest: invalid fixture: %v", err)
+	}
+	for p, v := range f.Mounts {
+		s.Mount(p, v)
+	}
+	if f.Token != nil {
+		s.SetTokenData(f.Token)
+	}
+
+	paths := make([]string, 0, len(f.Secrets))
+	for p := range f.Secrets {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		switch v := f.Secrets[p].(type) {
+		case map[string]interface{}:
+			s.Put(p, v)
+		case []interface{}:
+			for i, item := range v {
+				m, ok := item.(map[string]interface{})
+				if !ok {
+					s.t.Fatalf("vaulttest: fixture secret %s version %d is not a map", p, i+1)
+				}
+				s.Put(p, m)
+			}
+		default:
+			s.t.Fatalf("vaulttest: fixture secret %s must be a map or a list of maps", p)
+		}
+	}
+}
+
+// ServeHTTP implements the fake Vault API.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/v1/"), "/")
+	method := r.Method
+	if method == "LIST" || (method == http.MethodGet && r.URL.Query().Get("list") == "true") {
+		method = "LIST"
+	}
+	var body map[string]interface{}
+	if raw, err := io.ReadAll(r.Body); err == nil && len(raw) > 0 {
+		dec := json.NewDecoder(strings.NewReader(string(raw)))
+		dec.UseNumber()
+		if err := dec.Decode(&body); err != nil {
+			writeErrors(w, http.StatusBadRequest, "failed to parse JSON input: "+err.Error())
+			return
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, Request{Method: method, Path: path, Query: r.URL.Query(), Body: body})
+
+	if path == "sys/health" {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"initialized": true,
+			"sealed":      s.sealed,
+			"standby":     false,
+			"version":     "1.15.0",
+		})
+		return
+	}
+	if s.sealed {
+		writeErrors(w, http.StatusServiceUnavailable, "Vault is sealed")
+		return
+	}
+	if r.Header.Get("X-Vault-Token") != s.Token {
+		writeErrors(w, http.StatusForbidden, "permission denied")
+		return
+	}
+	for _, prefix := range s.denied {
+		if strings.HasPrefix(path+"/", prefix) {
+			writeErrors(w, http.StatusForbidden, "1 error occurred:\n\t* permission denied\n\n")
+			return
+		}
+	}
+
+	switch {
+	case path == "auth/token/lookup-self":
+		writeJSON(w, http.StatusOK, map[string]interface{}{"data": copyMap(s.token)})
+		return
+	case path == "auth/token/renew-self":
+		// Renewal reports the "ttl" and "renewable" token data, so tests control what it grants
+		writeJSON(w, http.StatusOK, map[string]interface{}{"auth": map[string]interface{}{
+			"client_token":   s.Token,
+			"policies":       s.token["policies"],
+			"lease_duration": s.token["ttl"],
+			"renewable":      s.token["renewable"],
+		}})
+		return
+	case path == "sys/mounts":
+		writeJSON(w, http.StatusOK, map[string]interface{}{"data": s.mountTable()})
+		return
+	case path == "sys/internal/ui/mounts":
+		writeJSON(w, http.StatusOK, map[string]interface{}{"data": map[string]interface{}{"secret": s.mountTable(), "auth": map[string]interface{}{}}})
+		return
+	case strings.HasPrefix(path, "sys/internal/ui/mounts/"):
+		mount, _, ok := s.resolve(strings.TrimPrefix(path, "sys/internal/ui/mounts/"))
+		if !ok {
+			writeErrors(w, http.StatusForbidden, "permission denied")
+			return
+		}
+		info := mountInfo(s.mounts[mount])
+		info["path"] = mount
+		writeJSON(w, http.StatusOK, map[string]interface{}{"data": info})
+		return
+	}
+
+	mount, rel, ok := s.resolve(path)
+	if !ok {
+		writeErrors(w, http.StatusNotFound, fmt.Sprintf("no handler for route %q", path))
+		return
+	}
+	if s.mounts[mount] == 2 {
+		s.serveKVv2(w, method, mount, rel, r.URL.Query(), body)
+		return
+	}
+	s.serveKVv1(w, method, mount+rel, body)
+}
+
+func (s *Server) serveKVv1(w http.ResponseWriter, method, key string, body map[string]interface{}) {
+	switch method {
+	case http.MethodGet:
+		data, ok := s.kv1[key]
+		if !ok {
+			writeErrors(w, http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"data": copyMap(data)})
+	case http.MethodPut, http.MethodPost:
+		s.kv1[key] = copyMap(body)
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		delete(s.kv1, key)
+		w.WriteHeader(http.StatusNoContent)
+	case "LIST":
+		keys := make([]string, 0, len(s.kv1))
+		for k := range s.kv1 {
+			keys = append(keys, k)
+		}
+		s.writeList(w, keys, key)
+	default:
+		writeErrors(w, http.StatusMethodNotAllowed, "unsupported operation")
+	}
+}
+
+func (s *Server) serveKVv2(w http.ResponseWriter, method, mount, rel string, query url.Values, body map[string]interface{}) {
+	kind, secretPath, _ := strings.Cut(rel, "/")
+	key := mount + secretPath
+	secret := s.kv2[key]
+
+	switch {
+	case kind == "data" && method == http.MethodGet:
+		if secret == nil {
+			writeErrors(w, http.StatusNotFound)
+			return
+		}
+		version := len(secret.versions)
+		if v := query.Get("version"); v != "" && v != "0" {
+			version, _ = strconv.Atoi(v)
+		}
+		if version < 1 || version > len(secret.versions) {
+			writeErrors(w, http.StatusNotFound)
+			return
+		}
+		v := secret.versions[version-1]
+		var data interface{}
+		status := http.StatusOK
+		if v.readable() {
+			data = copyMap(v.data)
+		} else {
+			status = http.StatusNotFound
+		}
+		writeJSON(w, status, map[string]interface{}{"data": map[string]interface{}{
+			"data":     data,
+			"metadata": versionMetadata(version, v),
+		}})
+
+	case kind == "data" && (method == http.MethodPut || method == http.MethodPost || method == http.MethodPatch):
+		current := 0
+		if secret != nil {
+			current = len(secret.versions)
+		}
+		if opts, ok := body["options"].(map[string]interface{}); ok {
+			if cas, ok := opts["cas"]; ok && toInt(cas) != current {
+				writeErrors(w, http.StatusBadRequest, "check-and-set parameter did not match the current version")
+				return
+			}
+		}
+		data, _ := body["data"].(map[string]interface{})
+		if method == http.MethodPatch {
+			if secret == nil || !secret.versions[current-1].readable() {
+				writeErrors(w, http.StatusNotFound)
+				return
+			}
+			merged := copyMap(secret.versions[current-1].data)
+			for k, v := range data {
+				if v == nil {
+					delete(merged, k)
+				} else {
+					merged[k] = v
+				}
+			}
+			data = merged
+		}
+		v := s.putKVv2(key, data)
+		writeJSON(w, http.StatusOK, map[string]interface{}{"data": versionMetadata(len(s.kv2[key].versions), v)})
+
+	case kind == "data" && method == http.MethodDelete:
+		if secret != nil {
+			now := time.Now().UTC()
+			secret.versions[len(secret.versions)-1].deleted = &now
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	case (kind == "delete" || kind == "undelete" || kind == "destroy") && (method == http.MethodPut || method == http.MethodPost):
+		versions, _ := body["versions"].([]interface{})
+		if len(versions) == 0 {
+			writeErrors(w, http.StatusBadRequest, "no version number provided")
+			return
+		}
+		if secret != nil {
+			now := time.Now().UTC()
+			for _, raw := range versions {
+				n := toInt(raw)
+				if n < 1 || n > len(secret.versions) {
+					continue
+				}
+				v := secret.versions[n-1]
+				switch kind {
+				case "delete":
+					if v.deleted == nil {
+						v.deleted = &now
+					}
+				case "undelete":
+					if !v.destroyed {
+						v.deleted = nil
+					}
+				case "destroy":
+					v.destroyed = true
+					v.data = nil
+				}
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	case kind == "metadata" && method == http.MethodGet:
+		if secret == nil {
+			writeErrors(w, http.StatusNotFound)
+			return
+		}
+		versions := map[string]interface{}{}
+		for i, v := range secret.versions {
+			versions[strconv.Itoa(i+1)] = versionMetadata(i+1, v)
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"data": map[string]interface{}{
+			"cas_required":    false,
+			"created_time":    formatTime(secret.created),
+			"updated_time":    formatTime(secret.updated),
+			"current_version": len(secret.versions),
+			"oldest_version":  0,
+			"max_versions":    0,
+			"versions":        versions,
+		}})
+
+	case kind == "metadata" && method == http.MethodDelete:
+		delete(s.kv2, key)
+		w.WriteHeader(http.StatusNoContent)
+
+	case kind == "metadata" && method == "LIST":
+		keys := make([]string, 0, len(s.kv2))
+		for k := range s.kv2 {
+			if strings.HasPrefix(k, mount) {
+				keys = append(keys, k)
+			}
+		}
+		s.writeList(w, keys, key)
+
+	default:
+		writeErrors(w, http.StatusMethodNotAllowed, fmt.Sprintf("unsupported operation %s on %s%s", method, mount, rel))
+	}
+}
+
+// writeList answers a LIST request with the keys directly below prefix; folders end with "/"
+func (s *Server) writeList(w http.ResponseWriter, all []string, prefix string) {
+	prefix = strings.TrimSuffix(prefix, "/") + "/"
+	seen := map[string]bool{}
+	for _, k := range all {
+		rest, ok := strings.CutPrefix(k, prefix)
+		if !ok || rest == "" {
+			continue
+		}
+		if idx := strings.Index(rest, "/"); idx >= 0 {
+			rest = rest[:idx+1]
+		}
+		seen[rest] = true
+	}
+	if len(seen) == 0 {
+		writeErrors(w, http.StatusNotFound)
+		return
+	}
+	keys := make([]interface{}, 0, len(seen))
+	sorted := make([]string, 0, len(seen))
+	for k := range seen {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+	for _, k := range sorted {
+		keys = append(keys, k)
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": map[string]interface{}{"keys": keys}})
+}
+
+// put stores data at a logical path; callers hold s.mu
+func (s *Server) put(path string, data map[string]interface{}) error {
+	mount, rel, ok := s.resolve(path)
+	if !ok || rel == "" {
+		return fmt.Errorf("no KV mount for path %s", path)
+	}
+	if s.mounts[mount] == 2 {
+		s.putKVv2(mount+rel, data)
+		return nil
+	}
+	s.kv1[mount+rel] = copyMap(data)
+	return nil
+}
+
+func (s *Server) putKVv2(key string, data map[string]interface{}) *kv2Version {
+	now := time.Now().UTC()
+	secret, ok := s.kv2[key]
+	if !ok {
+		secret = &kv2Secret{created: now}
+		s.kv2[key] = secret
+	}
+	secret.updated = now
+	v := &kv2Version{data: copyMap(data), created: now}
+	secret.versions = append(secret.versions, v)
+	return v
+}
+
+// resolve finds the longest mount containing path and returns the path relative to it
+func (s *Server) resolve(path string) (string, string, bool) {
+	path = strings.Trim(path, "/")
+	best := ""
+	for m := range s.mounts {
+		if strings.HasPrefix(path+"/", m) && len(m) > len(best) {
+			best = m
+		}
+	}
+	if best == "" {
+		return "", "", false
+	}
+	return best, strings.TrimPrefix(strings.TrimPrefix(path, strings.TrimSuffix(best, "/")), "/"), true
+}
+
+func (s *Server) mountTable() map[string]interface{} {
+	table := map[string]interface{}{}
+	for m, v := range s.mounts {
+		table[m] = mountInfo(v)
+	}
+	return table
+}
+
+func mountInfo(kvVersion int) map[string]interface{} {
+	return map[string]interface{}{
+		"type":    "kv",
+		"options": map[string]interface{}{"version": strconv.Itoa(kvVersion)},
+	}
+}
+
+func versionMetadata(version int, v *kv2Version) map[string]interface{} {
+	deletion := ""
+	if v.deleted != nil {
+		deletion = formatTime(*v.deleted)
+	}
+	return map[string]interface{}{
+		"version":         version,
+		"created_time":    formatTime(v.created),
+		"deletion_time":   deletion,
+		"destroyed":       v.destroyed,
+		"custom_metadata": nil,
+	}
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeErrors answers with Vault's error format; a 404 with an empty list is how Vault reports missing data
+func writeErrors(w http.ResponseWriter, status int, errs ...string) {
+	if errs == nil {
+		errs = []string{}
+	}
+	writeJSON(w, status, map[string]interface{}{"errors": errs})
+}
+
+func toInt(v interface{}) int {
+	switch t := v.(type) {
+	case json.Number:
+		n, _ := strconv.Atoi(t.String())
+		return n
+	case float64:
+		return int(t)
+	case int:
+		return t
+	case string:
+		n, _ := strconv.Atoi(t)
+		return n
+	}
+	return -1
+}
+
+func copyMap(m map[string]interface{}) map[string]interface{} {
+	if m == nil {
+		return nil
+	}
+	result := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		result[k] = v
+	}
+	return result
+}